@@ -0,0 +1,190 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// pilot-gendiff compares the xDS output of two Pilot builds. Point it at the
+// monitoring ports of two Pilots fed the same state - optionally feeding a
+// fixture export into both first - and it reports the semantic differences
+// in what they generated. Sources may also be files holding saved dumps.
+//
+//	pilot-gendiff diff http://old-pilot:9093 http://new-pilot:9093 \
+//	    --fixture export.json --token $PILOT_INJECT_TOKEN
+//
+// The exit code is 2 when the builds generated different config, so the
+// command gates release pipelines directly.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"istio.io/istio/pilot/pkg/gendiff"
+	"istio.io/istio/pkg/log"
+	"istio.io/istio/pkg/version"
+)
+
+var (
+	fixtureFile string
+	token       string
+	paths       []string
+
+	rootCmd = &cobra.Command{
+		Use:          "pilot-gendiff",
+		Short:        "Compare config generation between two Pilot builds.",
+		SilenceUsage: true,
+	}
+
+	diffCmd = &cobra.Command{
+		Use:   "diff <pilot-or-file A> <pilot-or-file B>",
+		Short: "Diff the generated config of two Pilots, or two saved dumps.",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(c *cobra.Command, args []string) error {
+			return run(args[0], args[1])
+		},
+	}
+)
+
+func isURL(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// feedFixture POSTs the fixture export into a Pilot's /debug/import.
+func feedFixture(base string, fixture []byte) error {
+	req, err := http.NewRequest(http.MethodPost, base+"/debug/import", bytes.NewReader(fixture))
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("import into %s: %s: %s", base, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// dump collects the configured debug paths from a Pilot, or reads the file
+// when the source is not a URL.
+func dump(source string) (map[string][]byte, error) {
+	if !isURL(source) {
+		b, err := ioutil.ReadFile(source)
+		if err != nil {
+			return nil, err
+		}
+		return map[string][]byte{"file": b}, nil
+	}
+	out := map[string][]byte{}
+	for _, p := range paths {
+		resp, err := http.Get(source + p)
+		if err != nil {
+			return nil, err
+		}
+		b, err := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("fetching %s%s: %s", source, p, resp.Status)
+		}
+		out[p] = b
+	}
+	return out, nil
+}
+
+func run(a, b string) error {
+	if fixtureFile != "" {
+		fixture, err := ioutil.ReadFile(fixtureFile)
+		if err != nil {
+			return err
+		}
+		for _, source := range []string{a, b} {
+			if !isURL(source) {
+				return fmt.Errorf("--fixture requires Pilot URLs, %s is a file", source)
+			}
+			if err := feedFixture(source, fixture); err != nil {
+				return err
+			}
+		}
+	}
+
+	dumpA, err := dump(a)
+	if err != nil {
+		return err
+	}
+	dumpB, err := dump(b)
+	if err != nil {
+		return err
+	}
+
+	identical := true
+	reports := map[string]*gendiff.Report{}
+	for key, da := range dumpA {
+		db, f := dumpB[key]
+		if !f {
+			return fmt.Errorf("no %s dump from %s", key, b)
+		}
+		report, err := gendiff.Diff(da, db)
+		if err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+		if !report.Empty() {
+			identical = false
+			reports[key] = report
+		}
+	}
+
+	if identical {
+		fmt.Println("generated config is semantically identical")
+		return nil
+	}
+	out, err := json.MarshalIndent(reports, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	os.Exit(2)
+	return nil
+}
+
+func init() {
+	diffCmd.PersistentFlags().StringVar(&fixtureFile, "fixture", "",
+		"Endpoint state export (from /debug/export) to feed into both Pilots before diffing")
+	diffCmd.PersistentFlags().StringVar(&token, "token", "",
+		"Bearer token for /debug/import, matching the Pilots' PILOT_INJECT_TOKEN")
+	diffCmd.PersistentFlags().StringSliceVar(&paths, "paths", []string{"/debug/edsz", "/debug/cdsz"},
+		"Debug paths to fetch and compare from each Pilot")
+
+	rootCmd.AddCommand(diffCmd)
+	rootCmd.AddCommand(version.CobraCommand())
+}
+
+func main() {
+	if err := rootCmd.Execute(); err != nil {
+		log.Errora(err)
+		os.Exit(-1)
+	}
+}
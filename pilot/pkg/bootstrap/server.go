@@ -781,6 +781,9 @@ func (s *Server) createK8sServiceControllers(serviceControllers *aggregate.Contr
 	log.Infof("Primary Cluster name: %s", clusterID)
 	kubectl := kube.NewController(s.kubeClient, args.Config.ControllerOptions)
 	s.kubeRegistry = kubectl
+	// Surface discovery anomalies (no instances, NACKs, ejections) as
+	// Kubernetes Events on the affected Service.
+	envoyv2.RegisterDiscoveryEventSink(kube.NewEventSink(s.kubeClient, args.Namespace))
 	serviceControllers.AddRegistry(
 		aggregate.Registry{
 			Name:             serviceregistry.KubernetesRegistry,
@@ -0,0 +1,178 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gendiff compares the xDS output of two Pilot builds semantically.
+// Release engineering feeds the same fixture state into an old and a new
+// Pilot, dumps what each generated (/debug/edsz, /debug/cdsz, ...) and diffs
+// the dumps here. The comparison is by resource name on normalized JSON, so
+// field ordering, resource ordering and volatile fields like nonces and
+// version info do not show up as changes - only semantic differences in the
+// generated config do.
+package gendiff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// volatileKeys are stripped before comparison: they differ between any two
+// runs without the generated config being different.
+var volatileKeys = map[string]bool{
+	"version_info": true,
+	"VersionInfo":  true,
+	"nonce":        true,
+	"Nonce":        true,
+	"ExportedAt":   true,
+}
+
+// Change is one resource both sides generated differently. A and B hold the
+// normalized JSON of each side.
+type Change struct {
+	Name string
+	A    json.RawMessage
+	B    json.RawMessage
+}
+
+// Report is the semantic diff of two dumps.
+type Report struct {
+	// OnlyA and OnlyB list resources generated by one side only.
+	OnlyA []string `json:",omitempty"`
+	OnlyB []string `json:",omitempty"`
+
+	// Changed lists resources generated differently.
+	Changed []Change `json:",omitempty"`
+}
+
+// Empty reports whether the two dumps were semantically identical.
+func (r *Report) Empty() bool {
+	return len(r.OnlyA) == 0 && len(r.OnlyB) == 0 && len(r.Changed) == 0
+}
+
+// strip removes volatile fields in place, recursively.
+func strip(v interface{}) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, e := range t {
+			if volatileKeys[k] {
+				delete(t, k)
+				continue
+			}
+			strip(e)
+		}
+	case []interface{}:
+		for _, e := range t {
+			strip(e)
+		}
+	}
+}
+
+// resourceName extracts the identity of a resource object, or "" if it has
+// none.
+func resourceName(m map[string]interface{}) string {
+	for _, k := range []string{"cluster_name", "clusterName", "name"} {
+		if s, ok := m[k].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// collect walks the document gathering named resources. Descent stops at a
+// collected resource - names nested inside it (weighted clusters, ...) are
+// part of its body, not resources of their own.
+func collect(v interface{}, out map[string]interface{}) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for _, e := range t {
+			collect(e, out)
+		}
+	case []interface{}:
+		for i, e := range t {
+			m, ok := e.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name := resourceName(m)
+			if name == "" {
+				// Anonymous array element: recurse in case it wraps named
+				// resources, e.g. per-connection dump entries.
+				collect(m, out)
+				continue
+			}
+			if _, dup := out[name]; dup {
+				// The same resource can appear once per connection - keyed
+				// by name they ought to be identical, keep the first.
+				continue
+			}
+			_ = i
+			out[name] = m
+		}
+	}
+}
+
+// Resources parses a dump and returns its named resources, normalized.
+func Resources(doc []byte) (map[string]json.RawMessage, error) {
+	var v interface{}
+	if err := json.Unmarshal(doc, &v); err != nil {
+		return nil, fmt.Errorf("parsing dump: %v", err)
+	}
+	strip(v)
+	found := map[string]interface{}{}
+	collect(v, found)
+	out := make(map[string]json.RawMessage, len(found))
+	for name, res := range found {
+		// encoding/json writes map keys sorted, which is the normalization.
+		b, err := json.Marshal(res)
+		if err != nil {
+			return nil, err
+		}
+		out[name] = b
+	}
+	return out, nil
+}
+
+// Diff compares two dumps and reports the semantic differences.
+func Diff(a, b []byte) (*Report, error) {
+	ra, err := Resources(a)
+	if err != nil {
+		return nil, fmt.Errorf("side A: %v", err)
+	}
+	rb, err := Resources(b)
+	if err != nil {
+		return nil, fmt.Errorf("side B: %v", err)
+	}
+
+	report := &Report{}
+	for name, va := range ra {
+		vb, f := rb[name]
+		if !f {
+			report.OnlyA = append(report.OnlyA, name)
+			continue
+		}
+		if !bytes.Equal(va, vb) {
+			report.Changed = append(report.Changed, Change{Name: name, A: va, B: vb})
+		}
+	}
+	for name := range rb {
+		if _, f := ra[name]; !f {
+			report.OnlyB = append(report.OnlyB, name)
+		}
+	}
+	sort.Strings(report.OnlyA)
+	sort.Strings(report.OnlyB)
+	sort.Slice(report.Changed, func(i, j int) bool { return report.Changed[i].Name < report.Changed[j].Name })
+	return report, nil
+}
@@ -0,0 +1,76 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gendiff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffIgnoresVolatileFieldsAndOrder(t *testing.T) {
+	a := []byte(`[
+		{"cluster_name": "outbound|80||a.ns.svc.cluster.local", "endpoints": [{"address": "10.0.0.1"}], "version_info": "1"},
+		{"cluster_name": "outbound|80||b.ns.svc.cluster.local", "endpoints": [], "nonce": "x"}
+	]`)
+	b := []byte(`[
+		{"cluster_name": "outbound|80||b.ns.svc.cluster.local", "nonce": "y", "endpoints": []},
+		{"version_info": "2", "endpoints": [{"address": "10.0.0.1"}], "cluster_name": "outbound|80||a.ns.svc.cluster.local"}
+	]`)
+
+	report, err := Diff(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Empty() {
+		t.Errorf("expected no differences, got %+v", report)
+	}
+}
+
+func TestDiffReportsChanges(t *testing.T) {
+	a := []byte(`[
+		{"cluster_name": "shared", "endpoints": [{"address": "10.0.0.1"}]},
+		{"cluster_name": "removed", "endpoints": []}
+	]`)
+	b := []byte(`[
+		{"cluster_name": "shared", "endpoints": [{"address": "10.0.0.2"}]},
+		{"cluster_name": "added", "endpoints": []}
+	]`)
+
+	report, err := Diff(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(report.OnlyA, []string{"removed"}) {
+		t.Errorf("OnlyA = %v", report.OnlyA)
+	}
+	if !reflect.DeepEqual(report.OnlyB, []string{"added"}) {
+		t.Errorf("OnlyB = %v", report.OnlyB)
+	}
+	if len(report.Changed) != 1 || report.Changed[0].Name != "shared" {
+		t.Errorf("Changed = %+v", report.Changed)
+	}
+}
+
+func TestDiffNestedNamesNotResources(t *testing.T) {
+	// Names nested inside a resource body must not be treated as resources.
+	a := []byte(`[{"name": "listener", "filters": [{"name": "envoy.tcp_proxy"}]}]`)
+	res, err := Resources(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 {
+		t.Errorf("expected one resource, got %v", res)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ClusterNameCodec translates between the (direction, subset, hostname, port)
+// tuple and the Envoy cluster name carrying it. The default codec implements
+// the historical "direction|port|subset|hostname" scheme; alternative schemes
+// (shorter names for memory-constrained Envoys, DNS-safe names for interop)
+// can be plugged in and are then used consistently by CDS and EDS, which only
+// go through BuildSubsetKey/ParseSubsetKey.
+type ClusterNameCodec interface {
+	// BuildSubsetKey generates the cluster name for the tuple.
+	BuildSubsetKey(direction TrafficDirection, subsetName string, hostname Hostname, port int) string
+
+	// ParseSubsetKey is the inverse of BuildSubsetKey, reporting malformed
+	// names.
+	ParseSubsetKey(s string) (direction TrafficDirection, subsetName string, hostname Hostname, port int, err error)
+}
+
+// clusterNameCodec is the active codec. Replaced through SetClusterNameCodec
+// before the server starts serving.
+var clusterNameCodec ClusterNameCodec = defaultClusterNameCodec{}
+
+// SetClusterNameCodec installs an alternative cluster naming scheme. It must
+// be called during startup, before any config is generated - mixing schemes
+// over the lifetime of a process would strand Envoy's existing clusters.
+func SetClusterNameCodec(c ClusterNameCodec) {
+	if c == nil {
+		clusterNameCodec = defaultClusterNameCodec{}
+		return
+	}
+	clusterNameCodec = c
+}
+
+// defaultClusterNameCodec implements the "direction|port|subset|hostname"
+// scheme, plus parsing of the DNS srv form used by the SNI-DNAT router.
+type defaultClusterNameCodec struct{}
+
+func (defaultClusterNameCodec) BuildSubsetKey(direction TrafficDirection, subsetName string, hostname Hostname, port int) string {
+	return fmt.Sprintf("%s|%d|%s|%s", direction, port, subsetName, hostname)
+}
+
+func (defaultClusterNameCodec) ParseSubsetKey(s string) (direction TrafficDirection, subsetName string, hostname Hostname, port int, err error) {
+	var parts []string
+	dnsSrvMode := false
+	// This could be the DNS srv form of the cluster that uses outbound_.port_.subset_.hostname
+	// Since we dont want every callsite to implement the logic to differentiate between the two forms
+	// we add an alternate parser here.
+	if strings.HasPrefix(s, fmt.Sprintf("%s_", TrafficDirectionOutbound)) ||
+		strings.HasPrefix(s, fmt.Sprintf("%s_", TrafficDirectionInbound)) {
+		parts = strings.SplitN(s, ".", 4)
+		dnsSrvMode = true
+	} else {
+		parts = strings.Split(s, "|")
+	}
+
+	if len(parts) < 4 {
+		err = fmt.Errorf("invalid cluster name %q: expected 4 fields, got %d", s, len(parts))
+		return
+	}
+
+	direction = TrafficDirection(strings.TrimSuffix(parts[0], "_"))
+	if direction != TrafficDirectionInbound && direction != TrafficDirectionOutbound {
+		err = fmt.Errorf("invalid cluster name %q: unknown direction %q", s, parts[0])
+		return
+	}
+	port, err = strconv.Atoi(strings.TrimSuffix(parts[1], "_"))
+	if err != nil || port < 0 {
+		err = fmt.Errorf("invalid cluster name %q: bad port %q", s, parts[1])
+		return
+	}
+	subsetName = parts[2]
+
+	if dnsSrvMode {
+		subsetName = strings.TrimSuffix(parts[2], "_")
+	}
+
+	if parts[3] == "" {
+		err = fmt.Errorf("invalid cluster name %q: empty hostname", s)
+		return
+	}
+	hostname = Hostname(parts[3])
+	return
+}
@@ -197,6 +197,14 @@ var (
 		"Endpoints without an associated pod.",
 	)
 
+	// EndpointCountMismatch tracks services whose computed shard endpoint
+	// count diverges from the raw Kubernetes Endpoints object, pointing at
+	// missed events or filter bugs.
+	EndpointCountMismatch = newPushMetric(
+		"pilot_k8s_endpoint_count_mismatch",
+		"Services whose shard endpoints diverge from the raw Endpoints object.",
+	)
+
 	// ProxyStatusNoService represents proxies not selected by any service
 	// This can be normal - for workloads that act only as client, or are not covered by a Service.
 	// It can also be an error, for example in cases the Endpoint list of a service was not updated by the time
@@ -249,6 +257,53 @@ var (
 		"Duplicate envoy clusters caused by service entries with same hostname",
 	)
 
+	// ProxyStatusMalformedSubscription tracks EDS subscriptions with cluster
+	// names that do not parse, which would otherwise silently produce empty
+	// configs.
+	ProxyStatusMalformedSubscription = newPushMetric(
+		"pilot_eds_malformed_subscription",
+		"EDS subscriptions with malformed cluster names.",
+	)
+
+	// ProxyStatusResidencyDenied tracks endpoints withheld from a proxy
+	// because their data-residency label does not match the proxy's declared
+	// residency.
+	ProxyStatusResidencyDenied = newPushMetric(
+		"pilot_eds_residency_denied",
+		"Endpoints not pushed due to data-residency restrictions.",
+	)
+
+	// ProxyStatusVisibilityDenied tracks services withheld from a proxy by a
+	// visibility (exportTo) policy.
+	ProxyStatusVisibilityDenied = newPushMetric(
+		"pilot_xds_visibility_denied",
+		"Services not pushed due to visibility restrictions.",
+	)
+
+	// ProxyStatusIPFamilyFiltered tracks endpoints withheld from a proxy by
+	// the IP-family policy (dual-stack preference).
+	ProxyStatusIPFamilyFiltered = newPushMetric(
+		"pilot_eds_ip_family_filtered",
+		"Endpoints not pushed due to IP family policy.",
+	)
+
+	// ProxyStatusDuplicateEndpoint tracks services whose registry delivered
+	// the same endpoint address more than once in a shard; duplicates are
+	// dropped so they cannot skew load-balancing weights.
+	ProxyStatusDuplicateEndpoint = newPushMetric(
+		"pilot_eds_duplicate_endpoint",
+		"Services with duplicate endpoint addresses in a shard update.",
+	)
+
+	// ProxyStatusWildcardHostEDS tracks clusters for wildcard hosts
+	// (*.example.com). Their members are unknowable ahead of time, so they
+	// are served by original-dst or SNI-based clusters and explicitly
+	// excluded from EDS rather than left to undefined handling.
+	ProxyStatusWildcardHostEDS = newPushMetric(
+		"pilot_eds_wildcard_host",
+		"Wildcard host clusters excluded from EDS.",
+	)
+
 	// ProxyStatusClusterNoInstances tracks clusters (services) without workloads.
 	ProxyStatusClusterNoInstances = newPushMetric(
 		"pilot_eds_no_instances",
@@ -383,6 +438,14 @@ func (ps *PushContext) InitContext(env *Environment) error {
 	return nil
 }
 
+// InitDone reports whether InitContext completed, i.e. the service registry
+// and config store were loaded into this context.
+func (ps *PushContext) InitDone() bool {
+	ps.Mutex.Lock()
+	defer ps.Mutex.Unlock()
+	return ps.initDone
+}
+
 // Caches list of services in the registry, and creates a map
 // of hostname to service
 func (ps *PushContext) initServiceRegistry(env *Environment) error {
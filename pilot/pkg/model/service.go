@@ -26,7 +26,6 @@ import (
 	"bytes"
 	"fmt"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 
@@ -413,6 +412,18 @@ type IstioEndpoint struct {
 
 	// Network holds the network where this endpoint is present
 	Network string
+
+	// Registry is the shard (registry) that produced this endpoint, filled
+	// in when the shard update is applied.
+	Registry string
+
+	// DiscoveredAt is the time the endpoint was first seen; it is carried
+	// over when a shard update re-delivers a known endpoint.
+	DiscoveredAt time.Time
+
+	// LastUpdatedAt is the time of the shard update that last delivered this
+	// endpoint, so debug dumps show how stale its information is.
+	LastUpdatedAt time.Time
 }
 
 // ServiceAttributes represents a group of custom attributes of the service.
@@ -810,7 +821,7 @@ func ParseServiceKey(s string) (hostname Hostname, ports PortList, labels Labels
 // BuildSubsetKey generates a unique string referencing service instances for a given service name, a subset and a port.
 // The proxy queries Pilot with this key to obtain the list of instances in a subset.
 func BuildSubsetKey(direction TrafficDirection, subsetName string, hostname Hostname, port int) string {
-	return fmt.Sprintf("%s|%d|%s|%s", direction, port, subsetName, hostname)
+	return clusterNameCodec.BuildSubsetKey(direction, subsetName, hostname, port)
 }
 
 // BuildDNSSrvSubsetKey generates a unique string referencing service instances for a given service name, a subset and a port.
@@ -826,37 +837,20 @@ func IsValidSubsetKey(s string) bool {
 	return strings.Count(s, "|") == 3
 }
 
-// ParseSubsetKey is the inverse of the BuildSubsetKey method
+// ParseSubsetKey is the inverse of the BuildSubsetKey method. Malformed keys
+// parse to zero values - use ParseSubsetKeyStrict where a malformed name must
+// be detected rather than silently producing an empty config.
 func ParseSubsetKey(s string) (direction TrafficDirection, subsetName string, hostname Hostname, port int) {
-	var parts []string
-	dnsSrvMode := false
-	// This could be the DNS srv form of the cluster that uses outbound_.port_.subset_.hostname
-	// Since we dont want every callsite to implement the logic to differentiate between the two forms
-	// we add an alternate parser here.
-	if strings.HasPrefix(s, fmt.Sprintf("%s_", TrafficDirectionOutbound)) ||
-		strings.HasPrefix(s, fmt.Sprintf("%s_", TrafficDirectionInbound)) {
-		parts = strings.SplitN(s, ".", 4)
-		dnsSrvMode = true
-	} else {
-		parts = strings.Split(s, "|")
-	}
-
-	if len(parts) < 4 {
-		return
-	}
-
-	direction = TrafficDirection(strings.TrimSuffix(parts[0], "_"))
-	port, _ = strconv.Atoi(strings.TrimSuffix(parts[1], "_"))
-	subsetName = parts[2]
-
-	if dnsSrvMode {
-		subsetName = strings.TrimSuffix(parts[2], "_")
-	}
-
-	hostname = Hostname(parts[3])
+	direction, subsetName, hostname, port, _ = ParseSubsetKeyStrict(s)
 	return
 }
 
+// ParseSubsetKeyStrict parses a cluster name and reports malformed input
+// instead of returning zero values.
+func ParseSubsetKeyStrict(s string) (direction TrafficDirection, subsetName string, hostname Hostname, port int, err error) {
+	return clusterNameCodec.ParseSubsetKey(s)
+}
+
 func (l Labels) String() string {
 	labels := make([]string, 0, len(l))
 	for k, v := range l {
@@ -16,6 +16,7 @@ package model
 
 import (
 	"fmt"
+	"math/rand"
 	"reflect"
 	"sort"
 	"testing"
@@ -378,3 +379,65 @@ func TestIsValidSubsetKey(t *testing.T) {
 		}
 	}
 }
+
+func TestParseSubsetKeyStrict(t *testing.T) {
+	cases := []struct {
+		name      string
+		expectErr bool
+		hostname  Hostname
+		port      int
+		subset    string
+	}{
+		{name: "outbound|80|v1|reviews.default.svc.cluster.local",
+			hostname: "reviews.default.svc.cluster.local", port: 80, subset: "v1"},
+		{name: "inbound|8080||mgmtCluster",
+			hostname: "mgmtCluster", port: 8080},
+		{name: "outbound_.80_.v1_.reviews.default.svc.cluster.local",
+			hostname: "reviews.default.svc.cluster.local", port: 80, subset: "v1"},
+		{name: "", expectErr: true},
+		{name: "outbound|80|v1", expectErr: true},
+		{name: "sideways|80|v1|reviews.default.svc.cluster.local", expectErr: true},
+		{name: "outbound|http|v1|reviews.default.svc.cluster.local", expectErr: true},
+		{name: "outbound|80|v1|", expectErr: true},
+	}
+	for _, c := range cases {
+		_, subset, hostname, port, err := ParseSubsetKeyStrict(c.name)
+		if c.expectErr {
+			if err == nil {
+				t.Errorf("ParseSubsetKeyStrict(%q) expected error, got none", c.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseSubsetKeyStrict(%q) unexpected error: %v", c.name, err)
+			continue
+		}
+		if hostname != c.hostname || port != c.port || subset != c.subset {
+			t.Errorf("ParseSubsetKeyStrict(%q) = %v %v %v, want %v %v %v",
+				c.name, hostname, port, subset, c.hostname, c.port, c.subset)
+		}
+	}
+}
+
+// Fuzz the parser with arbitrary inputs: it must never panic, and whatever it
+// accepts must round-trip through BuildSubsetKey.
+func TestParseSubsetKeyFuzz(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42))
+	alphabet := "ab|._-0123456789outbound"
+	for i := 0; i < 10000; i++ {
+		b := make([]byte, rnd.Intn(64))
+		for j := range b {
+			b[j] = alphabet[rnd.Intn(len(alphabet))]
+		}
+		s := string(b)
+		direction, subset, hostname, port, err := ParseSubsetKeyStrict(s)
+		if err != nil {
+			continue
+		}
+		rebuilt := BuildSubsetKey(direction, subset, hostname, port)
+		d2, s2, h2, p2, err2 := ParseSubsetKeyStrict(rebuilt)
+		if err2 != nil || d2 != direction || s2 != subset || h2 != hostname || p2 != port {
+			t.Fatalf("round-trip failed for %q -> %q: %v", s, rebuilt, err2)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// EndpointUIDProvider builds the workload UID written into endpoint metadata,
+// from the workload name, its namespace (empty for registries without
+// namespaces) and the endpoint address. The UID must be stable across
+// restarts of the workload's endpoints - telemetry joins on it.
+type EndpointUIDProvider func(workload, namespace, address string) string
+
+var (
+	uidProvidersMutex sync.RWMutex
+	uidProviders      = map[string]EndpointUIDProvider{}
+)
+
+// RegisterEndpointUIDProvider installs the UID provider for a registry,
+// keyed by the serviceregistry name ("Kubernetes", "Consul", ...).
+// Registries without a provider fall back to DefaultEndpointUID.
+func RegisterEndpointUIDProvider(registry string, provider EndpointUIDProvider) {
+	uidProvidersMutex.Lock()
+	defer uidProvidersMutex.Unlock()
+	uidProviders[registry] = provider
+}
+
+// EndpointUID returns the UID for a workload discovered by the given registry.
+func EndpointUID(registry, workload, namespace, address string) string {
+	uidProvidersMutex.RLock()
+	provider := uidProviders[registry]
+	uidProvidersMutex.RUnlock()
+	if provider != nil {
+		return provider(workload, namespace, address)
+	}
+	return DefaultEndpointUID(registry, workload, namespace, address)
+}
+
+// DefaultEndpointUID formats the UID as "<registry>://<workload>.<namespace>",
+// matching the historical k8s format, dropping the namespace when the
+// registry has none and falling back to the address for anonymous workloads.
+func DefaultEndpointUID(registry, workload, namespace, address string) string {
+	scheme := strings.ToLower(registry)
+	switch {
+	case workload != "" && namespace != "":
+		return fmt.Sprintf("%s://%s.%s", scheme, workload, namespace)
+	case workload != "":
+		return fmt.Sprintf("%s://%s", scheme, workload)
+	default:
+		return fmt.Sprintf("%s://%s", scheme, address)
+	}
+}
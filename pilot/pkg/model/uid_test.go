@@ -0,0 +1,46 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"testing"
+)
+
+func TestEndpointUID(t *testing.T) {
+	cases := []struct {
+		name      string
+		registry  string
+		workload  string
+		namespace string
+		address   string
+		want      string
+	}{
+		{"k8s format", "Kubernetes", "pod1", "ns1", "10.1.1.1", "kubernetes://pod1.ns1"},
+		{"no namespace", "Consul", "node1/web", "", "10.1.1.2", "consul://node1/web"},
+		{"anonymous workload", "Mock", "", "", "10.1.1.3", "mock://10.1.1.3"},
+	}
+	for _, c := range cases {
+		if got := EndpointUID(c.registry, c.workload, c.namespace, c.address); got != c.want {
+			t.Errorf("%s: EndpointUID() => %q, want %q", c.name, got, c.want)
+		}
+	}
+
+	RegisterEndpointUIDProvider("Custom", func(workload, namespace, address string) string {
+		return "vm://" + address
+	})
+	if got := EndpointUID("Custom", "w", "ns", "10.1.1.4"); got != "vm://10.1.1.4" {
+		t.Errorf("EndpointUID() with provider => %q, want vm://10.1.1.4", got)
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"istio.io/istio/pkg/features/pilot"
+)
+
+// The fixed debounce window is a compromise: too long for a quiet mesh (every
+// lone change pays the full delay) and too short under sustained churn (many
+// small pushes instead of batches). With PILOT_ADAPTIVE_DEBOUNCE=1 the window
+// tracks the observed change rate - an EWMA of the interval between config
+// events - shrinking to a quarter of PILOT_DEBOUNCE_AFTER in quiet periods
+// and growing to four times it under churn, never beyond half of
+// PILOT_DEBOUNCE_MAX. The effective window is exported as a gauge.
+
+var (
+	adaptiveDebounce = pilot.AdaptiveDebounce == "1"
+
+	debounceWindow = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "pilot_debounce_window_seconds",
+		Help: "Current effective debounce window.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(debounceWindow)
+}
+
+// recordEventIntervalLocked folds a config event into the interval EWMA.
+// Caller holds updateMutex; lastConfigUpdateTime has not been updated yet.
+func (s *DiscoveryServer) recordEventIntervalLocked(now time.Time) {
+	if !adaptiveDebounce || s.lastConfigUpdateTime.IsZero() {
+		return
+	}
+	interval := now.Sub(s.lastConfigUpdateTime)
+	if s.eventIntervalEWMA == 0 {
+		s.eventIntervalEWMA = interval
+		return
+	}
+	// 80/20 smoothing: reacts within a handful of events without flapping on
+	// a single outlier.
+	s.eventIntervalEWMA = (s.eventIntervalEWMA*4 + interval) / 5
+}
+
+// effectiveDebounce returns the debounce window to use right now.
+func (s *DiscoveryServer) effectiveDebounce() time.Duration {
+	if !adaptiveDebounce {
+		return DebounceAfter
+	}
+	s.updateMutex.RLock()
+	ewma := s.eventIntervalEWMA
+	s.updateMutex.RUnlock()
+	return computeDebounce(ewma)
+}
+
+// effectiveDebounceLocked is effectiveDebounce for callers already holding
+// updateMutex.
+func (s *DiscoveryServer) effectiveDebounceLocked() time.Duration {
+	if !adaptiveDebounce {
+		return DebounceAfter
+	}
+	return computeDebounce(s.eventIntervalEWMA)
+}
+
+// computeDebounce maps the observed event interval to a window.
+func computeDebounce(ewma time.Duration) time.Duration {
+	w := DebounceAfter
+	switch {
+	case ewma == 0:
+		// No history yet.
+	case ewma < DebounceAfter:
+		// Sustained churn: batch harder.
+		w = 4 * DebounceAfter
+	case ewma > 4*DebounceAfter:
+		// Quiet: push promptly.
+		w = DebounceAfter / 4
+	}
+	if w > DebounceMax/2 {
+		w = DebounceMax / 2
+	}
+	if w < 10*time.Millisecond {
+		w = 10 * time.Millisecond
+	}
+	debounceWindow.Set(w.Seconds())
+	return w
+}
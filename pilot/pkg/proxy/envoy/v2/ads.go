@@ -17,6 +17,7 @@ package v2
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"reflect"
 	"sort"
@@ -35,6 +36,7 @@ import (
 	"google.golang.org/grpc/status"
 
 	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/features/pilot"
 	istiolog "istio.io/istio/pkg/log"
 )
 
@@ -245,6 +247,10 @@ type XdsConnection struct {
 	// CDSWatch is set if the remote server is watching Clusters
 	CDSWatch bool
 
+	// EdsOnly is set if the stream only watches endpoints - i.e. the proxy is
+	// not using ADS. Envoys in this mode open one stream per cluster.
+	EdsOnly bool
+
 	// added will be true if at least one discovery request was received, and the connection
 	// is added to the map of active.
 	added bool
@@ -257,6 +263,48 @@ type XdsConnection struct {
 
 	// pushMutex prevents 2 overlapping pushes for this connection.
 	pushMutex sync.Mutex
+
+	// firstPushSent and firstAckTime record, per xDS short type, when the
+	// first push was sent and the first ACK received, for cold-start latency
+	// tracking. Guarded by mu.
+	firstPushSent map[string]time.Time
+	firstAckTime  map[string]time.Time
+
+	// pushState is the connection's position in the push pipeline, and
+	// pushStateSince when it entered it. Guarded by mu.
+	pushState      pushState
+	pushStateSince time.Time
+
+	// disconnectReason records why the connection ended, for the connection
+	// event history. First writer wins. Guarded by mu.
+	disconnectReason string
+
+	// BytesSent accounts response bytes pushed on this connection, by xDS
+	// short type. Guarded by mu.
+	BytesSent map[string]uint64
+
+	// chaosHeld is a push withheld by PILOT_CHAOS reordering, delivered in
+	// place of the next push on the connection. Guarded by mu.
+	chaosHeld *xdsapi.DiscoveryResponse
+
+	// DerivedClusters are EDS watches this connection holds beyond its own
+	// subscriptions - currently mirror targets - reconciled on every EDS
+	// push. Guarded by mu.
+	DerivedClusters []string
+
+	// proxyID is the stable identity of the proxy behind this connection
+	// (node ID + pod UID) and generation which stream of that proxy this
+	// is, starting at 1. Guarded by mu.
+	proxyID    string
+	generation int
+
+	// checksumsSent are the payload checksums of recent responses, keyed by
+	// nonce, verified against proxy echoes. Guarded by mu.
+	checksumsSent []sentChecksum
+
+	// missingClusters are EDS subscriptions Pilot could not serve, for
+	// /debug/missingz. Guarded by mu, allocated on first use.
+	missingClusters map[string]*MissingCluster
 }
 
 // configDump converts the connection internal state into an Envoy Admin API config dump proto
@@ -328,6 +376,10 @@ type XdsEvent struct {
 	pending *int32
 
 	version string
+
+	// newServices lists services first seen since the last push, so their
+	// CDS+EDS sends are tracked as one bundle.
+	newServices []string
 }
 
 func newXdsConnection(peerAddr string, stream DiscoveryStream) *XdsConnection {
@@ -340,6 +392,8 @@ func newXdsConnection(peerAddr string, stream DiscoveryStream) *XdsConnection {
 		stream:       stream,
 		LDSListeners: []*xdsapi.Listener{},
 		RouteConfigs: map[string]*xdsapi.RouteConfiguration{},
+
+		pushStateSince: time.Now(),
 	}
 }
 
@@ -349,10 +403,12 @@ func receiveThread(con *XdsConnection, reqChannel chan *xdsapi.DiscoveryRequest,
 		req, err := con.stream.Recv()
 		if err != nil {
 			if status.Code(err) == codes.Canceled || err == io.EOF {
+				con.markDisconnectReason(reasonClientClosed)
 				adsLog.Infof("ADS: %q %s terminated %v", con.PeerAddr, con.ConID, err)
 				return
 			}
 			*errP = err
+			con.markDisconnectReason(reasonReceiveError)
 			adsLog.Errorf("ADS: %q %s terminated with errors %v", con.PeerAddr, con.ConID, err)
 			totalXDSInternalErrors.Add(1)
 			return
@@ -370,12 +426,17 @@ func (s *DiscoveryServer) StreamAggregatedResources(stream ads.AggregatedDiscove
 	}
 	var discReq *xdsapi.DiscoveryRequest
 
+	if inStandby() {
+		standbyRejects.Add(1)
+		return status.Errorf(codes.Unavailable, "pilot replica is in standby mode")
+	}
+
 	t0 := time.Now()
 	// rate limit the herd, after restart all endpoints will reconnect to the
 	// poor new pilot and overwhelm it.
 	// TODO: instead of readiness probe, let endpoints connect and wait here for
 	// config to become stable. Will better spread the load.
-	s.initRateLimiter.Wait(context.TODO())
+	s.initLimiter().Wait(context.TODO())
 
 	// first call - lazy loading, in tests. This should not happen if readiness
 	// check works, since it assumes ClearCache is called (and as such PushContext
@@ -429,13 +490,23 @@ func (s *DiscoveryServer) StreamAggregatedResources(stream ads.AggregatedDiscove
 				return err
 			}
 			nt.Metadata = model.ParseMetadata(discReq.Node.Metadata)
+			if err := s.checkTenant(&nt); err != nil {
+				adsLog.Warnf("ADS: rejecting %q %s: %v", peerAddr, discReq.Node.Id, err)
+				return status.Error(codes.PermissionDenied, err.Error())
+			}
+			if err := s.checkRevision(&nt); err != nil {
+				adsLog.Infof("ADS: redirecting %q %s: %v", peerAddr, discReq.Node.Id, err)
+				return status.Error(codes.FailedPrecondition, err.Error())
+			}
 			con.mu.Lock()
 			con.modelNode = &nt
 			con.mu.Unlock()
 			if con.ConID == "" {
 				// first request
 				con.ConID = connectionID(discReq.Node.Id)
+				registerProxyIdentity(con)
 			}
+			s.verifyChecksumEcho(con, discReq)
 
 			switch discReq.TypeUrl {
 			case ClusterType:
@@ -445,8 +516,12 @@ func (s *DiscoveryServer) StreamAggregatedResources(stream ads.AggregatedDiscove
 						adsLog.Warnf("ADS:CDS: ACK ERROR %v %s %v", peerAddr, con.ConID, discReq.String())
 						cdsReject.With(prometheus.Labels{"node": discReq.Node.Id, "err": discReq.ErrorDetail.Message}).Add(1)
 						totalXDSRejects.Add(1)
+						emitAnomaly(AnomalyConfigNACKed, "", fmt.Sprintf("%s rejected CDS config: %s", con.ConID, discReq.ErrorDetail.Message))
+						con.noteNack()
 					} else if discReq.ResponseNonce != "" {
 						con.ClusterNonceAcked = discReq.ResponseNonce
+						con.recordFirstAck(ClusterType)
+						con.noteAck()
 					}
 					adsLog.Debugf("ADS:CDS: ACK %v %v", peerAddr, discReq.String())
 					continue
@@ -456,8 +531,9 @@ func (s *DiscoveryServer) StreamAggregatedResources(stream ads.AggregatedDiscove
 				// soon as the CDS push is returned.
 				adsLog.Infof("ADS:CDS: REQ %v %s %v raw: %s", peerAddr, con.ConID, time.Since(t0), discReq.String())
 				con.CDSWatch = true
-				err := s.pushCds(con, s.globalPushContext(), versionInfo())
-				if err != nil {
+				if s.canResume(con, discReq) {
+					resumeWatch(con, discReq)
+				} else if err := s.pushCds(con, s.globalPushContext(), versionInfo()); err != nil {
 					return err
 				}
 
@@ -468,8 +544,12 @@ func (s *DiscoveryServer) StreamAggregatedResources(stream ads.AggregatedDiscove
 						adsLog.Warnf("ADS:LDS: ACK ERROR %v %s %v", peerAddr, con.modelNode.ID, discReq.String())
 						ldsReject.With(prometheus.Labels{"node": discReq.Node.Id, "err": discReq.ErrorDetail.Message}).Add(1)
 						totalXDSRejects.Add(1)
+						emitAnomaly(AnomalyConfigNACKed, "", fmt.Sprintf("%s rejected LDS config: %s", con.ConID, discReq.ErrorDetail.Message))
+						con.noteNack()
 					} else if discReq.ResponseNonce != "" {
 						con.ListenerNonceAcked = discReq.ResponseNonce
+						con.recordFirstAck(ListenerType)
+						con.noteAck()
 					}
 					adsLog.Debugf("ADS:LDS: ACK %v", discReq.String())
 					continue
@@ -477,8 +557,9 @@ func (s *DiscoveryServer) StreamAggregatedResources(stream ads.AggregatedDiscove
 				// too verbose - sent immediately after EDS response is received
 				adsLog.Debugf("ADS:LDS: REQ %s %v", con.ConID, peerAddr)
 				con.LDSWatch = true
-				err := s.pushLds(con, s.globalPushContext(), true, versionInfo())
-				if err != nil {
+				if s.canResume(con, discReq) {
+					resumeWatch(con, discReq)
+				} else if err := s.pushLds(con, s.globalPushContext(), true, versionInfo()); err != nil {
 					return err
 				}
 
@@ -499,6 +580,8 @@ func (s *DiscoveryServer) StreamAggregatedResources(stream ads.AggregatedDiscove
 							adsLog.Warnf("ADS:RDS: ACK ERROR %v %s (%s) %v", peerAddr, con.ConID, con.modelNode, discReq.String())
 							rdsReject.With(prometheus.Labels{"node": discReq.Node.Id, "err": discReq.ErrorDetail.Message}).Add(1)
 							totalXDSRejects.Add(1)
+							emitAnomaly(AnomalyConfigNACKed, "", fmt.Sprintf("%s rejected RDS config: %s", con.ConID, discReq.ErrorDetail.Message))
+							con.noteNack()
 						}
 						// Not logging full request, can be very long.
 						adsLog.Debugf("ADS:RDS: ACK %s %s (%s) %s %s", peerAddr, con.ConID, con.modelNode, discReq.VersionInfo, discReq.ResponseNonce)
@@ -508,6 +591,8 @@ func (s *DiscoveryServer) StreamAggregatedResources(stream ads.AggregatedDiscove
 								con.mu.Lock()
 								con.RouteNonceAcked = discReq.ResponseNonce
 								con.mu.Unlock()
+								con.recordFirstAck(RouteType)
+								con.noteAck()
 							}
 							continue
 						}
@@ -516,8 +601,9 @@ func (s *DiscoveryServer) StreamAggregatedResources(stream ads.AggregatedDiscove
 
 				con.Routes = routes
 				adsLog.Debugf("ADS:RDS: REQ %s %s  routes: %d", peerAddr, con.ConID, len(con.Routes))
-				err := s.pushRoute(con, s.globalPushContext())
-				if err != nil {
+				if s.canResume(con, discReq) {
+					resumeWatch(con, discReq)
+				} else if err := s.pushRoute(con, s.globalPushContext()); err != nil {
 					return err
 				}
 
@@ -527,12 +613,16 @@ func (s *DiscoveryServer) StreamAggregatedResources(stream ads.AggregatedDiscove
 					adsLog.Warnf("ADS:EDS: ACK ERROR %v %s %v", peerAddr, con.ConID, discReq.String())
 					edsReject.With(prometheus.Labels{"node": discReq.Node.Id, "err": discReq.ErrorDetail.Message}).Add(1)
 					totalXDSRejects.Add(1)
+					emitAnomaly(AnomalyConfigNACKed, "", fmt.Sprintf("%s rejected EDS config: %s", con.ConID, discReq.ErrorDetail.Message))
+					con.noteNack()
 				}
 
 				if clusters == nil && discReq.ResponseNonce != "" {
 					// There is no requirement that ACK includes clusters. The test doesn't.
 					if discReq.ErrorDetail == nil && discReq.ResponseNonce != "" {
 						con.EndpointNonceAcked = discReq.ResponseNonce
+						con.recordFirstAck(EndpointType)
+						con.noteAck()
 					}
 					continue
 				}
@@ -548,6 +638,8 @@ func (s *DiscoveryServer) StreamAggregatedResources(stream ads.AggregatedDiscove
 					if reflect.DeepEqual(con.Clusters, clusters) {
 						if discReq.ErrorDetail == nil && discReq.ResponseNonce != "" {
 							con.EndpointNonceAcked = discReq.ResponseNonce
+							con.recordFirstAck(EndpointType)
+							con.noteAck()
 							if len(edsClusters) != 0 {
 								con.EndpointPercent = int((float64(len(clusters)) / float64(len(edsClusters))) * float64(100))
 							}
@@ -556,6 +648,34 @@ func (s *DiscoveryServer) StreamAggregatedResources(stream ads.AggregatedDiscove
 					}
 				}
 
+				if overClusterQuota(clusters) {
+					clusterQuotaRejections.Add(1)
+					adsLog.Warnf("ADS:EDS: %v %s watches %d clusters, above the per-connection quota %d",
+						peerAddr, con.ConID, len(clusters), maxClustersPerConnection)
+					return status.Errorf(codes.ResourceExhausted,
+						"subscription to %d clusters exceeds PILOT_MAX_CLUSTERS_PER_CONNECTION=%d",
+						len(clusters), maxClustersPerConnection)
+				}
+
+				if !con.CDSWatch && !con.LDSWatch {
+					// The proxy is not using ADS on this stream - older Envoys
+					// open a separate EDS stream for each cluster.
+					if pilot.RejectNonADSEds {
+						edsOnlyStreamsRejected.Add(1)
+						adsLog.Warnf("ADS:EDS: rejecting non-ADS EDS stream %v %s", peerAddr, con.ConID)
+						return status.Errorf(codes.PermissionDenied, "EDS streams without a cluster watch are disabled, use ADS")
+					}
+					con.mu.Lock()
+					wasEdsOnly := con.EdsOnly
+					con.EdsOnly = true
+					con.mu.Unlock()
+					if !wasEdsOnly {
+						// Recompute the gauge once more when the stream closes.
+						defer updateEdsOnlyStreams()
+						updateEdsOnlyStreams()
+					}
+				}
+
 				for _, cn := range con.Clusters {
 					s.removeEdsCon(cn, con.ConID, con)
 				}
@@ -566,8 +686,9 @@ func (s *DiscoveryServer) StreamAggregatedResources(stream ads.AggregatedDiscove
 
 				con.Clusters = clusters
 				adsLog.Debugf("ADS:EDS: REQ %s %s clusters: %d", peerAddr, con.ConID, len(con.Clusters))
-				err := s.pushEds(s.globalPushContext(), con, true, nil)
-				if err != nil {
+				if s.canResume(con, discReq) {
+					resumeWatch(con, discReq)
+				} else if err := s.pushEds(s.globalPushContext(), con, true, nil); err != nil {
 					return err
 				}
 
@@ -608,6 +729,7 @@ func (s *DiscoveryServer) IncrementalAggregatedResources(stream ads.AggregatedDi
 // Compute and send the new configuration. This is blocking and may be slow
 // for large configs.
 func (s *DiscoveryServer) pushAll(con *XdsConnection, pushEv *XdsEvent) error {
+	con.setPushState(pushStateGenerating)
 	if pushEv.edsUpdatedServices != nil {
 		// Push only EDS. This is indexed already - push immediately
 		// (may need a throttle)
@@ -621,7 +743,7 @@ func (s *DiscoveryServer) pushAll(con *XdsConnection, pushEv *XdsEvent) error {
 
 	adsLog.Infof("Pushing %v", con.ConID)
 
-	s.rateLimiter.Wait(context.TODO()) // rate limit the actual push
+	s.limiter().Wait(context.TODO()) // rate limit the actual push
 
 	// Prevent 2 overlapping pushes.
 	con.pushMutex.Lock()
@@ -633,6 +755,7 @@ func (s *DiscoveryServer) pushAll(con *XdsConnection, pushEv *XdsEvent) error {
 			// Display again the push status
 			pushEv.push.End = time.Now()
 			proxiesConvergeDelay.Observe(time.Since(pushEv.push.Start).Seconds())
+			checkPushSLO(time.Since(pushEv.push.Start))
 			out, _ := pushEv.push.JSON()
 			adsLog.Infof("Push finished: %v %s",
 				time.Since(pushEv.push.Start), string(out))
@@ -645,18 +768,26 @@ func (s *DiscoveryServer) pushAll(con *XdsConnection, pushEv *XdsEvent) error {
 		return nil
 	}
 
+	// CDS and EDS are sent back-to-back; for new services the pair is
+	// tracked as one bundle, so the service becomes routable in one round.
+	bundle := newServiceBundle(pushEv.newServices)
+
 	if con.CDSWatch {
 		err := s.pushCds(con, pushEv.push, pushEv.version)
 		if err != nil {
+			bundle.broken("cds")
 			return err
 		}
+		bundle.cdsPushed()
 	}
 
 	if len(con.Clusters) > 0 {
 		err := s.pushEds(pushEv.push, con, true, nil)
 		if err != nil {
+			bundle.broken("eds")
 			return err
 		}
+		bundle.edsPushed(con.ConID)
 	}
 	if con.LDSWatch {
 		err := s.pushLds(con, pushEv.push, false, pushEv.version)
@@ -670,6 +801,7 @@ func (s *DiscoveryServer) pushAll(con *XdsConnection, pushEv *XdsEvent) error {
 			return err
 		}
 	}
+	s.pushLedger.markCompleted(pushEv.version, connectionNodeID(con))
 	return nil
 }
 
@@ -691,6 +823,13 @@ func AdsPushAll(s *DiscoveryServer) {
 // to the model ConfigStorageCache and Controller.
 func (s *DiscoveryServer) AdsPushAll(version string, push *model.PushContext,
 	full bool, edsUpdates map[string]*EndpointShardsByService) {
+	s.adsPushAll(version, push, full, edsUpdates, false)
+}
+
+// adsPushAll implements AdsPushAll; periodic marks the failsafe resync,
+// which skips connections that have not ACKed the previous push.
+func (s *DiscoveryServer) adsPushAll(version string, push *model.PushContext,
+	full bool, edsUpdates map[string]*EndpointShardsByService, periodic bool) {
 	if !full {
 		s.edsIncremental(version, push, edsUpdates)
 		return
@@ -721,15 +860,30 @@ func (s *DiscoveryServer) AdsPushAll(version string, push *model.PushContext,
 		if err := s.updateCluster(push, clusterName, edsCluster); err != nil {
 			adsLog.Errorf("updateCluster failed with clusterName %s", clusterName)
 			totalXDSInternalErrors.Add(1)
+			s.recordClusterFailure(clusterName, edsCluster, err)
+			continue
 		}
+		recordClusterSuccess(edsCluster)
 	}
 	adsLog.Infof("Cluster init time %v %s", time.Since(t0), version)
-	s.startPush(version, push, true, nil)
+
+	// Open a ledger generation covering the currently connected proxies.
+	adsClientsMutex.RLock()
+	nodeIDs := make([]string, 0, len(adsClients))
+	for _, con := range adsClients {
+		if id := connectionNodeID(con); id != "" {
+			nodeIDs = append(nodeIDs, id)
+		}
+	}
+	adsClientsMutex.RUnlock()
+	s.pushLedger.begin(version, nodeIDs)
+
+	s.startPush(version, push, true, nil, periodic)
 }
 
 // Send a signal to all connections, with a push event.
 func (s *DiscoveryServer) startPush(version string, push *model.PushContext, full bool,
-	edsUpdates map[string]*EndpointShardsByService) {
+	edsUpdates map[string]*EndpointShardsByService, periodic bool) {
 
 	// Push config changes, iterating over connected envoys. This cover ADS and EDS(0.7), both share
 	// the same connection table
@@ -741,6 +895,10 @@ func (s *DiscoveryServer) startPush(version string, push *model.PushContext, ful
 	}
 	adsClientsMutex.RUnlock()
 
+	// The scheduler decides the order; the default puts gateways first,
+	// since they affect traffic entering the mesh.
+	queue := s.pushScheduler.Start(pending)
+
 	// This will trigger recomputing the config for each connected Envoy.
 	// It will include sending all configs that envoy is listening for, including EDS.
 	// TODO: get service, serviceinstances, configs once, to avoid repeated redundant calls.
@@ -748,17 +906,32 @@ func (s *DiscoveryServer) startPush(version string, push *model.PushContext, ful
 
 	pendingPush := int32(len(pending))
 
+	// New services covered by this full push; their CDS and EDS sends are
+	// tracked together per connection.
+	var newServices []string
+	if full {
+		newServices = s.takeNewServicesForPush()
+	}
+
 	tstart := time.Now()
 	// Will keep trying to push to sidecars until another push starts.
 	wg := sync.WaitGroup{}
 	for {
 
-		if len(pending) == 0 {
+		// Using non-blocking push has problems if 2 pushes happen too close to each other
+		client := queue.Next()
+		if client == nil {
 			break
 		}
-		// Using non-blocking push has problems if 2 pushes happen too close to each other
-		client := pending[0]
-		pending = pending[1:]
+
+		// The failsafe resync doesn't stack pushes on proxies that are
+		// still digesting the previous one.
+		if periodic && !client.ackedLastPush() {
+			periodicResyncSkips.Add(1)
+			atomic.AddInt32(&pendingPush, -1)
+			adsLog.Infof("Periodic push skipped for %s: previous push not ACKed", client.ConID)
+			continue
+		}
 
 		wg.Add(1)
 		s.concurrentPushLimit <- struct{}{}
@@ -787,9 +960,11 @@ func (s *DiscoveryServer) startPush(version string, push *model.PushContext, ful
 				pending:            &pendingPush,
 				version:            version,
 				edsUpdatedServices: edsOnly,
+				newServices:        newServices,
 			}:
 				client.LastPush = time.Now()
 				client.LastPushFailure = timeZero
+				client.setPushState(pushStateQueued)
 			case <-client.doneChannel: // connection was closed
 				adsLog.Infof("Client closed connection %v", client.ConID)
 			case <-time.After(PushTimeout):
@@ -825,6 +1000,7 @@ func (s *DiscoveryServer) addCon(conID string, con *XdsConnection) {
 	defer adsClientsMutex.Unlock()
 	adsClients[conID] = con
 	xdsClients.Set(float64(len(adsClients)))
+	recordConnectionEvent(con, "connect", "")
 	if con.modelNode != nil {
 		if _, ok := adsSidecarIDConnectionsMap[con.modelNode.ID]; !ok {
 			adsSidecarIDConnectionsMap[con.modelNode.ID] = map[string]*XdsConnection{conID: con}
@@ -841,6 +1017,9 @@ func (s *DiscoveryServer) removeCon(conID string, con *XdsConnection) {
 	for _, c := range con.Clusters {
 		s.removeEdsCon(c, conID, con)
 	}
+	for _, c := range con.DerivedClusters {
+		s.removeEdsCon(c, conID, con)
+	}
 
 	if _, exist := adsClients[conID]; !exist {
 		adsLog.Errorf("ADS: Removing connection for non-existing node %v.", conID)
@@ -853,18 +1032,44 @@ func (s *DiscoveryServer) removeCon(conID string, con *XdsConnection) {
 	if con.modelNode != nil {
 		delete(adsSidecarIDConnectionsMap[con.modelNode.ID], conID)
 	}
+	con.mu.RLock()
+	reason := con.disconnectReason
+	con.mu.RUnlock()
+	if reason == "" {
+		reason = reasonError
+	}
+	recordConnectionEvent(con, "disconnect", reason)
+	foldProxyIdentity(con)
 }
 
 // Send with timeout
 func (conn *XdsConnection) send(res *xdsapi.DiscoveryResponse) error {
+	switch pickChaosAction(conn) {
+	case chaosDrop:
+		recordChaos("drop", conn, res)
+		return nil
+	case chaosDelay:
+		recordChaos("delay", conn, res)
+		time.Sleep(chaosDelayDuration)
+	case chaosReorder:
+		held := conn.swapChaosHeld(res)
+		recordChaos("reorder", conn, res)
+		if held == nil {
+			return nil
+		}
+		res = held
+	}
+	conn.setPushState(pushStateSending)
 	done := make(chan error)
 	// hardcoded for now - not sure if we need a setting
 	t := time.NewTimer(SendTimeout)
 	go func() {
 		err := conn.stream.Send(res)
 		done <- err
+		cs := responseChecksum(res)
 		conn.mu.Lock()
 		if res.Nonce != "" {
+			conn.recordChecksumLocked(res.Nonce, cs)
 			switch res.TypeUrl {
 			case ClusterType:
 				conn.ClusterNonceSent = res.Nonce
@@ -876,16 +1081,27 @@ func (conn *XdsConnection) send(res *xdsapi.DiscoveryResponse) error {
 				conn.EndpointNonceSent = res.Nonce
 			}
 		}
+		if err == nil {
+			conn.recordFirstPushLocked(res.TypeUrl)
+			conn.recordBytesSentLocked(res.TypeUrl, res.Size())
+		}
 		conn.mu.Unlock()
+		if err == nil && res.Nonce != "" {
+			conn.setPushState(pushStateAwaitingAck)
+		}
 	}()
 	select {
 	case <-t.C:
 		// TODO: wait for ACK
+		conn.markDisconnectReason(reasonSendTimeout)
 		adsLog.Infof("Timeout writing %s", conn.ConID)
 		xdsResponseWriteTimeouts.Add(1)
 		return errors.New("timeout sending")
 	case err := <-done:
 		t.Stop()
+		if err != nil {
+			conn.markDisconnectReason(reasonWriteError)
+		}
 		return err
 	}
 }
@@ -0,0 +1,209 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"istio.io/istio/pkg/features/pilot"
+)
+
+// Teams alert on control-plane health by scraping Pilot logs today. The
+// alerting hooks fire structured notifications on defined conditions - a
+// NACK storm, a full push blowing its latency SLO - so they can be wired
+// straight into a webhook receiver (PagerDuty, Slack bridges, ...).
+// Notifiers must not block; the built-in webhook notifier posts from its own
+// goroutine. PILOT_ALERT_TEMPLATE customizes the payload, the default is the
+// Alert as JSON.
+
+// Alert conditions raised by the xDS server.
+const (
+	AlertNACKStorm       = "NACKStorm"
+	AlertPushSLOBreach   = "PushSLOBreach"
+	AlertRegistryDesync  = "RegistryDesync"
+	alertWindow          = time.Minute
+	defaultNACKThreshold = 10
+)
+
+// Alert is one alerting notification.
+type Alert struct {
+	// Condition is one of the Alert constants.
+	Condition string `json:"condition"`
+
+	// Message is a human-readable summary.
+	Message string `json:"message"`
+
+	// Details carries condition-specific values, e.g. the NACK count or the
+	// push duration.
+	Details map[string]string `json:"details,omitempty"`
+
+	Time time.Time `json:"time"`
+}
+
+// AlertNotifier receives raised alerts. Implementations must not block.
+type AlertNotifier interface {
+	Notify(alert Alert)
+}
+
+var (
+	alertMutex     sync.Mutex
+	alertNotifiers []AlertNotifier
+
+	// alertLastRaised rate-limits per condition, one alert per window.
+	alertLastRaised = map[string]time.Time{}
+
+	// nackTimes holds NACK timestamps inside the sliding window.
+	nackTimes []time.Time
+
+	// nackStormThreshold is the NACK count per minute that raises an alert
+	// (PILOT_ALERT_NACK_STORM).
+	nackStormThreshold int
+
+	// pushSLO is the full push duration above which an alert is raised
+	// (PILOT_PUSH_SLO), zero disables the check.
+	pushSLO time.Duration
+
+	alertsRaised = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pilot_alerts_raised",
+		Help: "Alerts raised by condition.",
+	}, []string{"condition"})
+)
+
+func init() {
+	prometheus.MustRegister(alertsRaised)
+	nackStormThreshold = intEnv(pilot.AlertNACKStorm, defaultNACKThreshold)
+	pushSLO = envDuration(pilot.PushSLO, 0)
+	if pilot.AlertWebhook != "" {
+		RegisterAlertNotifier(newWebhookNotifier(pilot.AlertWebhook, pilot.AlertTemplate))
+	}
+}
+
+// RegisterAlertNotifier adds a notifier for raised alerts.
+func RegisterAlertNotifier(n AlertNotifier) {
+	alertMutex.Lock()
+	alertNotifiers = append(alertNotifiers, n)
+	alertMutex.Unlock()
+}
+
+// RaiseAlert fires a condition to all notifiers, rate-limited to one alert
+// per condition per minute.
+func RaiseAlert(condition, message string, details map[string]string) {
+	alertMutex.Lock()
+	if last, f := alertLastRaised[condition]; f && time.Since(last) < alertWindow {
+		alertMutex.Unlock()
+		return
+	}
+	alertLastRaised[condition] = time.Now()
+	notifiers := make([]AlertNotifier, len(alertNotifiers))
+	copy(notifiers, alertNotifiers)
+	alertMutex.Unlock()
+
+	alertsRaised.With(prometheus.Labels{"condition": condition}).Add(1)
+	adsLog.Warnf("Alert %s: %s %v", condition, message, details)
+	alert := Alert{Condition: condition, Message: message, Details: details, Time: time.Now()}
+	for _, n := range notifiers {
+		n.Notify(alert)
+	}
+}
+
+// recordNACKForAlerting feeds the NACK storm detector.
+func recordNACKForAlerting(message string) {
+	now := time.Now()
+	alertMutex.Lock()
+	keep := nackTimes[:0]
+	for _, t := range nackTimes {
+		if now.Sub(t) < alertWindow {
+			keep = append(keep, t)
+		}
+	}
+	nackTimes = append(keep, now)
+	count := len(nackTimes)
+	alertMutex.Unlock()
+
+	if count >= nackStormThreshold {
+		RaiseAlert(AlertNACKStorm, "proxies are rejecting pushed config",
+			map[string]string{"nacksLastMinute": strconv.Itoa(count), "lastError": message})
+	}
+}
+
+// checkPushSLO raises an alert when a full push exceeded the configured SLO.
+func checkPushSLO(duration time.Duration) {
+	if pushSLO == 0 || duration <= pushSLO {
+		return
+	}
+	RaiseAlert(AlertPushSLOBreach, "full push exceeded latency SLO",
+		map[string]string{"duration": duration.String(), "slo": pushSLO.String()})
+}
+
+// webhookNotifier POSTs alerts to a URL. With a template file the body is
+// the rendered template, otherwise the Alert as JSON.
+type webhookNotifier struct {
+	url  string
+	tmpl *template.Template
+
+	alerts chan Alert
+}
+
+func newWebhookNotifier(url, templatePath string) *webhookNotifier {
+	n := &webhookNotifier{url: url, alerts: make(chan Alert, 10)}
+	if templatePath != "" {
+		tmpl, err := template.ParseFiles(templatePath)
+		if err != nil {
+			adsLog.Errorf("Alert template %s unusable, falling back to JSON: %v", templatePath, err)
+		} else {
+			n.tmpl = tmpl
+		}
+	}
+	go n.run()
+	return n
+}
+
+func (n *webhookNotifier) Notify(alert Alert) {
+	select {
+	case n.alerts <- alert:
+	default:
+		adsLog.Warnf("Alert webhook backlogged, dropping %s", alert.Condition)
+	}
+}
+
+func (n *webhookNotifier) run() {
+	for alert := range n.alerts {
+		body := &bytes.Buffer{}
+		contentType := "application/json"
+		if n.tmpl != nil {
+			if err := n.tmpl.Execute(body, alert); err != nil {
+				adsLog.Warnf("Alert template: %v", err)
+				continue
+			}
+			contentType = "text/plain"
+		} else if err := json.NewEncoder(body).Encode(alert); err != nil {
+			continue
+		}
+		resp, err := http.Post(n.url, contentType, body)
+		if err != nil {
+			adsLog.Warnf("Alert webhook %s: %v", n.url, err)
+			continue
+		}
+		_ = resp.Body.Close()
+	}
+}
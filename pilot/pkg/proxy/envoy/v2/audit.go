@@ -0,0 +1,107 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// A bug in addEdsCon/removeEdsCon bookkeeping would leave edsClusters
+// entries that Pilot keeps recomputing on every push although no connection
+// subscribes to them anymore. The audit periodically cross-checks every
+// cluster's watcher list against the live connection table, drops leaked
+// watches and hands orphaned clusters to the regular idle GC.
+
+// subscriptionAuditInterval is how often the watcher lists are audited.
+const subscriptionAuditInterval = 5 * time.Minute
+
+var subscriptionAudit = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "pilot_eds_subscription_audit",
+	Help: "Subscription-tracking fixes applied by the periodic audit, by kind (leaked_watch, reclaimed_cluster).",
+}, []string{"kind"})
+
+func init() {
+	prometheus.MustRegister(subscriptionAudit)
+}
+
+// periodicSubscriptionAudit runs the audit for the lifetime of the server.
+func (s *DiscoveryServer) periodicSubscriptionAudit() {
+	ticker := time.NewTicker(subscriptionAuditInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.auditSubscriptions()
+	}
+}
+
+// auditSubscriptions removes watches owned by closed connections and marks
+// clusters without any watcher for idle GC.
+func (s *DiscoveryServer) auditSubscriptions() {
+	adsClientsMutex.RLock()
+	live := make(map[string]*XdsConnection, len(adsClients))
+	for conID, con := range adsClients {
+		live[conID] = con
+	}
+	adsClientsMutex.RUnlock()
+
+	edsClusterMutex.RLock()
+	cMap := make(map[string]*EdsCluster, len(edsClusters))
+	for k, v := range edsClusters {
+		cMap[k] = v
+	}
+	edsClusterMutex.RUnlock()
+
+	for clusterName, c := range cMap {
+		c.mutex.Lock()
+		for conID, con := range c.EdsClients {
+			if live[conID] == con {
+				continue
+			}
+			// The stream is gone but the watch survived - the leak this
+			// audit exists for.
+			delete(c.EdsClients, conID)
+			subscriptionAudit.With(prometheus.Labels{"kind": "leaked_watch"}).Add(1)
+			adsLog.Warnf("EDS: audit removed leaked watch %s on %s", conID, clusterName)
+		}
+		unwatched := len(c.EdsClients) == 0
+		c.mutex.Unlock()
+		if unwatched {
+			reclaimUnwatchedCluster(clusterName, c)
+		}
+	}
+}
+
+// reclaimUnwatchedCluster routes an orphaned cluster through the same idle
+// GC a clean disconnect would have used. The window where a new watcher
+// appears between the check and the mark is the same one the regular idle
+// GC accepts - getOrAddEdsCluster clears the idle mark again.
+func reclaimUnwatchedCluster(clusterName string, c *EdsCluster) {
+	edsClusterMutex.Lock()
+	defer edsClusterMutex.Unlock()
+	if edsClusters[clusterName] != c || !c.idleSince.IsZero() {
+		return
+	}
+	subscriptionAudit.With(prometheus.Labels{"kind": "reclaimed_cluster"}).Add(1)
+	if edsIdleTimeout == 0 {
+		adsLog.Warnf("EDS: audit removed unwatched cluster %s", clusterName)
+		delete(edsClusters, clusterName)
+		return
+	}
+	adsLog.Warnf("EDS: audit marked unwatched cluster %s idle, GC in %v", clusterName, edsIdleTimeout)
+	c.idleSince = time.Now()
+	time.AfterFunc(edsIdleTimeout, func() { evictIdleCluster(clusterName) })
+	evictIdleOverflowLocked()
+}
@@ -0,0 +1,105 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// A brand-new service is only routable once a proxy holds both its Cluster
+// and its ClusterLoadAssignment. The full push already sends CDS and EDS
+// back-to-back on the ADS stream; the bundle tracker ties the two sends
+// together per connection, so a service that went routable in one round is
+// distinguishable from one stuck between a delivered cluster and a missing
+// assignment.
+
+var (
+	serviceBundles = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pilot_xds_new_service_bundles",
+		Help: "CDS+EDS bundles for new services, by outcome.",
+	}, []string{"result"})
+
+	// bundleGap is the window during which a proxy knows the new cluster but
+	// has no endpoints for it.
+	bundleGap = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "pilot_xds_bundle_gap_seconds",
+		Help:    "Time between the CDS and EDS sends of a new service bundle.",
+		Buckets: []float64{.001, .01, .1, .5, 1, 5, 30},
+	})
+)
+
+func init() {
+	prometheus.MustRegister(serviceBundles)
+	prometheus.MustRegister(bundleGap)
+}
+
+// takeNewServicesForPush drains the services queued for bundle tracking by
+// the most recent doPush.
+func (s *DiscoveryServer) takeNewServicesForPush() []string {
+	s.mutex.Lock()
+	out := s.newServicesForPush
+	s.newServicesForPush = nil
+	s.mutex.Unlock()
+	return out
+}
+
+// bundleTracker follows one connection's CDS+EDS pair for a set of new
+// services through a full push.
+type bundleTracker struct {
+	services []string
+	cdsAt    time.Time
+}
+
+// newServiceBundle returns a tracker, or nil when the push covers no new
+// services - the nil receiver keeps the push path free of bundle checks.
+func newServiceBundle(services []string) *bundleTracker {
+	if len(services) == 0 {
+		return nil
+	}
+	return &bundleTracker{services: services}
+}
+
+func (b *bundleTracker) cdsPushed() {
+	if b == nil {
+		return
+	}
+	b.cdsAt = time.Now()
+}
+
+func (b *bundleTracker) edsPushed(conID string) {
+	if b == nil {
+		return
+	}
+	if b.cdsAt.IsZero() {
+		// EDS-only stream (no CDS watch); nothing to coordinate.
+		return
+	}
+	gap := time.Since(b.cdsAt)
+	bundleGap.Observe(gap.Seconds())
+	serviceBundles.With(prometheus.Labels{"result": "complete"}).Add(1)
+	adsLog.Infof("ADS: new service bundle (%d services) complete for %s, CDS-EDS gap %v",
+		len(b.services), conID, gap)
+}
+
+// broken records a bundle whose second half never made it - the proxy may be
+// left with a cluster that has no endpoints.
+func (b *bundleTracker) broken(stage string) {
+	if b == nil {
+		return
+	}
+	serviceBundles.With(prometheus.Labels{"result": "broken_" + stage}).Add(1)
+}
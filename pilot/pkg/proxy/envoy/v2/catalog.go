@@ -0,0 +1,184 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The service catalog is a read-only view of what Pilot knows about the mesh
+// - hostnames, ports, service accounts and networks - aggregated across all
+// registries. It is meant for portals and CLI tooling that today scrape
+// registries directly and drift from what Pilot actually pushes. The catalog
+// is served from the same PushContext the proxies are configured from, so it
+// can never disagree with the pushed config. Clients poll /debug/catalogz,
+// or pass ?watch=<version> to block until the catalog changes.
+
+// catalogWatchTimeout bounds how long a ?watch request blocks before the
+// current catalog is returned unchanged.
+const catalogWatchTimeout = 30 * time.Second
+
+// CatalogPort describes one service port in the catalog.
+type CatalogPort struct {
+	Name     string `json:"name"`
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"`
+}
+
+// CatalogService is one aggregated service in the catalog.
+type CatalogService struct {
+	Hostname        string         `json:"hostname"`
+	Address         string         `json:"address,omitempty"`
+	Ports           []*CatalogPort `json:"ports"`
+	ServiceAccounts []string       `json:"serviceAccounts,omitempty"`
+	Networks        []string       `json:"networks,omitempty"`
+	MeshExternal    bool           `json:"meshExternal,omitempty"`
+}
+
+// CatalogSnapshot is the catalog at one config version.
+type CatalogSnapshot struct {
+	Version     string            `json:"version"`
+	GeneratedAt time.Time         `json:"generatedAt"`
+	Services    []*CatalogService `json:"services"`
+}
+
+var (
+	// catalogWatchers holds blocked ?watch requests; each gets a signal when
+	// a full push installs a new PushContext.
+	catalogWatchersMutex sync.Mutex
+	catalogWatchers      = map[int]chan struct{}{}
+	catalogWatcherID     int
+)
+
+// serviceCatalog builds the catalog from the current PushContext, filling in
+// service accounts and networks from the endpoint shards.
+func (s *DiscoveryServer) serviceCatalog() *CatalogSnapshot {
+	push := s.globalPushContext()
+	out := &CatalogSnapshot{
+		Version:     versionInfo(),
+		GeneratedAt: time.Now(),
+		Services:    []*CatalogService{},
+	}
+	if push == nil {
+		return out
+	}
+	for _, svc := range push.Services {
+		cs := &CatalogService{
+			Hostname:     string(svc.Hostname),
+			Address:      svc.Address,
+			Ports:        []*CatalogPort{},
+			MeshExternal: svc.MeshExternal,
+		}
+		for _, port := range svc.Ports {
+			cs.Ports = append(cs.Ports, &CatalogPort{
+				Name:     port.Name,
+				Port:     port.Port,
+				Protocol: string(port.Protocol),
+			})
+		}
+
+		accounts := map[string]bool{}
+		if push.ServiceAccounts != nil {
+			for _, sa := range push.ServiceAccounts(string(svc.Hostname)) {
+				accounts[sa] = true
+			}
+		}
+		networks := map[string]bool{}
+		s.mutex.RLock()
+		ep := s.EndpointShardsByService[string(svc.Hostname)]
+		s.mutex.RUnlock()
+		if ep != nil {
+			ep.mutex.RLock()
+			for sa := range ep.ServiceAccounts {
+				accounts[sa] = true
+			}
+			ep.mutex.RUnlock()
+			shards, _ := ep.snapshot()
+			for _, shard := range shards {
+				for _, e := range shard.Entries {
+					if e.Network != "" {
+						networks[e.Network] = true
+					}
+				}
+			}
+		}
+		cs.ServiceAccounts = sortedKeys(accounts)
+		cs.Networks = sortedKeys(networks)
+		out.Services = append(out.Services, cs)
+	}
+	sort.Slice(out.Services, func(i, j int) bool { return out.Services[i].Hostname < out.Services[j].Hostname })
+	return out
+}
+
+func sortedKeys(set map[string]bool) []string {
+	if len(set) == 0 {
+		return nil
+	}
+	out := make([]string, 0, len(set))
+	for k := range set {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// notifyCatalogWatchers wakes up every blocked catalog watch. Called when a
+// full push installs a new PushContext.
+func notifyCatalogWatchers() {
+	catalogWatchersMutex.Lock()
+	for _, ch := range catalogWatchers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+	catalogWatchersMutex.Unlock()
+}
+
+// catalogz serves the aggregated service catalog. With ?watch=<version> the
+// request blocks until the config version moves past the given one, or the
+// watch timeout expires.
+func (s *DiscoveryServer) catalogz(w http.ResponseWriter, req *http.Request) {
+	if watch := req.URL.Query().Get("watch"); watch != "" && watch == versionInfo() {
+		ch := make(chan struct{}, 1)
+		catalogWatchersMutex.Lock()
+		catalogWatcherID++
+		id := catalogWatcherID
+		catalogWatchers[id] = ch
+		catalogWatchersMutex.Unlock()
+
+		t := time.NewTimer(catalogWatchTimeout)
+		select {
+		case <-ch:
+		case <-t.C:
+		}
+		t.Stop()
+		catalogWatchersMutex.Lock()
+		delete(catalogWatchers, id)
+		catalogWatchersMutex.Unlock()
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	b, err := json.MarshalIndent(s.serviceCatalog(), " ", " ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	_, _ = w.Write(b)
+}
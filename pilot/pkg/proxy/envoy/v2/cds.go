@@ -55,6 +55,8 @@ func (s *DiscoveryServer) pushCds(con *XdsConnection, push *model.PushContext, v
 	if s.DebugConfigs {
 		con.CDSClusters = rawClusters
 	}
+	// Push-time plugins may replace or veto individual clusters for this proxy.
+	rawClusters = s.applyCdsPushPlugins(con, rawClusters)
 	response := con.clusters(rawClusters)
 	err = con.send(response)
 	if err != nil {
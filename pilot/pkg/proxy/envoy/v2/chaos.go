@@ -0,0 +1,132 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"math/rand"
+	"path"
+	"time"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"istio.io/istio/pkg/features/pilot"
+)
+
+// Test-only fault injection on the xDS send path, enabled by PILOT_CHAOS.
+// Selected connections get pushes delayed, dropped (the proxy never sees
+// them, Pilot believes they were sent) or swapped with the following push,
+// so resilience of proxies and apps to a misbehaving control plane can be
+// validated without patching Pilot.
+
+// ChaosSpec is the JSON value of PILOT_CHAOS.
+type ChaosSpec struct {
+	// Match is a path.Match glob applied to the connection ID; empty
+	// matches every connection.
+	Match string `json:"match,omitempty"`
+	// Delay is how long a delayed push is held, e.g. "200ms".
+	Delay string `json:"delay,omitempty"`
+	// DelayRate, DropRate and ReorderRate are per-push probabilities in
+	// [0,1], evaluated in that order.
+	DelayRate   float64 `json:"delayRate,omitempty"`
+	DropRate    float64 `json:"dropRate,omitempty"`
+	ReorderRate float64 `json:"reorderRate,omitempty"`
+}
+
+type chaosAction int
+
+const (
+	chaosNone chaosAction = iota
+	chaosDelay
+	chaosDrop
+	chaosReorder
+)
+
+var (
+	chaosSpec          *ChaosSpec
+	chaosDelayDuration time.Duration
+
+	chaosInjections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pilot_chaos_injections",
+		Help: "Faults injected into the xDS send path, by action.",
+	}, []string{"action"})
+)
+
+func init() {
+	prometheus.MustRegister(chaosInjections)
+	if pilot.Chaos == "" {
+		return
+	}
+	spec := &ChaosSpec{}
+	if err := json.Unmarshal([]byte(pilot.Chaos), spec); err != nil {
+		adsLog.Errorf("Invalid PILOT_CHAOS %q: %v - chaos disabled", pilot.Chaos, err)
+		return
+	}
+	if spec.Delay != "" {
+		d, err := time.ParseDuration(spec.Delay)
+		if err != nil {
+			adsLog.Errorf("Invalid PILOT_CHAOS delay %q: %v - chaos disabled", spec.Delay, err)
+			return
+		}
+		chaosDelayDuration = d
+	}
+	chaosSpec = spec
+	adsLog.Warnf("PILOT_CHAOS is set: pushes matching %q may be delayed, dropped or reordered. "+
+		"This is a test-only mode and must never be enabled in production.", spec.Match)
+}
+
+// pickChaosAction decides what, if anything, to do to the next push on the
+// connection.
+func pickChaosAction(conn *XdsConnection) chaosAction {
+	if chaosSpec == nil {
+		return chaosNone
+	}
+	if chaosSpec.Match != "" {
+		if ok, _ := path.Match(chaosSpec.Match, conn.ConID); !ok {
+			return chaosNone
+		}
+	}
+	r := rand.Float64() // not crypto - this is fault injection
+	if r < chaosSpec.DelayRate && chaosDelayDuration > 0 {
+		return chaosDelay
+	}
+	r -= chaosSpec.DelayRate
+	if r < chaosSpec.DropRate {
+		return chaosDrop
+	}
+	r -= chaosSpec.DropRate
+	if r < chaosSpec.ReorderRate {
+		return chaosReorder
+	}
+	return chaosNone
+}
+
+// swapChaosHeld stores res as the held push and returns the previously held
+// one, nil on the first swap. A held push stays queued until the next send
+// on the connection - if no further push happens it is never delivered,
+// which is an accepted behavior of chaos mode.
+func (conn *XdsConnection) swapChaosHeld(res *xdsapi.DiscoveryResponse) *xdsapi.DiscoveryResponse {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	prev := conn.chaosHeld
+	conn.chaosHeld = res
+	return prev
+}
+
+func recordChaos(action string, conn *XdsConnection, res *xdsapi.DiscoveryResponse) {
+	chaosInjections.With(prometheus.Labels{"action": action}).Add(1)
+	adsLog.Warnf("Chaos: %s %s push for %s", action, res.TypeUrl, conn.ConID)
+}
@@ -0,0 +1,110 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"fmt"
+	"hash/crc32"
+	"strings"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Intermediaries on the Pilot-proxy path (LBs, TCP proxies) have truncated
+// or corrupted responses in ways gRPC did not catch. Every response's
+// resource payload is checksummed and remembered by nonce; proxies
+// deployed with the echo extension report the checksum of what they
+// received in node metadata ("<nonce>:<checksum>") on their next request,
+// and a mismatch is flagged. Proxies without the extension are unaffected.
+
+// checksumMetadataKey is the node metadata key carrying the echoed checksum.
+const checksumMetadataKey = "XDS_CHECKSUM"
+
+// checksumHistory is how many sent checksums are kept per connection -
+// enough to cover one in-flight response per xDS type.
+const checksumHistory = 8
+
+type sentChecksum struct {
+	nonce    string
+	checksum string
+}
+
+var xdsChecksumMismatches = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "pilot_xds_checksum_mismatches",
+	Help: "Responses whose proxy-echoed payload checksum did not match what was sent.",
+})
+
+func init() {
+	prometheus.MustRegister(xdsChecksumMismatches)
+}
+
+// responseChecksum hashes the resource payloads of a response. CRC32 is
+// enough - this detects accidental corruption, not tampering.
+func responseChecksum(res *xdsapi.DiscoveryResponse) string {
+	h := crc32.NewIEEE()
+	for _, r := range res.Resources {
+		_, _ = h.Write(r.Value)
+	}
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+// recordChecksumLocked remembers the checksum of a sent response, keyed by
+// its nonce. Caller holds conn.mu.
+func (conn *XdsConnection) recordChecksumLocked(nonce, checksum string) {
+	conn.checksumsSent = append(conn.checksumsSent, sentChecksum{nonce: nonce, checksum: checksum})
+	if len(conn.checksumsSent) > checksumHistory {
+		conn.checksumsSent = conn.checksumsSent[len(conn.checksumsSent)-checksumHistory:]
+	}
+}
+
+// verifyChecksumEcho compares an echoed checksum against the recorded one.
+// Envoy only attaches node metadata to the first request of a stream, so
+// verification happens when the echo is present - every request for proxies
+// that resend the node.
+func (s *DiscoveryServer) verifyChecksumEcho(con *XdsConnection, req *xdsapi.DiscoveryRequest) {
+	if req.Node == nil || req.Node.Metadata == nil {
+		return
+	}
+	echoField, f := req.Node.Metadata.Fields[checksumMetadataKey]
+	if !f {
+		return
+	}
+	echo := echoField.GetStringValue()
+	sep := strings.Index(echo, ":")
+	if sep <= 0 {
+		return
+	}
+	nonce, got := echo[:sep], echo[sep+1:]
+
+	con.mu.RLock()
+	want := ""
+	for _, cs := range con.checksumsSent {
+		if cs.nonce == nonce {
+			want = cs.checksum
+			break
+		}
+	}
+	con.mu.RUnlock()
+	if want == "" {
+		// Nonce aged out of the history or belongs to a previous stream.
+		return
+	}
+	if got != want {
+		xdsChecksumMismatches.Add(1)
+		adsLog.Warnf("XDS: checksum mismatch for %s nonce %s: sent %s, proxy received %s - "+
+			"possible corruption between Pilot and proxy", con.ConID, nonce, want, got)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Capacity planning needs to answer "which services drive our control plane
+// load" from Prometheus, not from log analysis. The per-service series here
+// carry that: endpoint churn rates per service, the size distribution of
+// shard deltas, and how many EDS bytes each service's assignments put on the
+// wire. The service label makes these higher-cardinality than the aggregate
+// counters; that is the point, and mesh size bounds the cardinality.
+
+var (
+	serviceEndpointChurn = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pilot_eds_service_endpoint_churn",
+		Help: "Endpoints added, removed or modified per service.",
+	}, []string{"service", "change"})
+
+	serviceChurnSize = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "pilot_eds_shard_churn_size",
+		Help:    "Endpoints changed per shard update, over all services.",
+		Buckets: prometheus.ExponentialBuckets(1, 4, 8),
+	})
+
+	serviceEdsPushBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pilot_eds_service_push_bytes",
+		Help: "Marshaled EDS bytes pushed per service, over all connections.",
+	}, []string{"service"})
+)
+
+func init() {
+	prometheus.MustRegister(serviceEndpointChurn)
+	prometheus.MustRegister(serviceChurnSize)
+	prometheus.MustRegister(serviceEdsPushBytes)
+}
+
+// recordServiceChurn accounts one shard update's delta to its service.
+func recordServiceChurn(serviceName string, added, removed, modified int) {
+	if added > 0 {
+		serviceEndpointChurn.With(prometheus.Labels{"service": serviceName, "change": "added"}).Add(float64(added))
+	}
+	if removed > 0 {
+		serviceEndpointChurn.With(prometheus.Labels{"service": serviceName, "change": "removed"}).Add(float64(removed))
+	}
+	if modified > 0 {
+		serviceEndpointChurn.With(prometheus.Labels{"service": serviceName, "change": "modified"}).Add(float64(modified))
+	}
+	serviceChurnSize.Observe(float64(added + removed + modified))
+}
+
+// recordServicePushBytes accounts one marshaled assignment to its service.
+func recordServicePushBytes(serviceName string, bytes int) {
+	serviceEdsPushBytes.With(prometheus.Labels{"service": serviceName}).Add(float64(bytes))
+}
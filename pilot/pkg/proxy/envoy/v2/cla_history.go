@@ -0,0 +1,142 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/gogo/protobuf/jsonpb"
+
+	"istio.io/istio/pkg/features/pilot"
+)
+
+// During incident review the question is usually "what did Pilot believe the
+// endpoints of svc X were at 14:32", and once the incident is over that is
+// unanswerable. With PILOT_CLA_HISTORY=N the last N computed assignments per
+// cluster are retained with timestamps and can be queried by time through
+// /debug/history. The ring stores the assignment pointers the push path
+// replaces wholesale, so history costs no extra copies.
+
+// claHistoryDepth is the per-cluster ring size, 0 disables history.
+var claHistoryDepth int
+
+func init() {
+	claHistoryDepth = intEnv(pilot.ClaHistory, 0)
+}
+
+// claSnapshot is one historical assignment.
+type claSnapshot struct {
+	Time       time.Time
+	Assignment *xdsapi.ClusterLoadAssignment
+}
+
+var (
+	claHistoryMutex sync.RWMutex
+	claHistory      = map[string][]claSnapshot{}
+)
+
+// recordClaSnapshot appends a computed assignment to the cluster's ring.
+func recordClaSnapshot(clusterName string, cla *xdsapi.ClusterLoadAssignment) {
+	if claHistoryDepth <= 0 {
+		return
+	}
+	claHistoryMutex.Lock()
+	ring := append(claHistory[clusterName], claSnapshot{Time: time.Now(), Assignment: cla})
+	if len(ring) > claHistoryDepth {
+		ring = ring[len(ring)-claHistoryDepth:]
+	}
+	claHistory[clusterName] = ring
+	claHistoryMutex.Unlock()
+}
+
+// claAt returns the assignment a cluster had at a given time: the newest
+// snapshot not younger than t. Nil when history does not reach back that far.
+func claAt(clusterName string, t time.Time) *claSnapshot {
+	claHistoryMutex.RLock()
+	defer claHistoryMutex.RUnlock()
+	ring := claHistory[clusterName]
+	for i := len(ring) - 1; i >= 0; i-- {
+		if !ring[i].Time.After(t) {
+			snap := ring[i]
+			return &snap
+		}
+	}
+	return nil
+}
+
+// historyz answers /debug/history. Without parameters it lists the retained
+// snapshot times per cluster; with ?cluster= and optionally ?t= (RFC3339) it
+// returns the assignment in effect at that time (default: now).
+func (s *DiscoveryServer) historyz(w http.ResponseWriter, req *http.Request) {
+	_ = req.ParseForm()
+	w.Header().Add("Content-Type", "application/json")
+	if claHistoryDepth <= 0 {
+		w.WriteHeader(http.StatusNotImplemented)
+		fmt.Fprintln(w, "{\"error\": \"set PILOT_CLA_HISTORY to enable assignment history\"}")
+		return
+	}
+
+	clusterName := req.Form.Get("cluster")
+	if clusterName == "" {
+		claHistoryMutex.RLock()
+		fmt.Fprintln(w, "{")
+		first := true
+		for name, ring := range claHistory {
+			if !first {
+				fmt.Fprintln(w, ",")
+			}
+			first = false
+			fmt.Fprintf(w, " %q: [", name)
+			for i, snap := range ring {
+				if i > 0 {
+					fmt.Fprint(w, ", ")
+				}
+				fmt.Fprintf(w, "%q", snap.Time.Format(time.RFC3339))
+			}
+			fmt.Fprint(w, "]")
+		}
+		fmt.Fprintln(w, "\n}")
+		claHistoryMutex.RUnlock()
+		return
+	}
+
+	at := time.Now()
+	if ts := req.Form.Get("t"); ts != "" {
+		t, err := time.Parse(time.RFC3339, ts)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "{\"error\": \"t must be RFC3339: %v\"}\n", err)
+			return
+		}
+		at = t
+	}
+
+	snap := claAt(clusterName, at)
+	if snap == nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "{\"error\": \"no snapshot of %s at or before %s\"}\n", clusterName, at.Format(time.RFC3339))
+		return
+	}
+	fmt.Fprintf(w, "{\"cluster\": %q, \"time\": %q, \"assignment\": ", clusterName, snap.Time.Format(time.RFC3339))
+	jsonm := &jsonpb.Marshaler{Indent: " "}
+	if err := jsonm.Marshal(w, snap.Assignment); err != nil {
+		fmt.Fprint(w, "null")
+	}
+	fmt.Fprintln(w, "}")
+}
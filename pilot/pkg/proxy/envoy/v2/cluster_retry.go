@@ -0,0 +1,111 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+// Failed updateCluster computations (usually transient registry errors) used
+// to leave the cluster with a nil or stale assignment until the next
+// unrelated push. A bounded per-cluster retry with backoff makes these
+// self-heal, and the error state is visible in /debug/edsz.
+
+const (
+	// clusterRetryBase is the backoff before the first retry; it doubles on
+	// each subsequent failure.
+	clusterRetryBase = 1 * time.Second
+
+	// clusterRetryMax bounds the number of retries for one failure episode.
+	// After that we wait for the next regular push to recompute.
+	clusterRetryMax = 5
+)
+
+var edsRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "pilot_eds_cluster_retries",
+	Help: "Retries of failed EDS cluster computations, by result.",
+}, []string{"result"})
+
+func init() {
+	prometheus.MustRegister(edsRetries)
+}
+
+// recordClusterFailure marks the error state on the cluster and schedules a
+// retry unless one is already pending or the retry budget is exhausted.
+func (s *DiscoveryServer) recordClusterFailure(clusterName string, c *EdsCluster, err error) {
+	c.mutex.Lock()
+	c.UpdateFailure = err.Error()
+	c.FailedAttempts++
+	attempts := c.FailedAttempts
+	pending := c.retryPending
+	if attempts <= clusterRetryMax {
+		c.retryPending = true
+	}
+	c.mutex.Unlock()
+
+	if pending || attempts > clusterRetryMax {
+		return
+	}
+
+	backoff := clusterRetryBase << uint(attempts-1)
+	adsLog.Infof("EDS: retrying cluster %s in %v after failure: %v", clusterName, backoff, err)
+	time.AfterFunc(backoff, func() { s.retryCluster(clusterName) })
+}
+
+// recordClusterSuccess clears the error state after a successful computation.
+func recordClusterSuccess(c *EdsCluster) {
+	c.mutex.Lock()
+	c.UpdateFailure = ""
+	c.FailedAttempts = 0
+	c.mutex.Unlock()
+}
+
+// retryCluster recomputes a previously failed cluster. On success the
+// watchers get an incremental push; on failure another retry is scheduled,
+// up to the budget.
+func (s *DiscoveryServer) retryCluster(clusterName string) {
+	c := s.getEdsCluster(clusterName)
+	if c == nil {
+		// GCed while waiting - nothing to recompute.
+		return
+	}
+	c.mutex.Lock()
+	c.retryPending = false
+	c.mutex.Unlock()
+
+	push := s.Env.PushContext
+	if err := s.updateCluster(push, clusterName, c); err != nil {
+		edsRetries.With(prometheus.Labels{"result": "failure"}).Add(1)
+		s.recordClusterFailure(clusterName, c, err)
+		return
+	}
+	edsRetries.With(prometheus.Labels{"result": "success"}).Add(1)
+	recordClusterSuccess(c)
+	adsLog.Infof("EDS: cluster %s recovered after retry", clusterName)
+
+	// Let the watchers pick up the recovered assignment through the regular
+	// incremental push path.
+	_, _, hostname, _ := model.ParseSubsetKey(clusterName)
+	s.mutex.Lock()
+	if ep, f := s.EndpointShardsByService[string(hostname)]; f {
+		s.edsUpdates[string(hostname)] = ep
+	}
+	s.mutex.Unlock()
+	s.ConfigUpdate(false)
+}
@@ -0,0 +1,122 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Reconnect storms and flapping proxies are usually investigated after the
+// fact, when the log lines have rotated away. The connection event history
+// keeps the last connectionEventHistory connect/disconnect events - with the
+// reason the connection ended - in memory, served on
+// /debug/connection_events.
+
+// connectionEventHistory bounds the in-memory event ring.
+const connectionEventHistory = 512
+
+// Reasons recorded for disconnect events.
+const (
+	reasonClientClosed = "client_closed"
+	reasonReceiveError = "receive_error"
+	reasonSendTimeout  = "send_timeout"
+	reasonWriteError   = "write_error"
+	reasonError        = "error"
+)
+
+// ConnectionEvent is one connect or disconnect, as served on
+// /debug/connection_events.
+type ConnectionEvent struct {
+	Time    time.Time `json:"time"`
+	ProxyID string    `json:"proxy"`
+	Peer    string    `json:"peer"`
+	Event   string    `json:"event"`
+	Reason  string    `json:"reason,omitempty"`
+	// Seconds the connection was up, for disconnect events.
+	Duration float64 `json:"duration,omitempty"`
+}
+
+var (
+	// connEventsMutex guards the event ring.
+	connEventsMutex sync.Mutex
+	connEvents      = make([]*ConnectionEvent, 0, connectionEventHistory)
+	connEventsNext  int
+
+	connectionEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pilot_connection_events",
+		Help: "Proxy connect and disconnect events, by reason.",
+	}, []string{"event", "reason"})
+)
+
+func init() {
+	prometheus.MustRegister(connectionEvents)
+}
+
+// recordConnectionEvent appends an event to the ring, evicting the oldest
+// once the ring is full.
+func recordConnectionEvent(con *XdsConnection, event, reason string) {
+	ev := &ConnectionEvent{
+		Time:    time.Now(),
+		ProxyID: con.ConID,
+		Peer:    con.PeerAddr,
+		Event:   event,
+		Reason:  reason,
+	}
+	if event == "disconnect" {
+		ev.Duration = time.Since(con.Connect).Seconds()
+	}
+	connectionEvents.With(prometheus.Labels{"event": event, "reason": reason}).Add(1)
+
+	connEventsMutex.Lock()
+	if len(connEvents) < connectionEventHistory {
+		connEvents = append(connEvents, ev)
+	} else {
+		connEvents[connEventsNext] = ev
+		connEventsNext = (connEventsNext + 1) % connectionEventHistory
+	}
+	connEventsMutex.Unlock()
+}
+
+// markDisconnectReason records why the connection is going away. The first
+// reason wins - later bookkeeping must not overwrite the root cause.
+func (conn *XdsConnection) markDisconnectReason(reason string) {
+	conn.mu.Lock()
+	if conn.disconnectReason == "" {
+		conn.disconnectReason = reason
+	}
+	conn.mu.Unlock()
+}
+
+// connectionEventHistorySnapshot returns the ring in chronological order.
+func connectionEventHistorySnapshot() []*ConnectionEvent {
+	connEventsMutex.Lock()
+	defer connEventsMutex.Unlock()
+	out := make([]*ConnectionEvent, 0, len(connEvents))
+	out = append(out, connEvents[connEventsNext:]...)
+	out = append(out, connEvents[:connEventsNext]...)
+	return out
+}
+
+// connectionEventsz serves the connection event history, oldest first.
+func (s *DiscoveryServer) connectionEventsz(w http.ResponseWriter, req *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	b, _ := json.MarshalIndent(connectionEventHistorySnapshot(), " ", " ")
+	_, _ = w.Write(b)
+}
@@ -0,0 +1,55 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestConnectionEventRing(t *testing.T) {
+	connEventsMutex.Lock()
+	connEvents = make([]*ConnectionEvent, 0, connectionEventHistory)
+	connEventsNext = 0
+	connEventsMutex.Unlock()
+
+	for i := 0; i < connectionEventHistory+5; i++ {
+		con := &XdsConnection{ConID: fmt.Sprintf("proxy-%d", i), PeerAddr: "10.0.0.1:1234"}
+		recordConnectionEvent(con, "connect", "")
+	}
+
+	events := connectionEventHistorySnapshot()
+	if len(events) != connectionEventHistory {
+		t.Fatalf("history holds %d events, want %d", len(events), connectionEventHistory)
+	}
+	// The oldest 5 events were evicted; the ring starts at proxy-5 and stays
+	// in chronological order across the wrap point.
+	if events[0].ProxyID != "proxy-5" {
+		t.Errorf("oldest event is %s, want proxy-5", events[0].ProxyID)
+	}
+	last := fmt.Sprintf("proxy-%d", connectionEventHistory+4)
+	if events[len(events)-1].ProxyID != last {
+		t.Errorf("newest event is %s, want %s", events[len(events)-1].ProxyID, last)
+	}
+}
+
+func TestDisconnectReasonFirstWins(t *testing.T) {
+	con := &XdsConnection{ConID: "proxy.ns-1"}
+	con.markDisconnectReason(reasonSendTimeout)
+	con.markDisconnectReason(reasonReceiveError)
+	if con.disconnectReason != reasonSendTimeout {
+		t.Errorf("disconnectReason = %q, want %q", con.disconnectReason, reasonSendTimeout)
+	}
+}
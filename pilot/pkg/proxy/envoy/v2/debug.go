@@ -20,6 +20,8 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gogo/protobuf/jsonpb"
 
@@ -55,16 +57,42 @@ func (s *DiscoveryServer) InitDebug(mux *http.ServeMux, sctl *aggregate.Controll
 	mux.HandleFunc("/debug/adsz", s.adsz)
 	mux.HandleFunc("/debug/cdsz", cdsz)
 	mux.HandleFunc("/debug/syncz", Syncz)
+	mux.HandleFunc("/debug/streamz", s.streamsz)
+	mux.HandleFunc("/debug/tenantz", s.tenantz)
 
 	mux.HandleFunc("/debug/registryz", s.registryz)
 	mux.HandleFunc("/debug/endpointz", s.endpointz)
 	mux.HandleFunc("/debug/endpointShardz", s.endpointShardz)
+	mux.HandleFunc("/debug/inject", s.injectz)
+	mux.HandleFunc("/debug/drain", s.drainz)
+	mux.HandleFunc("/debug/vmhealth", s.vmhealthz)
+	mux.HandleFunc("/debug/standby", s.standbyz)
+	mux.HandleFunc("/debug/pushstatez", s.pushstatez)
+	mux.HandleFunc("/debug/catalogz", s.catalogz)
+	mux.HandleFunc("/debug/connection_events", s.connectionEventsz)
+	mux.HandleFunc("/debug/registry_removal", s.removalImpactz)
+	mux.HandleFunc("/debug/explain", s.explainz)
+	mux.HandleFunc("/debug/outlierz", s.outlierz)
+	mux.HandleFunc("/debug/ip2workload", s.ip2workload)
+	mux.HandleFunc("/debug/rolloutz", s.rolloutz)
 	mux.HandleFunc("/debug/workloadz", s.workloadz)
 	mux.HandleFunc("/debug/configz", s.configz)
+	mux.HandleFunc("/debug/throttlez", s.throttlez)
+	mux.HandleFunc("/debug/topologyz", s.topologyz)
+	mux.HandleFunc("/debug/ledgerz", s.ledgerz)
+	mux.HandleFunc("/debug/history", s.historyz)
+	mux.HandleFunc("/debug/identityz", s.identityz)
+	mux.HandleFunc("/debug/missingz", s.missingz)
+	mux.HandleFunc("/debug/export", s.exportz)
+	mux.HandleFunc("/debug/import", s.importz)
+	mux.HandleFunc("/debug/compare", s.comparez)
+
+	mux.HandleFunc("/debug/warmupz", s.warmupz)
 
 	mux.HandleFunc("/debug/authenticationz", s.authenticationz)
 	mux.HandleFunc("/debug/config_dump", s.ConfigDump)
 	mux.HandleFunc("/debug/push_status", s.PushStatusHandler)
+	mux.HandleFunc("/debug/push_impact", s.configImpact)
 }
 
 // SyncStatus is the synchronization status between Pilot and a given Envoy
@@ -232,21 +260,38 @@ func (s *DiscoveryServer) endpointz(w http.ResponseWriter, req *http.Request) {
 }
 
 // Config debugging.
+// configz dumps the config store. The output is streamed per config;
+// ?type= filters by config type, ?limit= bounds the number of configs and
+// gzip is used when the client accepts it.
 func (s *DiscoveryServer) configz(w http.ResponseWriter, req *http.Request) {
+	_ = req.ParseForm()
 	w.Header().Add("Content-Type", "application/json")
-	fmt.Fprintf(w, "\n[\n")
+	typeFilter := req.Form.Get("type")
+	limit := debugLimit(req)
+	out, finish := debugOutput(w, req)
+	defer finish()
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("  ", "  ")
+	written := 0
+	fmt.Fprintf(out, "\n[\n")
 	for _, typ := range s.Env.IstioConfigStore.ConfigDescriptor() {
+		if typeFilter != "" && typ.Type != typeFilter {
+			continue
+		}
 		cfg, _ := s.Env.IstioConfigStore.List(typ.Type, "")
 		for _, c := range cfg {
-			b, err := json.MarshalIndent(c, "  ", "  ")
-			if err != nil {
+			if limit > 0 && written >= limit {
+				break
+			}
+			written++
+			if err := enc.Encode(c); err != nil {
 				return
 			}
-			_, _ = w.Write(b)
-			fmt.Fprint(w, ",\n")
+			fmt.Fprint(out, ",\n")
 		}
 	}
-	fmt.Fprint(w, "\n{}]")
+	fmt.Fprint(out, "\n{}]")
 }
 
 type authProtocol int
@@ -469,6 +514,78 @@ func writeAllADS(w io.Writer) {
 	fmt.Fprint(w, "]\n")
 }
 
+// WarmupStatus reports how far the replica is from fully serving: registry
+// sync state, how much of the mesh has been loaded and how many proxies are
+// already connected and waiting for config.
+type WarmupStatus struct {
+	Uptime string `json:"uptime"`
+
+	// ConfigSynced is true once the config controller completed its initial sync.
+	ConfigSynced bool `json:"config_synced"`
+
+	// PushContextInitialized is true once the services were loaded in the push context.
+	PushContextInitialized bool `json:"push_context_initialized"`
+
+	// Services is the number of services in the current push context.
+	Services int `json:"services"`
+
+	// ServicesWithEndpoints and Endpoints report incremental registry progress.
+	ServicesWithEndpoints int `json:"services_with_endpoints"`
+	Endpoints             int `json:"endpoints"`
+
+	// PrecomputedClusters is the number of EDS clusters with a computed assignment.
+	PrecomputedClusters int `json:"precomputed_clusters"`
+
+	// Connections is the number of proxies connected (and possibly held) on this replica.
+	Connections int `json:"connections"`
+
+	Version string `json:"version"`
+}
+
+// warmupz reports startup/warm-up progress, so operators can see how long
+// until a new replica is fully serving. It is mapped to /debug/warmupz.
+func (s *DiscoveryServer) warmupz(w http.ResponseWriter, req *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	status := WarmupStatus{
+		Uptime:      time.Since(s.startTime).String(),
+		Connections: adsClientCount(),
+		Version:     versionInfo(),
+	}
+	if s.ConfigController != nil {
+		status.ConfigSynced = s.ConfigController.HasSynced()
+	}
+	push := s.globalPushContext()
+	if push != nil && push.Services != nil {
+		status.PushContextInitialized = true
+		status.Services = len(push.Services)
+	}
+	s.mutex.RLock()
+	status.ServicesWithEndpoints = len(s.EndpointShardsByService)
+	for _, ep := range s.EndpointShardsByService {
+		ep.mutex.RLock()
+		for _, shard := range ep.Shards {
+			status.Endpoints += len(shard.Entries)
+		}
+		ep.mutex.RUnlock()
+	}
+	s.mutex.RUnlock()
+	edsClusterMutex.RLock()
+	for _, c := range edsClusters {
+		if loadAssignment(c) != nil {
+			status.PrecomputedClusters++
+		}
+	}
+	edsClusterMutex.RUnlock()
+
+	out, err := json.MarshalIndent(&status, "", "  ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "unable to marshal warmup status: %v", err)
+		return
+	}
+	_, _ = w.Write(out)
+}
+
 func (s *DiscoveryServer) ready(w http.ResponseWriter, req *http.Request) {
 	if s.ConfigController != nil {
 		if !s.ConfigController.HasSynced() {
@@ -478,7 +595,9 @@ func (s *DiscoveryServer) ready(w http.ResponseWriter, req *http.Request) {
 	w.WriteHeader(200)
 }
 
-// edsz implements a status and debug interface for EDS.
+// edsz implements a status and debug interface for EDS. The output is
+// streamed per cluster; ?cluster= filters by substring, ?limit= bounds the
+// number of clusters and ?gzip=1 (or Accept-Encoding) compresses.
 // It is mapped to /debug/edsz on the monitor port (9093).
 func (s *DiscoveryServer) edsz(w http.ResponseWriter, req *http.Request) {
 	_ = req.ParseForm()
@@ -487,24 +606,49 @@ func (s *DiscoveryServer) edsz(w http.ResponseWriter, req *http.Request) {
 	if req.Form.Get("push") != "" {
 		AdsPushAll(s)
 	}
+	filter := req.Form.Get("cluster")
+	limit := debugLimit(req)
+	out, finish := debugOutput(w, req)
+	defer finish()
 
 	edsClusterMutex.RLock()
 	comma := false
+	written := 0
 	if len(edsClusters) > 0 {
-		fmt.Fprintln(w, "[")
-		for _, eds := range edsClusters {
+		fmt.Fprintln(out, "[")
+		for name, eds := range edsClusters {
+			if filter != "" && !strings.Contains(name, filter) {
+				continue
+			}
+			if limit > 0 && written >= limit {
+				break
+			}
+			written++
 			if comma {
-				fmt.Fprint(w, ",\n")
+				fmt.Fprint(out, ",\n")
 			} else {
 				comma = true
 			}
-			jsonm := &jsonpb.Marshaler{Indent: "  "}
-			dbgString, _ := jsonm.MarshalToString(eds.LoadAssignment)
-			if _, err := w.Write([]byte(dbgString)); err != nil {
-				return
+			// Time to first endpoint quantifies the cold-start gap between a
+			// proxy watching a cluster and discovery filling it in.
+			ttfe := ""
+			if !eds.NonEmptyTime.IsZero() {
+				ttfe = eds.NonEmptyTime.Sub(eds.FirstUse).String()
+			}
+			fmt.Fprintf(out, "{\"name\": %q, \"firstUse\": %q, \"nonEmptyTime\": %q, \"timeToFirstEndpoint\": %q, \"updateFailure\": %q, \"failedAttempts\": %d,\n\"loadAssignment\": ",
+				name, eds.FirstUse.Format(time.RFC3339Nano), eds.NonEmptyTime.Format(time.RFC3339Nano), ttfe, eds.UpdateFailure, eds.FailedAttempts)
+			if eds.LoadAssignment == nil {
+				fmt.Fprint(out, "null")
+			} else {
+				jsonm := &jsonpb.Marshaler{Indent: "  "}
+				if err := jsonm.Marshal(out, eds.LoadAssignment); err != nil {
+					edsClusterMutex.RUnlock()
+					return
+				}
 			}
+			fmt.Fprint(out, "}")
 		}
-		fmt.Fprintln(w, "]")
+		fmt.Fprintln(out, "]")
 	} else {
 		w.WriteHeader(404)
 	}
@@ -0,0 +1,51 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Debug dumps on a large mesh can be tens of megabytes; buffering them in
+// memory while a slow client reads can destabilize Pilot. The helpers here
+// let the dump handlers stream their output, compress it when the client
+// accepts gzip, and bound how much is produced.
+
+// debugOutput wraps the response writer with gzip when the client asks for
+// it (Accept-Encoding or ?gzip=1). The returned func must be called when the
+// handler is done writing.
+func debugOutput(w http.ResponseWriter, req *http.Request) (io.Writer, func()) {
+	_ = req.ParseForm()
+	if strings.Contains(req.Header.Get("Accept-Encoding"), "gzip") || req.Form.Get("gzip") == "1" {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		return gz, func() { _ = gz.Close() }
+	}
+	return w, func() {}
+}
+
+// debugLimit returns the ?limit= form value, or 0 for unlimited.
+func debugLimit(req *http.Request) int {
+	_ = req.ParseForm()
+	n, err := strconv.Atoi(req.Form.Get("limit"))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
@@ -21,9 +21,11 @@ import (
 
 	"github.com/envoyproxy/go-control-plane/envoy/api/v2/endpoint"
 	ads "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+	lrsgrpc "github.com/envoyproxy/go-control-plane/envoy/service/load_stats/v2"
 	"github.com/google/uuid"
 	"golang.org/x/time/rate"
 	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/networking/core"
@@ -90,6 +92,9 @@ func init() {
 
 	DebounceAfter = envDuration(pilot.DebounceAfter, 100*time.Millisecond)
 	DebounceMax = envDuration(pilot.DebounceMax, 10*time.Second)
+
+	edsIdleTimeout = envDuration(pilot.EdsIdleTimeout, 0)
+	edsMaxIdleClusters = intEnv(pilot.EdsMaxIdleClusters, 512)
 }
 
 func envDuration(envVal string, def time.Duration) time.Duration {
@@ -119,14 +124,48 @@ type DiscoveryServer struct {
 	// ConfigController provides readiness info (if initial sync is complete)
 	ConfigController model.ConfigStoreCache
 
-	// rate limiter for sending updates during full ads push.
+	// Tenant restricts this server instance to proxies declaring the same
+	// tenant in their node metadata (PILOT_TENANT). Empty serves everything.
+	// A hosted control plane runs one instance per tenant in the process.
+	Tenant string
+
+	// Revision identifies the control-plane build/rollout this instance
+	// belongs to (PILOT_REVISION). Proxies pinned to a different revision via
+	// node metadata are redirected, so canary Pilots keep a clean population.
+	Revision string
+
+	// rate limiter for sending updates during full ads push. Replaced on live
+	// adjustment, so access goes through limiter(). Guarded by throttleMutex.
 	rateLimiter *rate.Limiter
 
 	// rate limiter for sending config to new connections.
 	// We want to have a larger limit for new connections because until configuration is sent the proxies
-	// will not be ready.
+	// will not be ready. Guarded by throttleMutex, accessed through initLimiter().
 	initRateLimiter *rate.Limiter
 
+	// current push throttle settings, kept so /debug/throttlez can report and
+	// adjust them at runtime. Guarded by throttleMutex.
+	pushThrottle  int
+	pushBurst     int
+	throttleMutex sync.RWMutex
+
+	// shardStore is the optional external persistence backend for endpoint
+	// shards (PILOT_SHARD_STORE). Nil when shards are in-memory only.
+	shardStore ShardStore
+
+	// eventBus is the optional message bus endpoint events are exchanged
+	// with (PILOT_EVENT_BUS). Nil when no bus is configured.
+	eventBus EventBus
+
+	// pendingEndpoints buffers endpoint updates that arrived before their
+	// service definition, keyed by hostname then shard. Guarded by mutex and
+	// flushed by SvcUpdate.
+	pendingEndpoints map[string]map[string][]*model.IstioEndpoint
+
+	// pushLedger tracks per-proxy completion of full push generations,
+	// optionally persisted across restarts (PILOT_PUSH_LEDGER_FILE).
+	pushLedger *PushLedger
+
 	concurrentPushLimit chan struct{}
 
 	// DebugConfigs controls saving snapshots of configs for /debug/adsz.
@@ -160,6 +199,11 @@ type DiscoveryServer struct {
 	// true if a full push is needed after debounce. False if only EDS is required.
 	fullPush bool
 
+	// fullPushCauses collects why the pending full push was requested, so
+	// doPush can downgrade it to EDS-only when every cause is endpoint-only.
+	// Guarded by updateMutex.
+	fullPushCauses map[string]bool
+
 	// lastPushStart (former lastClearCache) is the time we last started a push
 	lastPushStart time.Time
 
@@ -173,13 +217,46 @@ type DiscoveryServer struct {
 	// waiting for more events, to debounce.
 	debouncePushTimerSet bool
 
+	// eventIntervalEWMA smooths the interval between config events, driving
+	// the adaptive debounce window. Guarded by updateMutex.
+	eventIntervalEWMA time.Duration
+
+	// newServiceBatch collects services first seen since the last push, so
+	// a namespace onboarding burst is reported - and pushed - as one batch
+	// instead of one full push per service. Guarded by mutex.
+	newServiceBatch map[string]bool
+
+	// newServicesForPush carries the drained batch into the next full push,
+	// where the CDS+EDS pair for each connection is tracked as one bundle.
+	// Guarded by mutex.
+	newServicesForPush []string
+
 	// endpointsFilterFuncs is an ordered list of functions to apply to EDS just before pushing it
 	endpointsFilterFuncs []EndpointsFilterFunc
+
+	// pushPlugins is the ordered chain of plugins invoked per generated
+	// resource at push time, with the ability to mutate or veto it.
+	pushPlugins []PushPlugin
+
+	// pushScheduler decides the order connections are pushed in, selected
+	// by PILOT_PUSH_SCHEDULER.
+	pushScheduler PushScheduler
+
+	// startTime records when the server was created, to report warm-up progress.
+	startTime time.Time
+
+	// ipIndex is the reverse index from endpoint address to owning
+	// workloads, keyed by address then "service|shard". Guarded by mutex and
+	// maintained with the shards.
+	ipIndex map[string]map[string]IPWorkload
 }
 
 // updateReq includes info about the requested update.
 type updateReq struct {
 	full bool
+
+	// cause classifies the trigger, for the full push downgrade.
+	cause string
 }
 
 // EndpointShardsByService holds the set of endpoint shards of a service. Registries update
@@ -187,6 +264,16 @@ type updateReq struct {
 // clusters when a push for the specific cluster is needed.
 type EndpointShardsByService struct {
 
+	// mutex guards Shards and ServiceAccounts of this service only, so
+	// registry updates for distinct services do not serialize on the global
+	// server mutex. Lock order: s.mutex (when both are needed) before this
+	// one, never the reverse.
+	mutex sync.RWMutex
+
+	// epoch is incremented on every shard mutation, letting push
+	// computations detect that their snapshot went stale. Guarded by mutex.
+	epoch uint64
+
 	// Shards is used to track the shards. EDS updates are grouped by shard.
 	// Current implementation uses the registry name as key - in multicluster this is the
 	// name of the k8s cluster, derived from the config (secret).
@@ -206,6 +293,10 @@ type EndpointShardsByService struct {
 type EndpointShard struct {
 	Shard   string
 	Entries []*model.IstioEndpoint
+
+	// LastUpdate is the time the shard was last replaced by its registry,
+	// used to expire shards of push-only registries (PILOT_ENDPOINT_TTL).
+	LastUpdate time.Time
 }
 
 // Workload has the minimal info we need to detect if we need to push workloads, and to
@@ -216,6 +307,10 @@ type Workload struct {
 
 	// Annotations
 	Annotations map[string]string
+
+	// LastSeen is when the registry last refreshed this workload, used for
+	// cache expiry and eviction.
+	LastSeen time.Time
 }
 
 func intEnv(envVal string, def int) int {
@@ -242,10 +337,41 @@ func NewDiscoveryServer(env *model.Environment, generator core.ConfigGenerator,
 		endpointsFilterFuncs: []EndpointsFilterFunc{
 			EndpointsByNetworkFilter, // A filter to support Split Horizon EDS
 		},
+		startTime:       time.Now(),
+		Tenant:          pilot.Tenant,
+		Revision:        pilot.Revision,
+		ipIndex:         map[string]map[string]IPWorkload{},
+		newServiceBatch: map[string]bool{},
+		fullPushCauses:  map[string]bool{},
+	}
+	if residencyLabel != "" {
+		out.RegisterPushPlugin(&residencyPlugin{s: out})
+	}
+	if visibilityPolicy != nil {
+		out.RegisterPushPlugin(&visibilityPlugin{s: out})
 	}
+	if ipFamilyPolicy != nil {
+		out.RegisterPushPlugin(&ipFamilyPlugin{s: out})
+	}
+	out.pushLedger = newPushLedger(pilot.PushLedgerFile)
+	out.pushScheduler = newPushScheduler()
 	env.PushContext = model.NewPushContext()
 	go out.handleUpdates()
 
+	if store, err := openShardStore(); err != nil {
+		adsLog.Errorf("EDS: shard store disabled: %v", err)
+	} else if store != nil {
+		out.shardStore = store
+		out.restoreShards()
+	}
+
+	if bus, err := openEventBus(); err != nil {
+		adsLog.Errorf("EDS: event bus disabled: %v", err)
+	} else if bus != nil {
+		out.eventBus = bus
+		go out.consumeEndpointEvents()
+	}
+
 	// Flush cached discovery responses whenever services, service
 	// instances, or routing configuration changes.
 	serviceHandler := func(*model.Service, model.Event) { out.clearCache() }
@@ -273,12 +399,28 @@ func NewDiscoveryServer(env *model.Environment, generator core.ConfigGenerator,
 
 	go out.periodicRefreshMetrics()
 
+	if endpointTTL > 0 {
+		go out.periodicEndpointExpiry()
+	}
+
+	if hostnameRefresh > 0 {
+		go out.periodicHostnameRefresh()
+	}
+
+	if workloadCacheTTL > 0 {
+		go out.periodicWorkloadExpiry()
+	}
+
+	go out.periodicSubscriptionAudit()
+
 	out.DebugConfigs = pilot.DebugConfigs
 
 	pushThrottle := intEnv(pilot.PushThrottle, 10)
 	pushBurst := intEnv(pilot.PushBurst, 100)
 
 	adsLog.Infof("Starting ADS server with rateLimiter=%d burst=%d", pushThrottle, pushBurst)
+	out.pushThrottle = pushThrottle
+	out.pushBurst = pushBurst
 	out.rateLimiter = rate.NewLimiter(rate.Limit(pushThrottle), pushBurst)
 	out.initRateLimiter = rate.NewLimiter(rate.Limit(pushThrottle*2), pushBurst*2)
 
@@ -290,6 +432,12 @@ func (s *DiscoveryServer) Register(rpcs *grpc.Server) {
 	// EDS must remain registered for 0.8, for smooth upgrade from 0.7
 	// 0.7 proxies will use this service.
 	ads.RegisterAggregatedDiscoveryServiceServer(rpcs, s)
+	lrsgrpc.RegisterLoadReportingServiceServer(rpcs, s)
+	// Health reflects push-pipeline state, so load balancers route proxies
+	// away from degraded replicas.
+	healthpb.RegisterHealthServer(rpcs, newHealthServer(s))
+	// External health checkers stream endpoint transitions in over this.
+	rpcs.RegisterService(&healthFeedServiceDesc, s)
 }
 
 // Singleton, refresh the cache - may not be needed if events work properly, just a failsafe
@@ -311,7 +459,7 @@ func (s *DiscoveryServer) periodicRefresh() {
 	defer ticker.Stop()
 	for range ticker.C {
 		adsLog.Infof("ADS: periodic push of envoy configs %s", versionInfo())
-		s.AdsPushAll(versionInfo(), s.globalPushContext(), true, nil)
+		s.adsPushAll(versionInfo(), s.globalPushContext(), true, nil, true)
 	}
 }
 
@@ -368,7 +516,7 @@ func (s *DiscoveryServer) Push(full bool, edsUpdates map[string]*EndpointShardsB
 	s.updateMutex.Unlock()
 
 	s.mutex.Lock()
-	versionLocal := time.Now().Format(time.RFC3339) + "/" + strconv.Itoa(versionNum)
+	versionLocal := versionFunc(versionNum)
 	versionNum++
 	initContextTime := time.Since(t0)
 	adsLog.Debugf("InitContext %v for push took %s", versionLocal, initContextTime)
@@ -378,13 +526,29 @@ func (s *DiscoveryServer) Push(full bool, edsUpdates map[string]*EndpointShardsB
 	version = versionLocal
 	versionMutex.Unlock()
 
+	// The service catalog is derived from the PushContext, so a new context
+	// means a new catalog.
+	notifyCatalogWatchers()
+
 	go s.AdsPushAll(versionLocal, push, true, nil)
 }
 
-func nonce() string {
+// nonceFunc generates response nonces. Random by default; tests replace it
+// so DiscoveryResponses can be compared byte-for-byte.
+var nonceFunc = func() string {
 	return uuid.New().String()
 }
 
+// versionFunc stamps new config versions from the version sequence number.
+// Time-based by default; tests replace it for deterministic snapshots.
+var versionFunc = func(num int) string {
+	return time.Now().Format(time.RFC3339) + "/" + strconv.Itoa(num)
+}
+
+func nonce() string {
+	return nonceFunc()
+}
+
 func versionInfo() string {
 	versionMutex.RLock()
 	defer versionMutex.RUnlock()
@@ -406,8 +570,9 @@ func (s *DiscoveryServer) ServiceAccounts(serviceName string) []string {
 	if !f {
 		return sa
 	}
+	shards, _ := ep.snapshot()
 	samap := map[string]bool{}
-	for _, es := range ep.Shards {
+	for _, es := range shards {
 		for _, el := range es.Entries {
 			if f := samap[el.ServiceAccount]; !f {
 				samap[el.ServiceAccount] = true
@@ -442,7 +607,8 @@ func (s *DiscoveryServer) debouncePush(startDebounce time.Time) {
 	events := s.configUpdateCounter
 	s.updateMutex.RUnlock()
 
-	if since > 2*DebounceAfter ||
+	window := s.effectiveDebounce()
+	if since > 2*window ||
 		time.Since(startDebounce) > DebounceMax {
 
 		adsLog.Infof("Push debounce stable %d: %v since last change, %v since last push, full=%v",
@@ -452,7 +618,7 @@ func (s *DiscoveryServer) debouncePush(startDebounce time.Time) {
 		s.doPush()
 
 	} else {
-		time.AfterFunc(DebounceAfter, func() {
+		time.AfterFunc(window, func() {
 			s.debouncePush(startDebounce)
 		})
 	}
@@ -467,6 +633,8 @@ func (s *DiscoveryServer) doPush() {
 	s.debouncePushTimerSet = false
 	s.lastPushStart = time.Now()
 	full := s.fullPush
+	causes := s.fullPushCauses
+	s.fullPushCauses = map[string]bool{}
 
 	s.mutex.Lock()
 	// Swap the edsUpdates map - tracking requests for incremental updates.
@@ -474,13 +642,46 @@ func (s *DiscoveryServer) doPush() {
 	edsUpdates := s.edsUpdates
 	// Reset - any new updates will be tracked by the new map
 	s.edsUpdates = map[string]*EndpointShardsByService{}
+	// Report the new services this push covers as one batch, instead of
+	// one "full push" line per service during onboarding bursts.
+	newServices := make([]string, 0, len(s.newServiceBatch))
+	for svc := range s.newServiceBatch {
+		newServices = append(newServices, svc)
+	}
+	s.newServiceBatch = map[string]bool{}
+	if full {
+		// Consumed by startPush to track the CDS+EDS bundle per connection.
+		s.newServicesForPush = newServices
+	}
 	s.mutex.Unlock()
 
+	if full && len(newServices) > 0 {
+		newServiceBatchSize.Observe(float64(len(newServices)))
+		adsLog.Infof("Full push covering %d new services", len(newServices))
+	}
+
 	// Update the config values, next ConfigUpdate and eds updates will use this
 	s.fullPush = false
 
 	s.updateMutex.Unlock()
 
+	if full {
+		if canDowngradeFullPush(causes) {
+			// Every trigger only changed endpoint data - push EDS for all
+			// services instead of rebuilding and fanning out the full config.
+			full = false
+			s.mutex.RLock()
+			for svc, ep := range s.EndpointShardsByService {
+				edsUpdates[svc] = ep
+			}
+			s.mutex.RUnlock()
+			recordPushDowngrade("downgraded")
+			adsLog.Infof("Full push downgraded to EDS-only, causes %v", causeList(causes))
+		} else {
+			recordPushDowngrade("kept")
+		}
+	}
+
 	s.Push(full, edsUpdates)
 }
 
@@ -493,7 +694,13 @@ func (s *DiscoveryServer) clearCache() {
 // ConfigUpdate implements ConfigUpdater interface, used to request pushes.
 // It replaces the 'clear cache' from v1.
 func (s *DiscoveryServer) ConfigUpdate(full bool) {
-	s.updateChannel <- &updateReq{full: full}
+	s.configUpdateCause(full, pushCauseConfig)
+}
+
+// configUpdateCause requests a push, recording why a full push is needed so
+// endpoint-only triggers can be downgraded to EDS.
+func (s *DiscoveryServer) configUpdateCause(full bool, cause string) {
+	s.updateChannel <- &updateReq{full: full, cause: cause}
 }
 
 // Debouncing and update request happens in a separate thread, it uses locks
@@ -511,15 +718,20 @@ func (s *DiscoveryServer) handleUpdates() {
 
 			if r.full {
 				s.fullPush = true
+				if r.cause != "" {
+					s.fullPushCauses[r.cause] = true
+				}
 			}
 			s.configUpdateCounter++
 
-			s.lastConfigUpdateTime = time.Now()
+			now := time.Now()
+			s.recordEventIntervalLocked(now)
+			s.lastConfigUpdateTime = now
 
 			if !s.debouncePushTimerSet {
 				s.debouncePushTimerSet = true
 				startDebounce := s.lastConfigUpdateTime
-				time.AfterFunc(DebounceAfter, func() {
+				time.AfterFunc(s.effectiveDebounceLocked(), func() {
 					s.debouncePush(startDebounce)
 				})
 			} // else: debounce in progress - it'll keep delaying the push
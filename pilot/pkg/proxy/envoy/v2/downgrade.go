@@ -0,0 +1,86 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Several triggers request a "full" push although they only change endpoint
+// data - an admin drain or a VM health transition does not alter a single
+// cluster, listener or route. The downgrade classifier looks at why the full
+// push was requested; if every recorded cause is endpoint-only, the push is
+// converted to EDS for all services, skipping the PushContext rebuild and
+// the CDS/LDS/RDS fan-out. Any cause not known to be safe - config changes,
+// new services, service account changes - keeps the push full.
+
+// Causes recorded when a full push is requested.
+const (
+	// pushCauseConfig is the conservative default: config or unknown.
+	pushCauseConfig = "config"
+	// pushCauseEndpointHealth is a VM health report transition.
+	pushCauseEndpointHealth = "endpoint_health"
+	// pushCauseDrain is an admin drain or restore.
+	pushCauseDrain = "drain"
+	// pushCauseNewService is a service first seen through its endpoints.
+	pushCauseNewService = "new_service"
+	// pushCauseServiceAccounts is a service account set change.
+	pushCauseServiceAccounts = "service_accounts"
+)
+
+// edsOnlyPushCauses are the causes proven to only affect EDS output.
+var edsOnlyPushCauses = map[string]bool{
+	pushCauseEndpointHealth: true,
+	pushCauseDrain:          true,
+}
+
+var pushDowngrades = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "pilot_push_downgrades",
+	Help: "Full pushes downgraded to EDS-only, and full pushes kept.",
+}, []string{"result"})
+
+func init() {
+	prometheus.MustRegister(pushDowngrades)
+}
+
+func recordPushDowngrade(result string) {
+	pushDowngrades.With(prometheus.Labels{"result": result}).Add(1)
+}
+
+// canDowngradeFullPush reports whether every cause recorded for the pending
+// full push is endpoint-only. An empty cause set means the trigger predates
+// cause tracking or came from an unknown path - kept full.
+func canDowngradeFullPush(causes map[string]bool) bool {
+	if len(causes) == 0 {
+		return false
+	}
+	for cause := range causes {
+		if !edsOnlyPushCauses[cause] {
+			return false
+		}
+	}
+	return true
+}
+
+func causeList(causes map[string]bool) []string {
+	out := make([]string, 0, len(causes))
+	for c := range causes {
+		out = append(out, c)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,45 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"testing"
+)
+
+func TestCanDowngradeFullPush(t *testing.T) {
+	cases := []struct {
+		name      string
+		causes    []string
+		downgrade bool
+	}{
+		{"no causes recorded", nil, false},
+		{"health only", []string{pushCauseEndpointHealth}, true},
+		{"drain only", []string{pushCauseDrain}, true},
+		{"health and drain", []string{pushCauseEndpointHealth, pushCauseDrain}, true},
+		{"config change", []string{pushCauseConfig}, false},
+		{"health mixed with config", []string{pushCauseEndpointHealth, pushCauseConfig}, false},
+		{"new service", []string{pushCauseNewService}, false},
+		{"service accounts", []string{pushCauseServiceAccounts}, false},
+	}
+	for _, c := range cases {
+		causes := map[string]bool{}
+		for _, cause := range c.causes {
+			causes[cause] = true
+		}
+		if got := canDowngradeFullPush(causes); got != c.downgrade {
+			t.Errorf("%s: canDowngradeFullPush(%v) = %v, want %v", c.name, c.causes, got, c.downgrade)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Maintenance mode: an endpoint can be taken out of rotation
+// administratively, independent of health - either by labeling the workload,
+// or at runtime through the drain admin API. Drained endpoints are omitted
+// from EDS, allowing surgical draining of a single pod or VM.
+
+// DrainLabel marks a workload as administratively out of rotation when set
+// to "true".
+const DrainLabel = "istio.io/drain"
+
+var (
+	// drainMutex guards drainedAddresses.
+	drainMutex sync.RWMutex
+
+	// drainedAddresses is the set of endpoint addresses drained through the
+	// admin API, in addition to any label-drained workloads.
+	drainedAddresses = map[string]bool{}
+
+	drainedEndpointsGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "pilot_eds_drained_endpoints",
+		Help: "Endpoint addresses currently drained through the admin API.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(drainedEndpointsGauge)
+}
+
+// endpointDrained reports whether an endpoint should be withheld from EDS,
+// either by its drain label or by an admin drain on its address.
+func endpointDrained(address string, labels map[string]string) bool {
+	if labels[DrainLabel] == "true" {
+		return true
+	}
+	drainMutex.RLock()
+	d := drainedAddresses[address]
+	drainMutex.RUnlock()
+	return d
+}
+
+// DrainRequest adds or removes an address from the admin drain set.
+type DrainRequest struct {
+	Address string `json:"address"`
+	Drain   bool   `json:"drain"`
+}
+
+// drainz implements the drain admin API. POST drains or restores an address,
+// GET lists the drained addresses. It shares the injection token and is
+// mapped to /debug/drain on the monitor port (9093).
+func (s *DiscoveryServer) drainz(w http.ResponseWriter, req *http.Request) {
+	if !injectAuthorized(w, req) {
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+
+	switch req.Method {
+	case http.MethodGet:
+		drainMutex.RLock()
+		addresses := make([]string, 0, len(drainedAddresses))
+		for a := range drainedAddresses {
+			addresses = append(addresses, a)
+		}
+		drainMutex.RUnlock()
+		sort.Strings(addresses)
+		b, _ := json.MarshalIndent(addresses, " ", " ")
+		_, _ = w.Write(b)
+	case http.MethodPost:
+		var dr DrainRequest
+		if err := json.NewDecoder(req.Body).Decode(&dr); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "{\"error\": %q}\n", err.Error())
+			return
+		}
+		if dr.Address == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(w, "{\"error\": \"address is required\"}")
+			return
+		}
+		drainMutex.Lock()
+		if dr.Drain {
+			drainedAddresses[dr.Address] = true
+		} else {
+			delete(drainedAddresses, dr.Address)
+		}
+		drainedEndpointsGauge.Set(float64(len(drainedAddresses)))
+		drainMutex.Unlock()
+		adsLog.Infof("Drain: %s drain=%v", dr.Address, dr.Drain)
+
+		// Assignments are precomputed per cluster - force a recompute so the
+		// change takes effect everywhere.
+		s.configUpdateCause(true, pushCauseDrain)
+		fmt.Fprintf(w, "{\"address\": %q, \"drained\": %v}\n", dr.Address, dr.Drain)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -17,9 +17,10 @@ package v2
 import (
 	"context"
 	"errors"
-	"math"
+	"fmt"
 	"reflect"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -33,6 +34,7 @@ import (
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/networking/util"
 	"istio.io/istio/pilot/pkg/serviceregistry/aggregate"
+	"istio.io/istio/pkg/features/pilot"
 )
 
 // EDS returns the list of endpoints (IP:port and in future labels) associated with a real
@@ -58,19 +60,88 @@ import (
 // TODO: efficient label processing. In alpha3, the destination policies are set per service, so
 // we may only need to search in a small list.
 
+// Values of PILOT_ENDPOINT_METADATA.
+const (
+	endpointMetadataFull    = ""
+	endpointMetadataMinimal = "minimal"
+	endpointMetadataNone    = "none"
+)
+
 var (
 	edsClusterMutex sync.RWMutex
 	edsClusters     = map[string]*EdsCluster{}
 
 	// Tracks connections, increment on each new connection.
 	connectionNumber = int64(0)
-)
 
-const (
-	// The range of LoadBalancingWeight is [1, 128]
-	maxLoadBalancingWeight = 128
+	// edsIdleTimeout is how long an unwatched cluster is retained before GC,
+	// so the precomputed assignment survives brief reconnects. Zero preserves
+	// the old behavior of deleting the instant the last watcher disconnects.
+	edsIdleTimeout time.Duration
+
+	// edsMaxIdleClusters bounds how many unwatched clusters may be retained
+	// while waiting for the idle timeout.
+	edsMaxIdleClusters int
+
+	edsIdleEvictions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pilot_xds_eds_idle_evictions",
+		Help: "Idle EDS clusters evicted, by reason (ttl or overflow).",
+	}, []string{"reason"})
+
+	// malformedClusterNames counts EDS subscriptions with cluster names that
+	// do not parse.
+	malformedClusterNames = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "pilot_eds_malformed_cluster_names",
+		Help: "EDS subscriptions with malformed cluster names.",
+	})
+
+	// newServiceBatchSize sizes the batches of previously-unseen services
+	// covered by a single full push; onboarding a namespace should show up
+	// as one large batch, not dozens of pushes.
+	newServiceBatchSize = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "pilot_eds_new_service_batch_size",
+		Help:    "New services covered by a single full push.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 8),
+	})
+
+	// duplicateEndpoints counts address:port entries a registry delivered
+	// more than once within one shard; duplicates skew load-balancing
+	// weights, so they are dropped and the registry bug surfaced.
+	duplicateEndpoints = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "pilot_eds_duplicate_endpoints",
+		Help: "Duplicate endpoint addresses dropped from shard updates.",
+	})
+
+	// wildcardHostClusters counts EDS subscriptions for wildcard hosts,
+	// which are served an explicit empty assignment - traffic reaches them
+	// through original-dst or SNI-based clusters, never through EDS.
+	wildcardHostClusters = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "pilot_eds_wildcard_host_clusters",
+		Help: "EDS subscriptions for wildcard hosts, served empty.",
+	})
+
+	// endpointMetadataMode controls emission of the istio filter metadata on
+	// endpoints (PILOT_ENDPOINT_METADATA): everything, network only, or none.
+	endpointMetadataMode = pilot.EndpointMetadata
+
+	// edsFirstEndpointDelay quantifies the cold-start discovery gap: how long
+	// a cluster was watched before its first non-empty assignment.
+	edsFirstEndpointDelay = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "pilot_eds_first_endpoint_delay",
+		Help:    "Seconds between first use of an EDS cluster and its first non-empty assignment.",
+		Buckets: []float64{.01, .1, 1, 3, 5, 10, 30},
+	})
 )
 
+func init() {
+	prometheus.MustRegister(edsIdleEvictions)
+	prometheus.MustRegister(edsFirstEndpointDelay)
+	prometheus.MustRegister(malformedClusterNames)
+	prometheus.MustRegister(duplicateEndpoints)
+	prometheus.MustRegister(wildcardHostClusters)
+	prometheus.MustRegister(newServiceBatchSize)
+}
+
 // EdsCluster tracks eds-related info for monitored clusters. In practice it'll include
 // all clusters until we support on-demand cluster loading.
 type EdsCluster struct {
@@ -82,14 +153,35 @@ type EdsCluster struct {
 	// FirstUse is the time the cluster was first used, for debugging
 	FirstUse time.Time
 
-	// EdsClients keeps track of all nodes monitoring the cluster.
+	// EdsClients keeps track of all connections monitoring the cluster,
+	// keyed by connection ID. A node may have multiple connections watching
+	// the same cluster - for example during an Envoy hot restart, when the
+	// old and the new Envoy overlap - so keying by node would silently lose
+	// track of one of them and GC the cluster too early.
 	EdsClients map[string]*XdsConnection `json:"-"`
 
 	// NonEmptyTime is the time the cluster first had a non-empty set of endpoints
 	NonEmptyTime time.Time
 
+	// UpdateFailure is the last error from computing the assignment, or ""
+	// when the last computation succeeded. Visible in /debug/edsz.
+	UpdateFailure string
+
+	// FailedAttempts counts consecutive failed computations, driving the
+	// retry backoff. Reset on success.
+	FailedAttempts int
+
+	// retryPending is set while a retry is scheduled, so overlapping failures
+	// don't stack retries.
+	retryPending bool
+
 	// The discovery service this cluster is associated with.
 	discovery *DiscoveryServer
+
+	// idleSince is the time the last watcher disconnected, or zero while the
+	// cluster is watched. Guarded by edsClusterMutex, not the cluster mutex,
+	// so eviction can scan all clusters without nested locking.
+	idleSince time.Time
 }
 
 // TODO: add prom metrics !
@@ -144,15 +236,19 @@ func buildEnvoyLbEndpoint(UID string, family model.AddressFamily, address string
 	}
 
 	// Istio telemetry depends on the metadata value being set for endpoints in the mesh.
-	// Do not remove: mixerfilter depends on this logic.
-	if UID != "" {
+	// Do not remove: mixerfilter depends on this logic. Meshes without Mixer
+	// may reduce or omit it via PILOT_ENDPOINT_METADATA.
+	if UID != "" && endpointMetadataMode != endpointMetadataNone {
+		fields := map[string]*types.Value{
+			"network": {Kind: &types.Value_StringValue{StringValue: network}},
+		}
+		if endpointMetadataMode != endpointMetadataMinimal {
+			fields["uid"] = &types.Value{Kind: &types.Value_StringValue{StringValue: UID}}
+		}
 		ep.Metadata = &core.Metadata{
 			FilterMetadata: map[string]*types.Struct{
 				"istio": {
-					Fields: map[string]*types.Value{
-						"uid":     {Kind: &types.Value_StringValue{StringValue: UID}},
-						"network": {Kind: &types.Value_StringValue{StringValue: network}},
-					},
+					Fields: fields,
 				},
 			},
 		}
@@ -175,8 +271,10 @@ func networkEndpointToEnvoyEndpoint(e *model.NetworkEndpoint) (*endpoint.LbEndpo
 	}
 
 	// Istio telemetry depends on the metadata value being set for endpoints in the mesh.
-	// Do not remove: mixerfilter depends on this logic.
-	if e.UID != "" || e.Network != "" {
+	// Do not remove: mixerfilter depends on this logic. Meshes without Mixer
+	// may reduce or omit it via PILOT_ENDPOINT_METADATA.
+	if (e.UID != "" && endpointMetadataMode == endpointMetadataFull) ||
+		(e.Network != "" && endpointMetadataMode != endpointMetadataNone) {
 		ep.Metadata = &core.Metadata{
 			FilterMetadata: map[string]*types.Struct{
 				"istio": {
@@ -186,11 +284,11 @@ func networkEndpointToEnvoyEndpoint(e *model.NetworkEndpoint) (*endpoint.LbEndpo
 		}
 	}
 
-	if e.UID != "" {
+	if e.UID != "" && endpointMetadataMode == endpointMetadataFull {
 		ep.Metadata.FilterMetadata["istio"].Fields["uid"] = &types.Value{Kind: &types.Value_StringValue{StringValue: e.UID}}
 	}
 
-	if e.Network != "" {
+	if e.Network != "" && endpointMetadataMode != endpointMetadataNone {
 		ep.Metadata.FilterMetadata["istio"].Fields["network"] = &types.Value{Kind: &types.Value_StringValue{StringValue: e.Network}}
 	}
 
@@ -202,13 +300,30 @@ func networkEndpointToEnvoyEndpoint(e *model.NetworkEndpoint) (*endpoint.LbEndpo
 func (s *DiscoveryServer) updateClusterInc(push *model.PushContext, clusterName string,
 	edsCluster *EdsCluster) error {
 
-	var hostname model.Hostname
-
-	var port int
-	var subsetName string
-	_, subsetName, hostname, port = model.ParseSubsetKey(clusterName)
+	_, subsetName, hostname, port, err := model.ParseSubsetKeyStrict(clusterName)
+	if err != nil {
+		malformedClusterNames.Add(1)
+		push.Add(model.ProxyStatusMalformedSubscription, clusterName, nil, err.Error())
+		return err
+	}
 	labels := push.SubsetToLabels(subsetName, hostname)
 
+	// Wildcard hosts (*.example.com, from ServiceEntries) have no knowable
+	// member list - traffic is routed by original-dst or SNI-based clusters.
+	// Serve an explicit empty assignment and report it, instead of falling
+	// through to the legacy instance lookup with undefined results.
+	if strings.HasPrefix(string(hostname), "*") {
+		wildcardHostClusters.Add(1)
+		push.Add(model.ProxyStatusWildcardHostEDS, clusterName, nil,
+			fmt.Sprintf("wildcard host %s is excluded from EDS", hostname))
+		edsCluster.mutex.Lock()
+		edsCluster.LoadAssignment = &xdsapi.ClusterLoadAssignment{
+			ClusterName: clusterName,
+		}
+		edsCluster.mutex.Unlock()
+		return nil
+	}
+
 	portMap, f := push.ServicePort2Name[string(hostname)]
 	if !f {
 		return s.updateCluster(push, clusterName, edsCluster)
@@ -219,7 +334,9 @@ func (s *DiscoveryServer) updateClusterInc(push *model.PushContext, clusterName
 	}
 
 	// The service was never updated - do the full update
+	s.mutex.RLock()
 	se, f := s.EndpointShardsByService[string(hostname)]
+	s.mutex.RUnlock()
 	if !f {
 		return s.updateCluster(push, clusterName, edsCluster)
 	}
@@ -228,8 +345,11 @@ func (s *DiscoveryServer) updateClusterInc(push *model.PushContext, clusterName
 	localityEpMap := make(map[string]*endpoint.LocalityLbEndpoints)
 
 	// The shards are updated independently, now need to filter and merge
-	// for this cluster
-	for _, es := range se.Shards {
+	// for this cluster. The build runs on an immutable snapshot, so it never
+	// holds the service lock while constructing endpoints (or resolving
+	// hostnames).
+	shards, epoch := se.snapshot()
+	for _, es := range shards {
 		for _, el := range es.Entries {
 			if svcPort.Name != el.ServicePortName {
 				continue
@@ -238,26 +358,56 @@ func (s *DiscoveryServer) updateClusterInc(push *model.PushContext, clusterName
 			if !labels.HasSubsetOf(model.Labels(el.Labels)) {
 				continue
 			}
+			// Administratively drained endpoints are withheld regardless of health.
+			if endpointDrained(el.Address, el.Labels) {
+				continue
+			}
 			cnt++
 
-			// TODO: Need to accommodate region, zone and subzone. Older Pilot datamodel only has zone = availability zone.
-			// Once we do that, the key must be a | separated tupple.
-			locality := (el.Labels)[model.AZLabel] // may be ""
+			// The locality is computed from custom labels if PILOT_LOCALITY_LABELS
+			// is set, falling back to zone = availability zone.
+			loc := localityFromLabels(el.Labels)
+			locality := localityKey(&loc)
 			locLbEps, found := localityEpMap[locality]
 			if !found {
 				locLbEps = &endpoint.LocalityLbEndpoints{
-					Locality: &core.Locality{
-						Zone: locality,
-					},
+					Locality: &loc,
 				}
 				localityEpMap[locality] = locLbEps
 			}
+			if el.Family == model.AddressFamilyTCP && !isIPAddress(el.Address) {
+				// Hostname-typed endpoint: either Envoy resolves it through a
+				// DNS cluster (and EDS omits it), or Pilot resolves it here,
+				// one LbEndpoint per address. Not cached on the endpoint -
+				// the addresses change between refreshes.
+				if !envoyResolved(el.Labels) {
+					for _, addr := range resolveHostname(el.Address) {
+						lbEp := buildEnvoyLbEndpoint(el.UID, el.Family, addr, el.EndpointPort, el.Network)
+						stampResidency(lbEp, el.Labels)
+						applyEndpointBuildHooks(lbEp, el.Labels, el.Network)
+						lbEp.HealthStatus = healthStatusFor(el.Address, el.Labels)
+						locLbEps.LbEndpoints = append(locLbEps.LbEndpoints, *lbEp)
+					}
+				}
+				continue
+			}
 			if el.EnvoyEndpoint == nil {
 				el.EnvoyEndpoint = buildEnvoyLbEndpoint(el.UID, el.Family, el.Address, el.EndpointPort, el.Network)
+				stampResidency(el.EnvoyEndpoint, el.Labels)
+				applyEndpointBuildHooks(el.EnvoyEndpoint, el.Labels, el.Network)
 			}
 			locLbEps.LbEndpoints = append(locLbEps.LbEndpoints, *el.EnvoyEndpoint)
+			// Health changes between shard updates, so it is stamped on the
+			// pushed copy rather than on the cached endpoint.
+			locLbEps.LbEndpoints[len(locLbEps.LbEndpoints)-1].HealthStatus = healthStatusFor(el.Address, el.Labels)
 		}
 	}
+	if se.epochNow() != epoch {
+		// The shards changed while the assignment was computed. No retry
+		// needed - the update that replaced them has its own push queued,
+		// which will recompute from the new shards.
+		edsStaleSnapshots.Add(1)
+	}
 	locEps := make([]endpoint.LocalityLbEndpoints, 0, len(localityEpMap))
 	for _, locLbEps := range localityEpMap {
 		locLbEps.LoadBalancingWeight = &types.UInt32Value{
@@ -268,6 +418,7 @@ func (s *DiscoveryServer) updateClusterInc(push *model.PushContext, clusterName
 
 	if cnt == 0 {
 		push.Add(model.ProxyStatusClusterNoInstances, clusterName, nil, "")
+		emitAnomaly(AnomalyNoInstances, string(hostname), fmt.Sprintf("cluster %s has no instances", clusterName))
 		//adsLog.Infof("EDS: no instances %s (host=%s ports=%v labels=%v)", clusterName, hostname, p, labels)
 	}
 	edsInstances.With(prometheus.Labels{"cluster": clusterName}).Set(float64(cnt))
@@ -283,8 +434,10 @@ func (s *DiscoveryServer) updateClusterInc(push *model.PushContext, clusterName
 		ClusterName: clusterName,
 		Endpoints:   locEps,
 	}
+	recordClaSnapshot(clusterName, edsCluster.LoadAssignment)
 	if len(locEps) > 0 && edsCluster.NonEmptyTime.IsZero() {
 		edsCluster.NonEmptyTime = time.Now()
+		edsFirstEndpointDelay.Observe(edsCluster.NonEmptyTime.Sub(edsCluster.FirstUse).Seconds())
 	}
 	return nil
 }
@@ -358,7 +511,9 @@ func (s *DiscoveryServer) updateServiceShards(push *model.PushContext) error {
 	s.mutex.Lock()
 	for k, v := range svc2account {
 		ep, _ := s.EndpointShardsByService[k]
+		ep.mutex.Lock()
 		ep.ServiceAccounts = v
+		ep.mutex.Unlock()
 	}
 	s.mutex.Unlock()
 
@@ -370,7 +525,12 @@ func (s *DiscoveryServer) updateServiceShards(push *model.PushContext) error {
 func (s *DiscoveryServer) updateCluster(push *model.PushContext, clusterName string, edsCluster *EdsCluster) error {
 	// TODO: should we lock this as well ? Once we move to event-based it may not matter.
 	var locEps []endpoint.LocalityLbEndpoints
-	direction, subsetName, hostname, port := model.ParseSubsetKey(clusterName)
+	direction, subsetName, hostname, port, err := model.ParseSubsetKeyStrict(clusterName)
+	if err != nil {
+		malformedClusterNames.Add(1)
+		push.Add(model.ProxyStatusMalformedSubscription, clusterName, nil, err.Error())
+		return err
+	}
 	if direction == model.TrafficDirectionInbound ||
 		direction == model.TrafficDirectionOutbound {
 		labels := push.SubsetToLabels(subsetName, hostname)
@@ -404,8 +564,10 @@ func (s *DiscoveryServer) updateCluster(push *model.PushContext, clusterName str
 		ClusterName: clusterName,
 		Endpoints:   locEps,
 	}
+	recordClaSnapshot(clusterName, edsCluster.LoadAssignment)
 	if len(locEps) > 0 && edsCluster.NonEmptyTime.IsZero() {
 		edsCluster.NonEmptyTime = time.Now()
+		edsFirstEndpointDelay.Observe(edsCluster.NonEmptyTime.Sub(edsCluster.FirstUse).Seconds())
 	}
 	return nil
 }
@@ -414,7 +576,6 @@ func (s *DiscoveryServer) updateCluster(push *model.PushContext, clusterName str
 func (s *DiscoveryServer) SvcUpdate(cluster, hostname string, ports map[string]uint32, rports map[uint32]string) {
 	pc := s.globalPushContext()
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
 	if cluster == "" {
 		pl := model.PortList{}
 		for k, v := range ports {
@@ -426,6 +587,14 @@ func (s *DiscoveryServer) SvcUpdate(cluster, hostname string, ports map[string]u
 		pc.ServicePort2Name[hostname] = pl
 	}
 	// TODO: for updates from other clusters, warn if they don't match primary.
+	pending := s.takePendingLocked(hostname)
+	s.mutex.Unlock()
+
+	// Replay endpoint updates that arrived before this service was defined.
+	for shard, entries := range pending {
+		adsLog.Infof("EDS: flushing %d buffered endpoints for %s shard %s", len(entries), hostname, shard)
+		s.edsUpdate(shard, hostname, entries, false)
+	}
 }
 
 // Update clusters for an incremental EDS push, and initiate the push.
@@ -461,7 +630,7 @@ func (s *DiscoveryServer) edsIncremental(version string, push *model.PushContext
 	}
 	adsLog.Infof("Cluster init time %v %s", time.Since(t0), version)
 
-	s.startPush(version, push, false, edsUpdates)
+	s.startPush(version, push, false, edsUpdates, false)
 }
 
 // WorkloadUpdate is called when workload labels/annotations are updated.
@@ -481,9 +650,13 @@ func (s *DiscoveryServer) WorkloadUpdate(id string, labels map[string]string, an
 		s.WorkloadsByID[id] = &Workload{
 			Labels:      labels,
 			Annotations: annotations,
+			LastSeen:    time.Now(),
 		}
+		s.enforceWorkloadBoundLocked()
+		workloadCacheSize.Set(float64(len(s.WorkloadsByID)))
 		return
 	}
+	w.LastSeen = time.Now()
 	if reflect.DeepEqual(w.Labels, labels) {
 		// No label change.
 		return
@@ -517,36 +690,88 @@ func (s *DiscoveryServer) edsUpdate(shard, serviceName string,
 	// update. The endpoint updates may be grouped by K8S clusters, other service registries
 	// or by deployment. Multiple updates are debounced, to avoid too frequent pushes.
 	// After debounce, the services are merged and pushed.
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	pc := s.globalPushContext()
 	requireFull := false
+	fullCause := pushCauseServiceAccounts
 
 	// Update the data structures for the service.
-	// 1. Find the 'per service' data
+	// 1. Find the 'per service' data. The global mutex is held only for the
+	// map lookup (and creation) - the heavy per-service work below runs
+	// under the per-service lock, so updates for distinct services don't
+	// serialize on it.
+	s.mutex.RLock()
 	ep, f := s.EndpointShardsByService[serviceName]
+	s.mutex.RUnlock()
 	if !f {
-		// This endpoint is for a service that was not previously loaded.
-		// Return an error to force a full sync, which will also cause the
-		// EndpointsShardsByService to be initialized with all services.
-		ep = &EndpointShardsByService{
-			Shards:          map[string]*EndpointShard{},
-			ServiceAccounts: map[string]bool{},
-		}
-		s.EndpointShardsByService[serviceName] = ep
-		if !internal {
-			adsLog.Infof("Full push, new service %s", serviceName)
-			requireFull = true
+		s.mutex.Lock()
+		// Re-check: a concurrent update may have created it.
+		ep, f = s.EndpointShardsByService[serviceName]
+		if !f {
+			// Endpoints racing ahead of their service definition are parked until
+			// SvcUpdate replays them, instead of forcing a full push now.
+			if !internal && s.bufferPendingLocked(pc, shard, serviceName, entries) {
+				s.mutex.Unlock()
+				return
+			}
+			// This endpoint is for a service that was not previously loaded.
+			// Return an error to force a full sync, which will also cause the
+			// EndpointsShardsByService to be initialized with all services.
+			ep = &EndpointShardsByService{
+				Shards:          map[string]*EndpointShard{},
+				ServiceAccounts: map[string]bool{},
+			}
+			s.EndpointShardsByService[serviceName] = ep
+			if !internal {
+				// The full push is debounced; batching the names here keeps
+				// an onboarding burst to one push - and one log line -
+				// instead of one per service.
+				s.newServiceBatch[serviceName] = true
+				adsLog.Debugf("Full push, new service %s", serviceName)
+				requireFull = true
+				fullCause = pushCauseNewService
+			}
 		}
+		s.mutex.Unlock()
 	}
 
+	ep.mutex.Lock()
+
 	// 2. Update data for the specific cluster. Each cluster gets independent
 	// updates containing the full list of endpoints for the service in that cluster.
 	ce := &EndpointShard{
-		Shard:   shard,
-		Entries: []*model.IstioEndpoint{},
+		Shard:      shard,
+		Entries:    []*model.IstioEndpoint{},
+		LastUpdate: time.Now(),
 	}
 
+	// Discovery provenance for debug dumps: endpoints re-delivered by the
+	// registry keep their original discovery time.
+	var prevByKey map[string]*model.IstioEndpoint
+	if old, f := ep.Shards[shard]; f {
+		prevByKey = make(map[string]*model.IstioEndpoint, len(old.Entries))
+		for _, pe := range old.Entries {
+			prevByKey[shardEndpointKey(pe)] = pe
+		}
+	}
+
+	// Duplicate address:port entries within a shard are a registry bug;
+	// kept, they would count twice in load-balancing weights.
+	seenAddr := make(map[string]bool, len(entries))
+	duplicates := 0
+
 	for _, e := range entries {
+		addrKey := fmt.Sprintf("%s:%d/%s", e.Address, e.EndpointPort, e.ServicePortName)
+		if seenAddr[addrKey] {
+			duplicates++
+			continue
+		}
+		seenAddr[addrKey] = true
+		e.Registry = shard
+		e.LastUpdatedAt = ce.LastUpdate
+		e.DiscoveredAt = ce.LastUpdate
+		if prev, f := prevByKey[shardEndpointKey(e)]; f && !prev.DiscoveredAt.IsZero() {
+			e.DiscoveredAt = prev.DiscoveredAt
+		}
 		ce.Entries = append(ce.Entries, e)
 		if e.ServiceAccount != "" {
 			_, f = ep.ServiceAccounts[e.ServiceAccount]
@@ -558,11 +783,32 @@ func (s *DiscoveryServer) edsUpdate(shard, serviceName string,
 			}
 		}
 	}
+	if duplicates > 0 {
+		duplicateEndpoints.Add(float64(duplicates))
+		pc.Add(model.ProxyStatusDuplicateEndpoint, serviceName, nil,
+			fmt.Sprintf("%d duplicate endpoints dropped from shard %s", duplicates, shard))
+		adsLog.Warnf("EDS: %d duplicate endpoints for %s in shard %s", duplicates, serviceName, shard)
+	}
+	if old, f := ep.Shards[shard]; f {
+		logShardDelta(serviceName, shard, old.Entries, ce.Entries)
+	} else {
+		logShardDelta(serviceName, shard, nil, ce.Entries)
+	}
 	ep.Shards[shard] = ce
+	ep.epoch++
+	ep.mutex.Unlock()
+
+	s.mutex.Lock()
+	s.updateIPIndexLocked(serviceName, shard, ce.Entries)
 	s.edsUpdates[serviceName] = ep
+	s.mutex.Unlock()
+	if !internal {
+		s.writeShardStore(serviceName, shard, ce.Entries)
+		s.publishEndpointEvent(serviceName, shard, ce.Entries)
+	}
 
 	if requireFull {
-		s.ConfigUpdate(true)
+		s.configUpdateCause(true, fullCause)
 	} else {
 		s.ConfigUpdate(false)
 	}
@@ -575,21 +821,44 @@ func (s *DiscoveryServer) edsUpdate(shard, serviceName string,
 func localityLbEndpointsFromInstances(instances []*model.ServiceInstance) []endpoint.LocalityLbEndpoints {
 	localityEpMap := make(map[string]*endpoint.LocalityLbEndpoints)
 	for _, instance := range instances {
-		lbEp, err := networkEndpointToEnvoyEndpoint(&instance.Endpoint)
+		if endpointDrained(instance.Endpoint.Address, instance.Labels) {
+			continue
+		}
+		ep := instance.Endpoint
+		if ep.Family == model.AddressFamilyTCP && !isIPAddress(ep.Address) {
+			// Hostname-typed endpoint: skipped when Envoy resolves it via a
+			// DNS cluster, otherwise represented by its first resolved
+			// address (the remaining addresses show up on refresh).
+			if envoyResolved(instance.Labels) {
+				continue
+			}
+			addrs := resolveHostname(ep.Address)
+			if len(addrs) == 0 {
+				continue
+			}
+			ep.Address = addrs[0]
+		}
+		lbEp, err := networkEndpointToEnvoyEndpoint(&ep)
 		if err != nil {
 			adsLog.Errorf("EDS: unexpected pilot model endpoint v1 to v2 conversion: %v", err)
 			totalXDSInternalErrors.Add(1)
 			continue
 		}
-		// TODO: Need to accommodate region, zone and subzone. Older Pilot datamodel only has zone = availability zone.
-		// Once we do that, the key must be a | separated tupple.
-		locality := instance.GetAZ()
+		stampResidency(lbEp, instance.Labels)
+		applyEndpointBuildHooks(lbEp, instance.Labels, instance.Endpoint.Network)
+		lbEp.HealthStatus = healthStatusFor(instance.Endpoint.Address, instance.Labels)
+		loc := localityFromLabels(instance.Labels)
+		if loc.Region == "" && loc.SubZone == "" {
+			// Older Pilot datamodel: the registry-provided availability zone wins.
+			if az := instance.GetAZ(); az != "" {
+				loc.Zone = az
+			}
+		}
+		locality := localityKey(&loc)
 		locLbEps, found := localityEpMap[locality]
 		if !found {
 			locLbEps = &endpoint.LocalityLbEndpoints{
-				Locality: &core.Locality{
-					Zone: locality,
-				},
+				Locality: &loc,
 			}
 			localityEpMap[locality] = locLbEps
 		}
@@ -619,9 +888,31 @@ func (s *DiscoveryServer) pushEds(push *model.PushContext, con *XdsConnection,
 
 	updated := []string{}
 
-	for _, clusterName := range con.Clusters {
+	// Shadow clusters targeted by traffic mirroring are pushed along with
+	// the proxy's own subscriptions, and their derived watches reconciled.
+	clusters := con.Clusters
+	if derived := s.updateDerivedWatches(push, con); len(derived) > 0 {
+		clusters = append(append([]string{}, clusters...), derived...)
+	}
+
+	for _, clusterName := range clusters {
 
-		_, _, hostname, _ := model.ParseSubsetKey(clusterName)
+		_, _, hostname, _, err := model.ParseSubsetKeyStrict(clusterName)
+		if err != nil {
+			adsLog.Warnf("EDS: malformed cluster name %q from %s: %v", clusterName, con.ConID, err)
+			malformedClusterNames.Add(1)
+			push.Add(model.ProxyStatusMalformedSubscription, clusterName, con.modelNode, err.Error())
+			recordMissingCluster(con, clusterName, "malformed")
+			continue
+		}
+		if _, f := push.ServiceByHostname[hostname]; !f {
+			// Served anyway (the shards may still know it), but recorded: a
+			// subscription for a service missing from the push context points
+			// at CDS/service state drift.
+			recordMissingCluster(con, clusterName, "no_service")
+		} else {
+			clearMissingCluster(con, clusterName)
+		}
 		if edsUpdatedServices != nil && edsUpdatedServices[string(hostname)] == nil {
 			// Cluster was not updated, skip recomputing.
 			continue
@@ -643,8 +934,10 @@ func (s *DiscoveryServer) pushEds(push *model.PushContext, con *XdsConnection,
 			if err := s.updateCluster(push, clusterName, c); err != nil {
 				adsLog.Errorf("error returned from updateCluster for cluster name %s, skipping it.", clusterName)
 				totalXDSInternalErrors.Add(1)
+				s.recordClusterFailure(clusterName, c, err)
 				continue
 			}
+			recordClusterSuccess(c)
 			l = loadAssignment(c)
 		}
 
@@ -659,19 +952,42 @@ func (s *DiscoveryServer) pushEds(push *model.PushContext, con *XdsConnection,
 			l = filteredCLA
 		}
 
-		// Normalize LoadBalancingWeight in range [1, 128]
-		l.Endpoints = normalizeLoadBalancingWeight(l.Endpoints)
+		// Normalize LoadBalancingWeight in range [1, max], where max depends on
+		// the ceiling the proxy version is known to accept.
+		// Push-time plugins may replace or veto the assignment for this proxy.
+		// They run before weight normalization so plugins adjusting locality
+		// weights still get a normalized result.
+		if len(s.pushPlugins) > 0 {
+			var ok bool
+			if l, ok = s.applyEdsPushPlugins(con, l); !ok {
+				continue
+			}
+		}
+
+		l.Endpoints = normalizeLoadBalancingWeight(l.Endpoints, maxLoadBalancingWeightFor(con))
 
 		endpoints += len(l.Endpoints)
 		if len(l.Endpoints) == 0 {
 			emptyClusters++
 			empty = append(empty, clusterName)
+			if pilot.OmitEmptyClusters {
+				// Only omit clusters that never had endpoints. A cluster that
+				// lost all its endpoints must still get an explicit empty
+				// assignment, otherwise Envoy would retain the stale ones.
+				c.mutex.Lock()
+				everNonEmpty := !c.NonEmptyTime.IsZero()
+				c.mutex.Unlock()
+				if !everNonEmpty {
+					continue
+				}
+			}
 		}
 
 		// Previously computed load assignments. They are re-computed on cache invalidation or
 		// event, but don't have to be recomputed once for each sidecar.
 		clAssignmentRes, _ := types.MarshalAny(l)
 		resAny = append(resAny, *clAssignmentRes)
+		recordServicePushBytes(string(hostname), len(clAssignmentRes.Value))
 	}
 
 	response := s.endpoints(con.Clusters, resAny)
@@ -694,27 +1010,34 @@ func (s *DiscoveryServer) pushEds(push *model.PushContext, con *XdsConnection,
 }
 
 // addEdsCon will track the eds connection with clusters, for optimized event-based push and debug
-func (s *DiscoveryServer) addEdsCon(clusterName string, node string, connection *XdsConnection) {
+func (s *DiscoveryServer) addEdsCon(clusterName string, conID string, connection *XdsConnection) {
 
 	c := s.getOrAddEdsCluster(clusterName)
 	// TODO: left the code here so we can skip sending the already-sent clusters.
 	// See comments in ads - envoy keeps adding one cluster to the list (this seems new
 	// previous version sent all the clusters from CDS in bulk).
-
-	//c.mutex.Lock()
-	//existing := c.EdsClients[node]
-	//c.mutex.Unlock()
-	//
-	//// May replace an existing connection: this happens when Envoy adds more clusters
-	//// one by one, creating new grpc requests each time it adds one more cluster.
-	//if existing != nil {
-	//	log.Warnf("Replacing existing connection %s %s old: %s", clusterName, node, existing.ConID)
-	//}
 	c.mutex.Lock()
-	c.EdsClients[node] = connection
+	c.EdsClients[conID] = connection
 	c.mutex.Unlock()
 }
 
+// clientsByNode groups the connections watching the cluster by node ID. It is
+// used for debugging - during a hot restart a node will show two connections.
+// Caller must hold c.mutex.
+func (c *EdsCluster) clientsByNode() map[string][]string {
+	byNode := map[string][]string{}
+	for conID, con := range c.EdsClients {
+		node := ""
+		con.mu.RLock()
+		if con.modelNode != nil {
+			node = con.modelNode.ID
+		}
+		con.mu.RUnlock()
+		byNode[node] = append(byNode[node], conID)
+	}
+	return byNode
+}
+
 // getEdsCluster returns a cluster.
 func (s *DiscoveryServer) getEdsCluster(clusterName string) *EdsCluster {
 	// separate method only to have proper lock.
@@ -735,12 +1058,14 @@ func (s *DiscoveryServer) getOrAddEdsCluster(clusterName string) *EdsCluster {
 		}
 		edsClusters[clusterName] = c
 	}
+	// The cluster is watched (again) - cancel any pending idle GC.
+	c.idleSince = time.Time{}
 	return c
 }
 
 // removeEdsCon is called when a gRPC stream is closed, for each cluster that was watched by the
 // stream. As of 0.7 envoy watches a single cluster per gprc stream.
-func (s *DiscoveryServer) removeEdsCon(clusterName string, node string, connection *XdsConnection) {
+func (s *DiscoveryServer) removeEdsCon(clusterName string, conID string, connection *XdsConnection) {
 	c := s.getEdsCluster(clusterName)
 	if c == nil {
 		adsLog.Warnf("EDS: missing cluster %s", clusterName)
@@ -750,56 +1075,86 @@ func (s *DiscoveryServer) removeEdsCon(clusterName string, node string, connecti
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
-	oldcon := c.EdsClients[node]
+	oldcon := c.EdsClients[conID]
 	if oldcon == nil {
-		adsLog.Warnf("EDS: Envoy restart %s %v, cleanup old connection missing %v", node, connection.PeerAddr, c.EdsClients)
+		// The watch was already removed - for example a new cluster list replaced it
+		// before the stream closed.
+		adsLog.Warnf("EDS: connection %s %v already removed from %s, watchers %v", conID, connection.PeerAddr,
+			clusterName, c.clientsByNode())
 		return
 	}
 	if oldcon != connection {
-		adsLog.Infof("EDS: Envoy restart %s %v, cleanup old connection %v", node, connection.PeerAddr, oldcon.PeerAddr)
+		adsLog.Warnf("EDS: connection %s %v mismatch on %s, not removing %v", conID, connection.PeerAddr,
+			clusterName, oldcon.PeerAddr)
 		return
 	}
-	delete(c.EdsClients, node)
+	delete(c.EdsClients, conID)
 	if len(c.EdsClients) == 0 {
 		edsClusterMutex.Lock()
 		defer edsClusterMutex.Unlock()
 		// This happens when a previously used cluster is no longer watched by any
 		// sidecar. It should not happen very often - normally all clusters are sent
 		// in CDS requests to all sidecars. It may happen if all connections are closed.
-		adsLog.Debugf("EDS: remove unwatched cluster node=%s cluster=%s", node, clusterName)
-		delete(edsClusters, clusterName)
+		if edsIdleTimeout == 0 {
+			adsLog.Debugf("EDS: remove unwatched cluster conID=%s cluster=%s", conID, clusterName)
+			delete(edsClusters, clusterName)
+			return
+		}
+		// Keep the precomputed assignment for a while, so the cluster doesn't
+		// have to be recomputed if the proxy reconnects shortly.
+		adsLog.Debugf("EDS: cluster %s idle, GC in %v", clusterName, edsIdleTimeout)
+		c.idleSince = time.Now()
+		time.AfterFunc(edsIdleTimeout, func() { evictIdleCluster(clusterName) })
+		evictIdleOverflowLocked()
 	}
 }
 
-// FetchEndpoints implements xdsapi.EndpointDiscoveryServiceServer.FetchEndpoints().
-func (s *DiscoveryServer) FetchEndpoints(ctx context.Context, req *xdsapi.DiscoveryRequest) (*xdsapi.DiscoveryResponse, error) {
-	return nil, errors.New("not implemented")
-}
-
-// StreamLoadStats implements xdsapi.EndpointDiscoveryServiceServer.StreamLoadStats().
-func (s *DiscoveryServer) StreamLoadStats(xdsapi.EndpointDiscoveryService_StreamEndpointsServer) error {
-	return errors.New("unsupported streaming method")
+// evictIdleCluster deletes a cluster that has been idle for at least the idle
+// timeout. A no-op if the cluster gained a watcher in the meantime.
+func evictIdleCluster(clusterName string) {
+	edsClusterMutex.Lock()
+	defer edsClusterMutex.Unlock()
+	c := edsClusters[clusterName]
+	if c == nil || c.idleSince.IsZero() || time.Since(c.idleSince) < edsIdleTimeout {
+		return
+	}
+	adsLog.Debugf("EDS: removing idle cluster %s after %v", clusterName, time.Since(c.idleSince))
+	delete(edsClusters, clusterName)
+	edsIdleEvictions.With(prometheus.Labels{"reason": "ttl"}).Add(1)
 }
 
-// normalizeLoadBalancingWeight set LoadBalancingWeight with a valid value.
-func normalizeLoadBalancingWeight(endpoints []endpoint.LocalityLbEndpoints) []endpoint.LocalityLbEndpoints {
-	var totalLbEndpointsNum uint32
-
-	for _, localityLbEndpoint := range endpoints {
-		totalLbEndpointsNum += localityLbEndpoint.GetLoadBalancingWeight().GetValue()
-	}
-	if totalLbEndpointsNum == 0 {
-		return endpoints
+// evictIdleOverflowLocked evicts the oldest idle clusters when more than
+// edsMaxIdleClusters are retained. Caller must hold edsClusterMutex.
+func evictIdleOverflowLocked() {
+	idle := 0
+	for _, c := range edsClusters {
+		if !c.idleSince.IsZero() {
+			idle++
+		}
 	}
-
-	out := make([]endpoint.LocalityLbEndpoints, len(endpoints))
-	for i, localityLbEndpoint := range endpoints {
-		weight := float64(localityLbEndpoint.GetLoadBalancingWeight().GetValue()*maxLoadBalancingWeight) / float64(totalLbEndpointsNum)
-		localityLbEndpoint.LoadBalancingWeight = &types.UInt32Value{
-			Value: uint32(math.Ceil(weight)),
+	for ; idle > edsMaxIdleClusters; idle-- {
+		oldestName := ""
+		var oldest time.Time
+		for name, c := range edsClusters {
+			if c.idleSince.IsZero() {
+				continue
+			}
+			if oldestName == "" || c.idleSince.Before(oldest) {
+				oldestName = name
+				oldest = c.idleSince
+			}
 		}
-		out[i] = localityLbEndpoint
+		if oldestName == "" {
+			return
+		}
+		adsLog.Infof("EDS: evicting idle cluster %s, %d retained", oldestName, idle-1)
+		delete(edsClusters, oldestName)
+		edsIdleEvictions.With(prometheus.Labels{"reason": "overflow"}).Add(1)
 	}
+}
 
-	return out
+// FetchEndpoints implements xdsapi.EndpointDiscoveryServiceServer.FetchEndpoints().
+func (s *DiscoveryServer) FetchEndpoints(ctx context.Context, req *xdsapi.DiscoveryRequest) (*xdsapi.DiscoveryResponse, error) {
+	return nil, errors.New("not implemented")
 }
+
@@ -0,0 +1,89 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+// benchDiscoveryServer builds a minimal server for update benchmarks: no
+// gRPC, no registries, pushes drained by a stub consumer.
+func benchDiscoveryServer() (*DiscoveryServer, func()) {
+	s := &DiscoveryServer{
+		Env:                     &model.Environment{PushContext: model.NewPushContext()},
+		EndpointShardsByService: map[string]*EndpointShardsByService{},
+		WorkloadsByID:           map[string]*Workload{},
+		edsUpdates:              map[string]*EndpointShardsByService{},
+		ipIndex:                 map[string]map[string]IPWorkload{},
+		updateChannel:           make(chan *updateReq, 10),
+	}
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-s.updateChannel:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return s, func() { close(stop) }
+}
+
+func benchEndpoints(n int) []*model.IstioEndpoint {
+	out := make([]*model.IstioEndpoint, 0, n)
+	for i := 0; i < n; i++ {
+		out = append(out, &model.IstioEndpoint{
+			Family:          model.AddressFamilyTCP,
+			Address:         fmt.Sprintf("10.%d.%d.%d", i/65536, (i/256)%256, i%256),
+			EndpointPort:    8080,
+			ServicePortName: "http",
+			UID:             fmt.Sprintf("kubernetes://pod-%d.bench", i),
+		})
+	}
+	return out
+}
+
+// BenchmarkEdsUpdateParallel measures shard updates for distinct services
+// running concurrently - the path the per-service shard locks unblock.
+func BenchmarkEdsUpdateParallel(b *testing.B) {
+	s, stop := benchDiscoveryServer()
+	defer stop()
+	var svcID int32
+	b.RunParallel(func(pb *testing.PB) {
+		svc := fmt.Sprintf("bench%d.svc.cluster.local", atomic.AddInt32(&svcID, 1))
+		entries := benchEndpoints(100)
+		for pb.Next() {
+			s.edsUpdate("shard1", svc, entries, true)
+		}
+	})
+}
+
+// BenchmarkEdsUpdateSingleService is the fully contended case: every update
+// targets the same service and serializes on its lock.
+func BenchmarkEdsUpdateSingleService(b *testing.B) {
+	s, stop := benchDiscoveryServer()
+	defer stop()
+	entries := benchEndpoints(100)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			s.edsUpdate("shard1", "bench.svc.cluster.local", entries, true)
+		}
+	})
+}
@@ -0,0 +1,76 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"testing"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+// TestEdsClusterHotRestartOverlap verifies cluster watch tracking when a node
+// has two live connections for the same cluster, as happens during an Envoy
+// hot restart when the old and the new Envoy briefly overlap.
+func TestEdsClusterHotRestartOverlap(t *testing.T) {
+	s := &DiscoveryServer{}
+	const clusterName = "outbound|8080||hotrestart.test.svc.cluster.local"
+	const nodeID = "sidecar~10.1.1.1~hotrestart-64435bc4-x8jg5.test~test.svc.cluster.local"
+
+	oldCon := newXdsConnection("10.1.1.1:1111", nil)
+	oldCon.ConID = connectionID(nodeID)
+	oldCon.modelNode = &model.Proxy{ID: nodeID}
+
+	newCon := newXdsConnection("10.1.1.1:2222", nil)
+	newCon.ConID = connectionID(nodeID)
+	newCon.modelNode = &model.Proxy{ID: nodeID}
+
+	if oldCon.ConID == newCon.ConID {
+		t.Fatalf("expected distinct connection IDs, got %s twice", oldCon.ConID)
+	}
+
+	s.addEdsCon(clusterName, oldCon.ConID, oldCon)
+	s.addEdsCon(clusterName, newCon.ConID, newCon)
+
+	c := s.getEdsCluster(clusterName)
+	if c == nil {
+		t.Fatalf("cluster %s not tracked", clusterName)
+	}
+	c.mutex.Lock()
+	if len(c.EdsClients) != 2 {
+		t.Errorf("expected 2 watching connections, got %d", len(c.EdsClients))
+	}
+	if got := len(c.clientsByNode()[nodeID]); got != 2 {
+		t.Errorf("expected 2 connections grouped under %s, got %d", nodeID, got)
+	}
+	c.mutex.Unlock()
+
+	// The old Envoy drains: the cluster must survive for the new connection.
+	s.removeEdsCon(clusterName, oldCon.ConID, oldCon)
+	c = s.getEdsCluster(clusterName)
+	if c == nil {
+		t.Fatalf("cluster %s was GCed while still watched by %s", clusterName, newCon.ConID)
+	}
+	c.mutex.Lock()
+	if _, f := c.EdsClients[newCon.ConID]; !f {
+		t.Errorf("connection %s lost its watch on %s", newCon.ConID, clusterName)
+	}
+	c.mutex.Unlock()
+
+	// Last watcher disconnects - now the cluster can be GCed.
+	s.removeEdsCon(clusterName, newCon.ConID, newCon)
+	if c = s.getEdsCluster(clusterName); c != nil {
+		t.Errorf("cluster %s not removed after last watcher disconnected", clusterName)
+	}
+}
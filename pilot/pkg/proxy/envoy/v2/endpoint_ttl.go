@@ -0,0 +1,85 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"istio.io/istio/pkg/features/pilot"
+)
+
+// Push-only registries (webhooks, MCP feeds) may miss delete events, leaving
+// stale endpoints in the shards forever. When PILOT_ENDPOINT_TTL is set, a
+// shard that is not refreshed within the TTL is expired and an incremental
+// push removes its endpoints.
+
+var (
+	// endpointTTL is the shard expiry window, zero disables expiry.
+	endpointTTL time.Duration
+
+	endpointShardsExpired = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "pilot_xds_endpoint_shards_expired",
+		Help: "Endpoint shards expired because the registry did not refresh them within PILOT_ENDPOINT_TTL.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(endpointShardsExpired)
+	endpointTTL = envDuration(pilot.EndpointTTL, 0)
+}
+
+// periodicEndpointExpiry expires stale shards. Started only when a TTL is configured.
+func (s *DiscoveryServer) periodicEndpointExpiry() {
+	interval := endpointTTL / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.expireEndpointShards()
+	}
+}
+
+// expireEndpointShards removes shards not refreshed within the TTL and
+// requests an incremental push for the affected services.
+func (s *DiscoveryServer) expireEndpointShards() {
+	changed := false
+	s.mutex.Lock()
+	for svc, ep := range s.EndpointShardsByService {
+		ep.mutex.Lock()
+		for shard, es := range ep.Shards {
+			if es.LastUpdate.IsZero() || time.Since(es.LastUpdate) <= endpointTTL {
+				continue
+			}
+			adsLog.Infof("EDS: expiring shard %s of %s, %d endpoints not refreshed for %v",
+				shard, svc, len(es.Entries), time.Since(es.LastUpdate))
+			delete(ep.Shards, shard)
+			ep.epoch++
+			s.updateIPIndexLocked(svc, shard, nil)
+			s.deleteShardStore(svc, shard)
+			endpointShardsExpired.Add(1)
+			s.edsUpdates[svc] = ep
+			changed = true
+		}
+		ep.mutex.Unlock()
+	}
+	s.mutex.Unlock()
+	if changed {
+		s.ConfigUpdate(false)
+	}
+}
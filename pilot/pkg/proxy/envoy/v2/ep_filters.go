@@ -17,6 +17,7 @@ package v2
 import (
 	"net"
 
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
 	"github.com/envoyproxy/go-control-plane/envoy/api/v2/endpoint"
 	"github.com/gogo/protobuf/types"
 
@@ -50,6 +51,11 @@ func EndpointsByNetworkFilter(endpoints []endpoint.LocalityLbEndpoints, conn *Xd
 	// Weight (number of endpoints) for the EDS cluster for each remote networks
 	remoteEps := map[string]uint32{}
 
+	// Locality of the replaced endpoints per remote network, so the synthesized
+	// gateway endpoint keeps a locality instead of appearing locality-less to
+	// locality weighting and failover
+	remoteLocality := map[string]*core.Locality{}
+
 	// Go through all cluster endpoints and add those with the same network as the sidecar
 	// to the result. Also count the number of endpoints per each remote network while
 	// iterating so that it can be used as the weight for the gateway endpoint
@@ -70,6 +76,9 @@ func EndpointsByNetworkFilter(endpoints []endpoint.LocalityLbEndpoints, conn *Xd
 				// Remote endpoint. Increase the weight counter
 				remoteEps[epNetwork]++
 				foundRemote = true
+				if remoteLocality[epNetwork] == nil && ep.Locality != nil {
+					remoteLocality[epNetwork] = ep.Locality
+				}
 			}
 		}
 
@@ -138,8 +147,17 @@ func EndpointsByNetworkFilter(endpoints []endpoint.LocalityLbEndpoints, conn *Xd
 			continue
 		}
 
+		// The gateway endpoint stands in for the remote endpoints, so it gets
+		// their locality. If the remote endpoints had none, the network name
+		// is used as the region - still distinguishable from local endpoints.
+		locality := remoteLocality[n]
+		if locality == nil {
+			locality = &core.Locality{Region: n}
+		}
+
 		// Create the gateway endpoint and add it to the CLA
 		gwLocEp := endpoint.LocalityLbEndpoints{
+			Locality:    locality,
 			LbEndpoints: gwEndpoints,
 			LoadBalancingWeight: &types.UInt32Value{
 				Value: uint32(w),
@@ -181,6 +181,46 @@ func TestEndpointsByNetworkFilter(t *testing.T) {
 	}
 }
 
+func TestGatewayEndpointLocality(t *testing.T) {
+	env := environment()
+
+	// The test endpoints carry no locality, so the synthesized gateway
+	// endpoint falls back to the remote network name as region.
+	filtered := EndpointsByNetworkFilter(testEndpoints(), xdsConnection("network1"), env)
+	var gwEp *endpoint.LocalityLbEndpoints
+	for i := range filtered {
+		addr := filtered[i].LbEndpoints[0].Endpoint.Address.GetSocketAddress().Address
+		if addr == "2.2.2.2" {
+			gwEp = &filtered[i]
+		}
+	}
+	if gwEp == nil {
+		t.Fatalf("no gateway endpoint for network2 in %v", filtered)
+	}
+	if gwEp.Locality == nil || gwEp.Locality.Region != "network2" {
+		t.Errorf("gateway endpoint locality = %v, want region network2", gwEp.Locality)
+	}
+
+	// When the replaced remote endpoints have a locality, the gateway
+	// endpoint inherits it.
+	eps := testEndpoints()
+	eps[0].Locality = &core.Locality{Region: "us-east1", Zone: "us-east1-b"}
+	filtered = EndpointsByNetworkFilter(eps, xdsConnection("network1"), env)
+	gwEp = nil
+	for i := range filtered {
+		addr := filtered[i].LbEndpoints[0].Endpoint.Address.GetSocketAddress().Address
+		if addr == "2.2.2.2" {
+			gwEp = &filtered[i]
+		}
+	}
+	if gwEp == nil {
+		t.Fatalf("no gateway endpoint for network2 in %v", filtered)
+	}
+	if gwEp.Locality == nil || gwEp.Locality.Region != "us-east1" || gwEp.Locality.Zone != "us-east1-b" {
+		t.Errorf("gateway endpoint locality = %v, want us-east1/us-east1-b", gwEp.Locality)
+	}
+}
+
 func xdsConnection(network string) *XdsConnection {
 	var metadata map[string]string
 	if network != "" {
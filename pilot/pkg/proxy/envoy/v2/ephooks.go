@@ -0,0 +1,103 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/endpoint"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// In overlay networks the pod IP a registry reports is not routable from
+// other nodes - traffic has to go through the node's tunnel address instead.
+// Endpoint build hooks let network plugins rewrite or annotate each
+// LbEndpoint as it is built, before it is cached, so EDS emits addresses
+// that are actually reachable.
+
+// TunnelAddressLabel carries the reachable "ip:port" for a workload whose
+// pod IP is not routable across nodes. Set by the CNI plugin or the
+// registry; consumed by the built-in tunnel hook.
+const TunnelAddressLabel = "istio.io/tunnelAddress"
+
+// EndpointBuildHook can mutate an LbEndpoint just after it is built from the
+// registry data. Hooks run in registration order and must be registered
+// before the discovery server starts serving.
+type EndpointBuildHook func(lbEp *endpoint.LbEndpoint, labels map[string]string, network string)
+
+var (
+	endpointBuildHooks []EndpointBuildHook
+
+	tunneledEndpoints = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "pilot_eds_tunneled_endpoints",
+		Help: "Endpoints rewritten to their tunnel address.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(tunneledEndpoints)
+	RegisterEndpointBuildHook(tunnelAddressHook)
+}
+
+// RegisterEndpointBuildHook adds a hook applied to every endpoint as it is
+// built.
+func RegisterEndpointBuildHook(hook EndpointBuildHook) {
+	endpointBuildHooks = append(endpointBuildHooks, hook)
+}
+
+// applyEndpointBuildHooks runs the registered hooks on a freshly built
+// endpoint. It is called wherever endpoints are converted from registry
+// data, before the result is cached.
+func applyEndpointBuildHooks(lbEp *endpoint.LbEndpoint, labels map[string]string, network string) {
+	for _, hook := range endpointBuildHooks {
+		hook(lbEp, labels, network)
+	}
+}
+
+// tunnelAddressHook is the built-in hook for label-driven overlays: when the
+// tunnel address label is present, the endpoint's socket address is replaced
+// with it. A malformed label leaves the endpoint untouched - an unreachable
+// pod IP is no worse than before, and easier to debug than a dropped
+// endpoint.
+func tunnelAddressHook(lbEp *endpoint.LbEndpoint, labels map[string]string, network string) {
+	tunnel := labels[TunnelAddressLabel]
+	if tunnel == "" {
+		return
+	}
+	host, portStr, err := net.SplitHostPort(tunnel)
+	if err != nil {
+		adsLog.Warnf("EDS: malformed %s label %q: %v", TunnelAddressLabel, tunnel, err)
+		return
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		adsLog.Warnf("EDS: malformed port in %s label %q: %v", TunnelAddressLabel, tunnel, err)
+		return
+	}
+	if lbEp.Endpoint == nil || lbEp.Endpoint.Address == nil {
+		return
+	}
+	sa := lbEp.Endpoint.Address.GetSocketAddress()
+	if sa == nil {
+		return
+	}
+	sa.Address = host
+	sa.PortSpecifier = &core.SocketAddress_PortValue{
+		PortValue: uint32(port),
+	}
+	tunneledEndpoints.Add(1)
+}
@@ -0,0 +1,46 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"testing"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+func TestTunnelAddressHook(t *testing.T) {
+	cases := []struct {
+		name     string
+		labels   map[string]string
+		wantAddr string
+		wantPort uint32
+	}{
+		{"no label keeps pod address", nil, "10.1.0.5", 8080},
+		{"label rewrites to tunnel", map[string]string{TunnelAddressLabel: "192.168.0.10:4789"}, "192.168.0.10", 4789},
+		{"malformed label leaves endpoint untouched", map[string]string{TunnelAddressLabel: "not-an-address"}, "10.1.0.5", 8080},
+		{"malformed port leaves endpoint untouched", map[string]string{TunnelAddressLabel: "192.168.0.10:vxlan"}, "10.1.0.5", 8080},
+	}
+	for _, c := range cases {
+		lbEp := buildEnvoyLbEndpoint("uid", model.AddressFamilyTCP, "10.1.0.5", 8080, "")
+		tunnelAddressHook(lbEp, c.labels, "")
+		sa := lbEp.Endpoint.Address.GetSocketAddress()
+		if sa.Address != c.wantAddr {
+			t.Errorf("%s: address = %s, want %s", c.name, sa.Address, c.wantAddr)
+		}
+		if sa.GetPortValue() != c.wantPort {
+			t.Errorf("%s: port = %d, want %d", c.name, sa.GetPortValue(), c.wantPort)
+		}
+	}
+}
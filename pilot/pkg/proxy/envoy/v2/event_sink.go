@@ -0,0 +1,99 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Discovery anomalies - a service with no instances, a proxy NACKing its
+// config, endpoints ejected by outlier detection - today only surface in
+// Pilot logs and metrics. A DiscoveryEventSink forwards them to a platform
+// channel; the Kubernetes registry registers one that posts Events on the
+// affected Service, so the problems show up in kubectl describe.
+
+// Anomaly reasons emitted by the xDS server.
+const (
+	AnomalyNoInstances   = "ClusterNoInstances"
+	AnomalyConfigNACKed  = "ConfigNACKed"
+	AnomalyEndpointEject = "EndpointEjected"
+)
+
+// DiscoveryEventSink receives discovery anomalies.
+type DiscoveryEventSink interface {
+	// Anomaly is called with the reason (one of the Anomaly constants), the
+	// service hostname the anomaly concerns (may be empty for proxy-scoped
+	// anomalies) and a human-readable message. Implementations must not
+	// block: they are called on push paths.
+	Anomaly(reason, hostname, message string)
+}
+
+var (
+	eventSinkMutex sync.Mutex
+	eventSinks     []DiscoveryEventSink
+
+	// anomalyLastEmitted rate-limits per reason and hostname, so a flapping
+	// service does not storm the platform's event channel.
+	anomalyLastEmitted = map[string]time.Time{}
+
+	anomalyEmitted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pilot_discovery_anomalies",
+		Help: "Discovery anomalies forwarded to event sinks.",
+	}, []string{"reason"})
+)
+
+// anomalyRateLimit is the minimum interval between identical anomalies.
+const anomalyRateLimit = 5 * time.Minute
+
+func init() {
+	prometheus.MustRegister(anomalyEmitted)
+}
+
+// RegisterDiscoveryEventSink adds a sink for discovery anomalies.
+func RegisterDiscoveryEventSink(sink DiscoveryEventSink) {
+	eventSinkMutex.Lock()
+	eventSinks = append(eventSinks, sink)
+	eventSinkMutex.Unlock()
+}
+
+// emitAnomaly forwards an anomaly to the registered sinks, rate-limited per
+// reason and hostname.
+func emitAnomaly(reason, hostname, message string) {
+	if reason == AnomalyConfigNACKed {
+		recordNACKForAlerting(message)
+	}
+	eventSinkMutex.Lock()
+	if len(eventSinks) == 0 {
+		eventSinkMutex.Unlock()
+		return
+	}
+	key := reason + "/" + hostname
+	if last, f := anomalyLastEmitted[key]; f && time.Since(last) < anomalyRateLimit {
+		eventSinkMutex.Unlock()
+		return
+	}
+	anomalyLastEmitted[key] = time.Now()
+	sinks := make([]DiscoveryEventSink, len(eventSinks))
+	copy(sinks, eventSinks)
+	eventSinkMutex.Unlock()
+
+	anomalyEmitted.With(prometheus.Labels{"reason": reason}).Add(1)
+	for _, sink := range sinks {
+		sink.Anomaly(reason, hostname, message)
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/features/pilot"
+)
+
+// Organizations with their own service inventory pipeline can put a message
+// bus between it and Pilot. With PILOT_EVENT_BUS set, every shard update a
+// registry applies is also published as a normalized event, and events
+// consumed from the bus drive EDS through the standard edsUpdate path - so
+// the inventory pipeline neither links Pilot nor speaks xDS.
+//
+// Like shard stores, backends (NATS, Kafka, ...) live out of tree and
+// register a factory by scheme. A backend must not echo this replica's own
+// publications back to it - brokers and client libraries all have a native
+// way to express that, and doing it here would mean tagging every event.
+// Consumed events are applied as internal updates: they are not written to
+// the shard store and not re-published.
+
+// EndpointEvent is one normalized endpoint change on the bus: the full new
+// contents of one shard of one service, exactly the unit edsUpdate applies.
+type EndpointEvent struct {
+	Service   string
+	Shard     string
+	Endpoints []*model.IstioEndpoint
+}
+
+// EventBus connects Pilot to a message bus.
+type EventBus interface {
+	// Name returns the backend name, for logging.
+	Name() string
+
+	// Publish sends one event. Called on the update path - implementations
+	// must buffer or drop rather than block.
+	Publish(*EndpointEvent) error
+
+	// Subscribe delivers inbound events to the handler until the server
+	// exits. Implementations own reconnection.
+	Subscribe(handler func(*EndpointEvent)) error
+}
+
+// EventBusFactory creates an EventBus for the address part of
+// PILOT_EVENT_BUS (the text after "scheme://").
+type EventBusFactory func(address string) (EventBus, error)
+
+var eventBusFactories = map[string]EventBusFactory{}
+
+var eventBusEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "pilot_event_bus_events",
+	Help: "Endpoint events exchanged with the message bus, by direction (published, consumed, publish_error).",
+}, []string{"direction"})
+
+func init() {
+	prometheus.MustRegister(eventBusEvents)
+}
+
+// RegisterEventBus registers a bus backend under a scheme, e.g. "nats".
+// Called from init() of the backend's package.
+func RegisterEventBus(scheme string, factory EventBusFactory) {
+	eventBusFactories[scheme] = factory
+}
+
+// openEventBus opens the backend selected by PILOT_EVENT_BUS, or returns
+// nil if none is configured.
+func openEventBus() (EventBus, error) {
+	if pilot.EventBus == "" {
+		return nil, nil
+	}
+	parts := strings.SplitN(pilot.EventBus, "://", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("PILOT_EVENT_BUS must be scheme://address, got %q", pilot.EventBus)
+	}
+	factory, f := eventBusFactories[parts[0]]
+	if !f {
+		return nil, fmt.Errorf("unknown event bus backend %q", parts[0])
+	}
+	return factory(parts[1])
+}
+
+// publishEndpointEvent mirrors an applied shard update to the bus, if one is
+// configured. Errors are counted and logged but never block the update.
+func (s *DiscoveryServer) publishEndpointEvent(serviceName, shard string, entries []*model.IstioEndpoint) {
+	if s.eventBus == nil {
+		return
+	}
+	err := s.eventBus.Publish(&EndpointEvent{Service: serviceName, Shard: shard, Endpoints: entries})
+	if err != nil {
+		eventBusEvents.With(prometheus.Labels{"direction": "publish_error"}).Add(1)
+		adsLog.Warnf("EDS: event bus %s publish %s/%s: %v", s.eventBus.Name(), serviceName, shard, err)
+		return
+	}
+	eventBusEvents.With(prometheus.Labels{"direction": "published"}).Add(1)
+}
+
+// consumeEndpointEvents subscribes to the bus and drives consumed events
+// through edsUpdate.
+func (s *DiscoveryServer) consumeEndpointEvents() {
+	err := s.eventBus.Subscribe(func(ev *EndpointEvent) {
+		if ev.Service == "" || ev.Shard == "" {
+			return
+		}
+		eventBusEvents.With(prometheus.Labels{"direction": "consumed"}).Add(1)
+		s.edsUpdate(ev.Shard, ev.Service, ev.Endpoints, true)
+	})
+	if err != nil {
+		adsLog.Errorf("EDS: event bus %s subscribe: %v", s.eventBus.Name(), err)
+	}
+}
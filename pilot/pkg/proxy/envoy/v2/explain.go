@@ -0,0 +1,212 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+// "Why doesn't this proxy see that endpoint" currently takes four debug
+// endpoints and a mental replay of the EDS pipeline. /debug/explain walks
+// the same decisions updateClusterInc makes for one proxy and one cluster -
+// which shards contributed, which endpoints were dropped and by which check,
+// what locality weights result - and says explicitly why the set is empty
+// when it is.
+
+// EndpointExplanation is the verdict for one endpoint of the cluster.
+type EndpointExplanation struct {
+	Address  string `json:"address"`
+	Port     uint32 `json:"port"`
+	Shard    string `json:"shard"`
+	Verdict  string `json:"verdict"` // pushed | filtered
+	Reason   string `json:"reason,omitempty"`
+	Locality string `json:"locality,omitempty"`
+	Health   string `json:"health,omitempty"`
+}
+
+// ClusterExplanation ties the whole derivation together for one proxy and
+// one cluster.
+type ClusterExplanation struct {
+	Proxy   string `json:"proxy"`
+	Cluster string `json:"cluster"`
+
+	Hostname     string                 `json:"hostname,omitempty"`
+	PortName     string                 `json:"portName,omitempty"`
+	SubsetLabels model.LabelsCollection `json:"subsetLabels,omitempty"`
+	ProxyNetwork string                 `json:"proxyNetwork,omitempty"`
+
+	// Shards lists the registries contributing endpoints, with their sizes.
+	Shards map[string]int `json:"shards,omitempty"`
+
+	Endpoints []*EndpointExplanation `json:"endpoints,omitempty"`
+
+	// LocalityWeights is the number of pushed endpoints per locality, which
+	// is the load-balancing weight of each locality group.
+	LocalityWeights map[string]int `json:"localityWeights,omitempty"`
+
+	// Notes carries cluster-level findings: wildcard exclusion, unknown
+	// service, network filtering, why the set is empty.
+	Notes []string `json:"notes,omitempty"`
+}
+
+func (e *ClusterExplanation) note(format string, args ...interface{}) {
+	e.Notes = append(e.Notes, fmt.Sprintf(format, args...))
+}
+
+// explainCluster replays the EDS derivation for one proxy and cluster.
+func (s *DiscoveryServer) explainCluster(proxyID, clusterName string) *ClusterExplanation {
+	out := &ClusterExplanation{
+		Proxy:           proxyID,
+		Cluster:         clusterName,
+		Shards:          map[string]int{},
+		LocalityWeights: map[string]int{},
+	}
+
+	// The proxy's network decides split-horizon behavior. The proxy does not
+	// have to be connected - the derivation is still explainable, minus the
+	// network step.
+	proxyNetwork := ""
+	con := findProxyConnection(proxyID)
+	if con == nil {
+		out.note("proxy %s is not connected to this pilot; network filtering not evaluated", proxyID)
+	} else if con.modelNode != nil {
+		proxyNetwork = con.modelNode.Metadata["NETWORK"]
+		out.ProxyNetwork = proxyNetwork
+	}
+
+	_, subsetName, hostname, port, err := model.ParseSubsetKeyStrict(clusterName)
+	if err != nil {
+		out.note("malformed cluster name: %v", err)
+		return out
+	}
+	out.Hostname = string(hostname)
+
+	if strings.HasPrefix(string(hostname), "*") {
+		out.note("wildcard host: excluded from EDS, served by original-dst or SNI-based clusters")
+		return out
+	}
+
+	push := s.globalPushContext()
+	labels := push.SubsetToLabels(subsetName, hostname)
+	out.SubsetLabels = labels
+
+	portMap, f := push.ServicePort2Name[string(hostname)]
+	if !f {
+		out.note("service %s is not in the push context; the legacy instance lookup serves this cluster", hostname)
+		return out
+	}
+	svcPort, f := portMap.GetByPort(port)
+	if !f {
+		out.note("service %s has no port %d", hostname, port)
+		return out
+	}
+	out.PortName = svcPort.Name
+
+	s.mutex.RLock()
+	ep := s.EndpointShardsByService[string(hostname)]
+	s.mutex.RUnlock()
+	if ep == nil {
+		out.note("no endpoint shards for %s: no registry has reported endpoints", hostname)
+		return out
+	}
+
+	shards, _ := ep.snapshot()
+	pushed := 0
+	for shardName, es := range shards {
+		out.Shards[shardName] = len(es.Entries)
+		for _, el := range es.Entries {
+			ee := &EndpointExplanation{
+				Address: el.Address,
+				Port:    el.EndpointPort,
+				Shard:   shardName,
+			}
+			out.Endpoints = append(out.Endpoints, ee)
+
+			switch {
+			case svcPort.Name != el.ServicePortName:
+				ee.Verdict = "filtered"
+				ee.Reason = fmt.Sprintf("service port name %q does not match cluster port %q", el.ServicePortName, svcPort.Name)
+				continue
+			case !labels.HasSubsetOf(model.Labels(el.Labels)):
+				ee.Verdict = "filtered"
+				ee.Reason = fmt.Sprintf("labels %v do not match subset %q selector %v", el.Labels, subsetName, labels)
+				continue
+			case endpointDrained(el.Address, el.Labels):
+				ee.Verdict = "filtered"
+				ee.Reason = "administratively drained (label or /debug/drain)"
+				continue
+			}
+
+			ee.Verdict = "pushed"
+			loc := localityFromLabels(el.Labels)
+			ee.Locality = localityKey(&loc)
+			ee.Health = healthStatusFor(el.Address, el.Labels).String()
+			if proxyNetwork != "" && el.Network != "" && el.Network != proxyNetwork {
+				ee.Reason = fmt.Sprintf("on remote network %s: replaced by that network's gateway endpoint", el.Network)
+			}
+			out.LocalityWeights[ee.Locality]++
+			pushed++
+		}
+	}
+	sort.Slice(out.Endpoints, func(i, j int) bool {
+		if out.Endpoints[i].Shard != out.Endpoints[j].Shard {
+			return out.Endpoints[i].Shard < out.Endpoints[j].Shard
+		}
+		return out.Endpoints[i].Address < out.Endpoints[j].Address
+	})
+
+	if pushed == 0 {
+		if len(out.Endpoints) == 0 {
+			out.note("empty: the registries reported no endpoints at all for %s", hostname)
+		} else {
+			out.note("empty: all %d reported endpoints were filtered; see per-endpoint reasons", len(out.Endpoints))
+		}
+	}
+	return out
+}
+
+// findProxyConnection resolves either a connection ID or a node ID to a
+// connection.
+func findProxyConnection(proxyID string) *XdsConnection {
+	adsClientsMutex.RLock()
+	defer adsClientsMutex.RUnlock()
+	if con, f := adsClients[proxyID]; f {
+		return con
+	}
+	for _, con := range adsSidecarIDConnectionsMap[proxyID] {
+		return con
+	}
+	return nil
+}
+
+// explainz serves /debug/explain?proxy=<id>&cluster=<name>.
+func (s *DiscoveryServer) explainz(w http.ResponseWriter, req *http.Request) {
+	proxyID := req.URL.Query().Get("proxy")
+	clusterName := req.URL.Query().Get("cluster")
+	if proxyID == "" || clusterName == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("proxy and cluster parameters are required"))
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	b, _ := json.MarshalIndent(s.explainCluster(proxyID, clusterName), " ", " ")
+	_, _ = w.Write(b)
+}
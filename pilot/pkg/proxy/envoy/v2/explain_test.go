@@ -0,0 +1,74 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"strings"
+	"testing"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+func TestExplainCluster(t *testing.T) {
+	pc := model.NewPushContext()
+	pc.ServicePort2Name["web.ns"] = model.PortList{{Name: "http", Port: 80}}
+	s := &DiscoveryServer{
+		Env: &model.Environment{PushContext: pc},
+		EndpointShardsByService: map[string]*EndpointShardsByService{
+			"web.ns": {
+				Shards: map[string]*EndpointShard{
+					"k8s": {Shard: "k8s", Entries: []*model.IstioEndpoint{
+						{Address: "10.1.0.1", EndpointPort: 8080, ServicePortName: "http"},
+						{Address: "10.1.0.2", EndpointPort: 9090, ServicePortName: "grpc"},
+					}},
+				},
+			},
+		},
+	}
+
+	out := s.explainCluster("no-such-proxy", "outbound|80||web.ns")
+	if out.Hostname != "web.ns" || out.PortName != "http" {
+		t.Fatalf("got hostname %q port %q", out.Hostname, out.PortName)
+	}
+	if !strings.Contains(strings.Join(out.Notes, "\n"), "not connected") {
+		t.Errorf("missing not-connected note: %v", out.Notes)
+	}
+	if out.Shards["k8s"] != 2 || len(out.Endpoints) != 2 {
+		t.Fatalf("got shards %v, %d endpoints", out.Shards, len(out.Endpoints))
+	}
+	if out.Endpoints[0].Verdict != "pushed" {
+		t.Errorf("10.1.0.1: got %q/%q, want pushed", out.Endpoints[0].Verdict, out.Endpoints[0].Reason)
+	}
+	if out.Endpoints[1].Verdict != "filtered" || !strings.Contains(out.Endpoints[1].Reason, "port name") {
+		t.Errorf("10.1.0.2: got %q/%q, want filtered by port name", out.Endpoints[1].Verdict, out.Endpoints[1].Reason)
+	}
+	if len(out.LocalityWeights) != 1 {
+		t.Errorf("got locality weights %v, want one locality", out.LocalityWeights)
+	}
+}
+
+func TestExplainClusterNotes(t *testing.T) {
+	s := &DiscoveryServer{}
+
+	out := s.explainCluster("p", "not-a-cluster-name")
+	if !strings.Contains(strings.Join(out.Notes, "\n"), "malformed") {
+		t.Errorf("malformed cluster: got notes %v", out.Notes)
+	}
+
+	out = s.explainCluster("p", "outbound|443||*.example.com")
+	if !strings.Contains(strings.Join(out.Notes, "\n"), "wildcard") {
+		t.Errorf("wildcard host: got notes %v", out.Notes)
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"istio.io/istio/pilot/pkg/model"
+	istioversion "istio.io/istio/pkg/version"
+)
+
+// Blue-green control plane migration: before cutting proxies over to a new
+// Pilot (different version or cluster), the operator exports the normalized
+// service+endpoint state from the old one, imports it into the new one for
+// pre-warming, and compares what the two builds derived from the same
+// registries. The export is a stable, sorted JSON document so two dumps of
+// identical state diff clean.
+//
+//	GET  /debug/export  - the normalized state of this Pilot
+//	POST /debug/import  - pre-warm this Pilot from another's export
+//	POST /debug/compare - report differences against another's export
+
+// ExportedState is the portable dump of one Pilot's endpoint state.
+type ExportedState struct {
+	// Version identifies the build that produced the export.
+	Version string
+
+	ExportedAt time.Time
+
+	// Services maps service name to its exported shards.
+	Services map[string]*ExportedService
+}
+
+// ExportedService is the normalized state of one service.
+type ExportedService struct {
+	// Shards maps shard (registry) name to its endpoints, sorted by
+	// address, port and service port name. Cached Envoy structures are
+	// stripped - only registry-derived data is portable.
+	Shards map[string][]*model.IstioEndpoint
+
+	ServiceAccounts []string
+}
+
+// ExportCompareReport describes how another Pilot's state differs from this
+// one's.
+type ExportCompareReport struct {
+	LocalVersion  string
+	RemoteVersion string
+
+	// OnlyLocal and OnlyRemote list services present on one side only.
+	OnlyLocal  []string `json:",omitempty"`
+	OnlyRemote []string `json:",omitempty"`
+
+	// Changed maps services present on both sides to their endpoint-level
+	// differences, formatted as "address:port/servicePortName".
+	Changed map[string]*ServiceDiff `json:",omitempty"`
+}
+
+// ServiceDiff lists the endpoints one side has and the other does not.
+type ServiceDiff struct {
+	OnlyLocal  []string `json:",omitempty"`
+	OnlyRemote []string `json:",omitempty"`
+}
+
+// exportEndpoint strips the non-portable fields from an endpoint.
+func exportEndpoint(e *model.IstioEndpoint) *model.IstioEndpoint {
+	out := *e
+	out.EnvoyEndpoint = nil
+	return &out
+}
+
+// exportKey is the identity of an endpoint within a service, used for both
+// sorting and comparison.
+func exportKey(e *model.IstioEndpoint) string {
+	return fmt.Sprintf("%s:%d/%s", e.Address, e.EndpointPort, e.ServicePortName)
+}
+
+// exportState builds the normalized dump from the live shards.
+func (s *DiscoveryServer) exportState() *ExportedState {
+	out := &ExportedState{
+		Version:    istioversion.Info.String(),
+		ExportedAt: time.Now(),
+		Services:   map[string]*ExportedService{},
+	}
+
+	s.mutex.RLock()
+	byService := make(map[string]*EndpointShardsByService, len(s.EndpointShardsByService))
+	for name, ep := range s.EndpointShardsByService {
+		byService[name] = ep
+	}
+	s.mutex.RUnlock()
+
+	for name, ep := range byService {
+		es := &ExportedService{Shards: map[string][]*model.IstioEndpoint{}}
+		shards, _ := ep.snapshot()
+		ep.mutex.RLock()
+		for sa := range ep.ServiceAccounts {
+			es.ServiceAccounts = append(es.ServiceAccounts, sa)
+		}
+		ep.mutex.RUnlock()
+		sort.Strings(es.ServiceAccounts)
+		for shard, se := range shards {
+			entries := make([]*model.IstioEndpoint, 0, len(se.Entries))
+			for _, e := range se.Entries {
+				entries = append(entries, exportEndpoint(e))
+			}
+			sort.Slice(entries, func(i, j int) bool {
+				return exportKey(entries[i]) < exportKey(entries[j])
+			})
+			es.Shards[shard] = entries
+		}
+		out.Services[name] = es
+	}
+	return out
+}
+
+// endpointSet flattens a service's shards into its set of endpoint keys.
+func endpointSet(es *ExportedService) map[string]bool {
+	out := map[string]bool{}
+	for _, entries := range es.Shards {
+		for _, e := range entries {
+			out[exportKey(e)] = true
+		}
+	}
+	return out
+}
+
+// compareExports reports the differences between a local and a remote dump.
+func compareExports(local, remote *ExportedState) *ExportCompareReport {
+	report := &ExportCompareReport{
+		LocalVersion:  local.Version,
+		RemoteVersion: remote.Version,
+		Changed:       map[string]*ServiceDiff{},
+	}
+	for name, les := range local.Services {
+		res, f := remote.Services[name]
+		if !f {
+			report.OnlyLocal = append(report.OnlyLocal, name)
+			continue
+		}
+		lset, rset := endpointSet(les), endpointSet(res)
+		diff := &ServiceDiff{}
+		for k := range lset {
+			if !rset[k] {
+				diff.OnlyLocal = append(diff.OnlyLocal, k)
+			}
+		}
+		for k := range rset {
+			if !lset[k] {
+				diff.OnlyRemote = append(diff.OnlyRemote, k)
+			}
+		}
+		if len(diff.OnlyLocal) > 0 || len(diff.OnlyRemote) > 0 {
+			sort.Strings(diff.OnlyLocal)
+			sort.Strings(diff.OnlyRemote)
+			report.Changed[name] = diff
+		}
+	}
+	for name := range remote.Services {
+		if _, f := local.Services[name]; !f {
+			report.OnlyRemote = append(report.OnlyRemote, name)
+		}
+	}
+	sort.Strings(report.OnlyLocal)
+	sort.Strings(report.OnlyRemote)
+	if len(report.Changed) == 0 {
+		report.Changed = nil
+	}
+	return report
+}
+
+// exportz serves the normalized state dump.
+func (s *DiscoveryServer) exportz(w http.ResponseWriter, req *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	b, _ := json.MarshalIndent(s.exportState(), " ", " ")
+	_, _ = w.Write(b)
+}
+
+// importz pre-warms this Pilot from another's export. Like the shard store
+// replay, shards a registry already delivered are left alone - the live
+// registries stay authoritative once their watches catch up.
+func (s *DiscoveryServer) importz(w http.ResponseWriter, req *http.Request) {
+	if !injectAuthorized(w, req) {
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var in ExportedState
+	if err := json.NewDecoder(req.Body).Decode(&in); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "{\"error\": %q}\n", err.Error())
+		return
+	}
+	imported, skipped := 0, 0
+	for serviceName, es := range in.Services {
+		for shard, entries := range es.Shards {
+			s.mutex.RLock()
+			ep, f := s.EndpointShardsByService[serviceName]
+			s.mutex.RUnlock()
+			if f {
+				ep.mutex.RLock()
+				_, have := ep.Shards[shard]
+				ep.mutex.RUnlock()
+				if have {
+					skipped++
+					continue
+				}
+			}
+			s.edsUpdate(shard, serviceName, entries, true)
+			imported++
+		}
+	}
+	adsLog.Infof("EDS: imported %d shards from export of %s, %d already present", imported, in.Version, skipped)
+	fmt.Fprintf(w, "{\"imported\": %d, \"skipped\": %d}\n", imported, skipped)
+}
+
+// comparez diffs a POSTed export against the local state.
+func (s *DiscoveryServer) comparez(w http.ResponseWriter, req *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var remote ExportedState
+	if err := json.NewDecoder(req.Body).Decode(&remote); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "{\"error\": %q}\n", err.Error())
+		return
+	}
+	b, _ := json.MarshalIndent(compareExports(s.exportState(), &remote), " ", " ")
+	_, _ = w.Write(b)
+}
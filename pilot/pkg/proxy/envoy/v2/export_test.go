@@ -0,0 +1,69 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"reflect"
+	"testing"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+func exportedService(addrs ...string) *ExportedService {
+	entries := make([]*model.IstioEndpoint, 0, len(addrs))
+	for _, a := range addrs {
+		entries = append(entries, &model.IstioEndpoint{Address: a, EndpointPort: 80, ServicePortName: "http"})
+	}
+	return &ExportedService{Shards: map[string][]*model.IstioEndpoint{"k8s": entries}}
+}
+
+func TestCompareExports(t *testing.T) {
+	local := &ExportedState{
+		Version: "local",
+		Services: map[string]*ExportedService{
+			"a.ns.svc.cluster.local": exportedService("10.0.0.1", "10.0.0.2"),
+			"b.ns.svc.cluster.local": exportedService("10.0.1.1"),
+		},
+	}
+	remote := &ExportedState{
+		Version: "remote",
+		Services: map[string]*ExportedService{
+			"a.ns.svc.cluster.local": exportedService("10.0.0.2", "10.0.0.3"),
+			"c.ns.svc.cluster.local": exportedService("10.0.2.1"),
+		},
+	}
+
+	report := compareExports(local, remote)
+
+	if !reflect.DeepEqual(report.OnlyLocal, []string{"b.ns.svc.cluster.local"}) {
+		t.Errorf("OnlyLocal = %v", report.OnlyLocal)
+	}
+	if !reflect.DeepEqual(report.OnlyRemote, []string{"c.ns.svc.cluster.local"}) {
+		t.Errorf("OnlyRemote = %v", report.OnlyRemote)
+	}
+	diff := report.Changed["a.ns.svc.cluster.local"]
+	if diff == nil {
+		t.Fatal("expected a diff for a.ns.svc.cluster.local")
+	}
+	if !reflect.DeepEqual(diff.OnlyLocal, []string{"10.0.0.1:80/http"}) ||
+		!reflect.DeepEqual(diff.OnlyRemote, []string{"10.0.0.3:80/http"}) {
+		t.Errorf("diff = %+v", diff)
+	}
+
+	// Identical states produce an empty report.
+	if r := compareExports(local, local); r.Changed != nil || len(r.OnlyLocal) != 0 || len(r.OnlyRemote) != 0 {
+		t.Errorf("self compare not empty: %+v", r)
+	}
+}
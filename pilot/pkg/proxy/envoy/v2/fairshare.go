@@ -0,0 +1,125 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// One namespace deploying a thousand pods at once should not delay config
+// for everyone else's proxies. The fairshare scheduler
+// (PILOT_PUSH_SCHEDULER=fairshare) keeps one queue per namespace and hands
+// out push slots round-robin across them, so a namespace's wait for its
+// first slot is bounded by the number of namespaces, not by the size of the
+// churning one. The priority lane (gateways) still goes first, exactly as
+// in the default scheduler.
+
+var (
+	fairshareNamespaces = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "pilot_push_fairshare_namespaces",
+		Help: "Namespaces participating in the last fair-share push round.",
+	})
+
+	// fairshareFirstSlot is the starvation signal: how many push slots
+	// passed before a namespace got its first one. Under round-robin this
+	// stays below the namespace count; growth means the policy is not
+	// keeping up.
+	fairshareFirstSlot = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "pilot_push_fairshare_first_slot",
+		Help:    "Push slots a namespace waited for its first connection to be scheduled.",
+		Buckets: prometheus.ExponentialBuckets(1, 4, 8),
+	})
+)
+
+func init() {
+	prometheus.MustRegister(fairshareNamespaces)
+	prometheus.MustRegister(fairshareFirstSlot)
+	RegisterPushScheduler("fairshare", func() PushScheduler { return &fairShareScheduler{} })
+}
+
+type fairShareScheduler struct{}
+
+func (f *fairShareScheduler) Name() string { return "fairshare" }
+
+func (f *fairShareScheduler) Start(pending []*XdsConnection) PushQueue {
+	q := &fairShareQueue{
+		queues:  map[string][]*XdsConnection{},
+		started: map[string]bool{},
+	}
+	for _, con := range pending {
+		if priorityConnection(con) {
+			q.priority = append(q.priority, con)
+			continue
+		}
+		ns := proxyNamespace(con.modelNode)
+		if _, f := q.queues[ns]; !f {
+			// Namespaces rotate in first-seen order, keeping rounds stable.
+			q.order = append(q.order, ns)
+		}
+		q.queues[ns] = append(q.queues[ns], con)
+	}
+	fairshareNamespaces.Set(float64(len(q.order)))
+	return q
+}
+
+// fairShareQueue drains the priority lane, then round-robins the namespace
+// queues.
+type fairShareQueue struct {
+	priority []*XdsConnection
+
+	queues map[string][]*XdsConnection
+	order  []string
+
+	// next is the namespace index the round-robin continues at.
+	next int
+
+	// slot counts connections handed out, for the starvation histogram.
+	slot int
+
+	// started marks namespaces that already received their first slot.
+	started map[string]bool
+}
+
+func (q *fairShareQueue) Next() *XdsConnection {
+	if len(q.priority) > 0 {
+		con := q.priority[0]
+		q.priority = q.priority[1:]
+		q.slot++
+		return con
+	}
+	for len(q.order) > 0 {
+		if q.next >= len(q.order) {
+			q.next = 0
+		}
+		ns := q.order[q.next]
+		queue := q.queues[ns]
+		if len(queue) == 0 {
+			// Namespace drained, drop it from the rotation.
+			q.order = append(q.order[:q.next], q.order[q.next+1:]...)
+			delete(q.queues, ns)
+			continue
+		}
+		con := queue[0]
+		if !q.started[ns] {
+			q.started[ns] = true
+			fairshareFirstSlot.Observe(float64(q.slot))
+		}
+		q.queues[ns] = queue[1:]
+		q.next++
+		q.slot++
+		return con
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"testing"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+func nsConnection(conID, proxyID string) *XdsConnection {
+	return &XdsConnection{
+		ConID:     conID,
+		modelNode: &model.Proxy{ID: proxyID, Type: model.Sidecar},
+	}
+}
+
+func TestFairShareScheduling(t *testing.T) {
+	// A churning namespace with many proxies and two small ones.
+	pending := []*XdsConnection{
+		nsConnection("big-1", "a.big"),
+		nsConnection("big-2", "b.big"),
+		nsConnection("big-3", "c.big"),
+		nsConnection("small-1", "d.small"),
+		nsConnection("other-1", "e.other"),
+	}
+
+	q := (&fairShareScheduler{}).Start(pending)
+	order := []string{}
+	for {
+		con := q.Next()
+		if con == nil {
+			break
+		}
+		order = append(order, con.ConID)
+	}
+
+	if len(order) != len(pending) {
+		t.Fatalf("scheduled %d of %d connections: %v", len(order), len(pending), order)
+	}
+
+	// Every namespace must get a slot within the first round, i.e. within
+	// the first three slots here.
+	seen := map[string]bool{}
+	for _, conID := range order[:3] {
+		seen[conID[:1]] = true
+	}
+	if !seen["b"] || !seen["s"] || !seen["o"] {
+		t.Errorf("first round did not cover all namespaces: %v", order)
+	}
+}
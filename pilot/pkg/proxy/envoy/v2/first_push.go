@@ -0,0 +1,100 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Cold-start latency tracking: time from stream establishment to the first
+// complete push (and first ACK) of each xDS type, per connection. A regression
+// here means proxies take longer to become ready after connecting.
+
+var (
+	firstPushDelay = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "pilot_xds_first_push_delay",
+		Help:    "Delay between stream establishment and first push, per xDS type and proxy type.",
+		Buckets: []float64{.01, .1, 1, 3, 5, 10, 30},
+	}, []string{"type", "proxy"})
+
+	firstAckDelay = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "pilot_xds_first_ack_delay",
+		Help:    "Delay between stream establishment and first ACK, per xDS type and proxy type.",
+		Buckets: []float64{.01, .1, 1, 3, 5, 10, 30},
+	}, []string{"type", "proxy"})
+)
+
+func init() {
+	prometheus.MustRegister(firstPushDelay)
+	prometheus.MustRegister(firstAckDelay)
+}
+
+// xdsShortType maps the type URL to the short name used in metrics and logs.
+func xdsShortType(typeURL string) string {
+	switch typeURL {
+	case ClusterType:
+		return "cds"
+	case EndpointType:
+		return "eds"
+	case ListenerType:
+		return "lds"
+	case RouteType:
+		return "rds"
+	}
+	return "unknown"
+}
+
+// proxyTypeLocked returns the node type for metric labels. Caller must hold conn.mu.
+func (conn *XdsConnection) proxyTypeLocked() string {
+	if conn.modelNode == nil {
+		return "unknown"
+	}
+	return string(conn.modelNode.Type)
+}
+
+// recordFirstPushLocked observes the first-push delay for a type, once per
+// connection. Caller must hold conn.mu.
+func (conn *XdsConnection) recordFirstPushLocked(typeURL string) {
+	t := xdsShortType(typeURL)
+	if conn.firstPushSent == nil {
+		conn.firstPushSent = map[string]time.Time{}
+	}
+	if _, f := conn.firstPushSent[t]; f {
+		return
+	}
+	now := time.Now()
+	conn.firstPushSent[t] = now
+	firstPushDelay.With(prometheus.Labels{"type": t, "proxy": conn.proxyTypeLocked()}).
+		Observe(now.Sub(conn.Connect).Seconds())
+}
+
+// recordFirstAck observes the first-ACK delay for a type, once per connection.
+func (conn *XdsConnection) recordFirstAck(typeURL string) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	t := xdsShortType(typeURL)
+	if conn.firstAckTime == nil {
+		conn.firstAckTime = map[string]time.Time{}
+	}
+	if _, f := conn.firstAckTime[t]; f {
+		return
+	}
+	now := time.Now()
+	conn.firstAckTime[t] = now
+	firstAckDelay.With(prometheus.Labels{"type": t, "proxy": conn.proxyTypeLocked()}).
+		Observe(now.Sub(conn.Connect).Seconds())
+}
@@ -0,0 +1,200 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package v2_test
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	ads "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+	"github.com/ghodss/yaml"
+	"github.com/gogo/protobuf/proto"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/proxy/envoy/v2"
+	"istio.io/istio/pkg/test/env"
+	"istio.io/istio/tests/util"
+)
+
+// Golden-file snapshots of the generated xDS responses. Behavior changes in
+// generation code show up as reviewable diffs on the golden files instead of
+// silent drift. Regenerate with:
+//
+//	go test ./pilot/pkg/proxy/envoy/v2/ -run TestGolden -update-golden
+var updateGolden = flag.Bool("update-golden", false, "update golden xDS snapshot files")
+
+// goldenDir holds the snapshots, one file per scenario and type.
+var goldenDir = filepath.Join(env.IstioSrc, "pilot/pkg/proxy/envoy/v2/testdata/golden")
+
+// goldenScenario is one proxy from the fixture library, with the resources it
+// watches.
+type goldenScenario struct {
+	name   string
+	nodeID string
+	// routes requested for RDS; nil skips RDS.
+	routes []string
+	// clusters requested for EDS; nil skips EDS.
+	clusters []string
+}
+
+func goldenScenarios() []goldenScenario {
+	return []goldenScenario{
+		{
+			name:     "sidecar-app3",
+			nodeID:   sidecarId(app3Ip, "app3"),
+			routes:   []string{"80", "8080"},
+			clusters: []string{"outbound|1080||service3.default.svc.cluster.local"},
+		},
+		{
+			name:   "gateway",
+			nodeID: gatewayId(gatewayIP),
+		},
+		{
+			name:   "ingress",
+			nodeID: ingressId(ingressIP),
+		},
+	}
+}
+
+func TestGolden(t *testing.T) {
+	_, tearDown := initLocalPilotTestEnv(t)
+	defer tearDown()
+
+	for _, sc := range goldenScenarios() {
+		sc := sc
+		t.Run(sc.name, func(t *testing.T) {
+			conn, err := connectADS(util.MockPilotGrpcAddr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = conn.CloseSend() }()
+
+			if err := sendCDSReq(sc.nodeID, conn); err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, sc.name, "cds", mustReceive(t, conn))
+
+			if err := sendLDSReq(sc.nodeID, conn); err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, sc.name, "lds", mustReceive(t, conn))
+
+			if sc.routes != nil {
+				if err := sendRDSReq(sc.nodeID, sc.routes, conn); err != nil {
+					t.Fatal(err)
+				}
+				checkGolden(t, sc.name, "rds", mustReceive(t, conn))
+			}
+			if sc.clusters != nil {
+				if err := sendEDSReq(sc.clusters, sc.nodeID, conn); err != nil {
+					t.Fatal(err)
+				}
+				checkGolden(t, sc.name, "eds", mustReceive(t, conn))
+			}
+		})
+	}
+}
+
+func mustReceive(t *testing.T, conn ads.AggregatedDiscoveryService_StreamAggregatedResourcesClient) *xdsapi.DiscoveryResponse {
+	t.Helper()
+	res, err := adsReceive(conn, 15*time.Second)
+	if err != nil {
+		t.Fatal("recv failed", err)
+	}
+	return res
+}
+
+// renderGolden turns a DiscoveryResponse into stable YAML: version and nonce
+// are stripped (time-based), resources are decoded and sorted by their JSON
+// rendering, so two runs over the same config compare byte-for-byte.
+func renderGolden(t *testing.T, res *xdsapi.DiscoveryResponse) []byte {
+	t.Helper()
+	resources := make([]string, 0, len(res.Resources))
+	for _, raw := range res.Resources {
+		var m proto.Message
+		switch res.TypeUrl {
+		case v2.ClusterType:
+			m = &xdsapi.Cluster{}
+		case v2.ListenerType:
+			m = &xdsapi.Listener{}
+		case v2.RouteType:
+			m = &xdsapi.RouteConfiguration{}
+		case v2.EndpointType:
+			m = &xdsapi.ClusterLoadAssignment{}
+		default:
+			t.Fatalf("unexpected typeURL %q", res.TypeUrl)
+		}
+		if err := proto.Unmarshal(raw.Value, m); err != nil {
+			t.Fatalf("cannot decode %s resource: %v", res.TypeUrl, err)
+		}
+		js, err := model.ToJSONWithIndent(m, "  ")
+		if err != nil {
+			t.Fatalf("cannot render %s resource: %v", res.TypeUrl, err)
+		}
+		resources = append(resources, js)
+	}
+	sort.Strings(resources)
+
+	out := fmt.Sprintf("{\"typeUrl\": %q, \"resources\": [\n%s\n]}", res.TypeUrl, joinResources(resources))
+	y, err := yaml.JSONToYAML([]byte(out))
+	if err != nil {
+		t.Fatalf("cannot convert to yaml: %v", err)
+	}
+	return y
+}
+
+func joinResources(resources []string) string {
+	out := ""
+	for i, r := range resources {
+		if i > 0 {
+			out += ",\n"
+		}
+		out += r
+	}
+	return out
+}
+
+// checkGolden compares a response against its golden file, or rewrites the
+// file with -update-golden.
+func checkGolden(t *testing.T, scenario, xdsType string, res *xdsapi.DiscoveryResponse) {
+	t.Helper()
+	got := renderGolden(t, res)
+	file := filepath.Join(goldenDir, scenario+"-"+xdsType+".golden.yaml")
+
+	if *updateGolden {
+		if err := os.MkdirAll(goldenDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("missing golden file %s, rerun with -update-golden: %v", file, err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("%s %s does not match golden file %s - inspect the diff and rerun with -update-golden if intended.\ngot:\n%s",
+			scenario, xdsType, file, got)
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// grpc.health.v1 on the xDS port, reflecting push-pipeline health rather
+// than bare process liveness: a replica whose registries never synced or
+// whose update queue is stuck should not receive new proxies from the load
+// balancer in front of Pilot.
+
+const (
+	// healthService is the service name answered in addition to "".
+	healthService = "istio.io/pilot"
+
+	// healthSaturationGrace is how long the update queue may stay full
+	// before the replica reports NOT_SERVING. A full queue during a push
+	// burst is normal; a full queue for this long means updates are stuck.
+	healthSaturationGrace = 30 * time.Second
+
+	// healthErrorBurst is the number of new internal xDS errors between two
+	// consecutive checks treated as a degraded replica.
+	healthErrorBurst = 10
+)
+
+type healthServer struct {
+	s *DiscoveryServer
+
+	mu                 sync.Mutex
+	saturatedSince     time.Time
+	lastInternalErrors float64
+}
+
+func newHealthServer(s *DiscoveryServer) *healthServer {
+	return &healthServer{s: s}
+}
+
+// Check implements grpc.health.v1.Health.
+func (h *healthServer) Check(ctx context.Context, in *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	if in.Service != "" && in.Service != healthService {
+		return nil, status.Error(codes.NotFound, "unknown service")
+	}
+	st := healthpb.HealthCheckResponse_SERVING
+	if !h.healthy() {
+		st = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	return &healthpb.HealthCheckResponse{Status: st}, nil
+}
+
+// Watch implements grpc.health.v1.Health.
+func (h *healthServer) Watch(in *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	return status.Error(codes.Unimplemented, "watching is not supported")
+}
+
+// healthy evaluates the push pipeline. Generation panics (CDS/LDS/RDS) kill
+// the process outright and need no accounting here; what this catches is a
+// replica that is up but degraded.
+func (h *healthServer) healthy() bool {
+	// Standby replicas refuse proxy streams; NOT_SERVING keeps the load
+	// balancer pointing proxies at the active ones.
+	if inStandby() {
+		return false
+	}
+	// A replica whose registries never loaded would hand proxies empty config.
+	if !h.s.globalPushContext().InitDone() {
+		return false
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+
+	// Update queue saturation, with a grace window for push bursts.
+	if len(h.s.updateChannel) < cap(h.s.updateChannel) {
+		h.saturatedSince = time.Time{}
+	} else if h.saturatedSince.IsZero() {
+		h.saturatedSince = now
+	} else if now.Sub(h.saturatedSince) > healthSaturationGrace {
+		adsLog.Warnf("Health: update queue saturated for %v, reporting NOT_SERVING", now.Sub(h.saturatedSince))
+		return false
+	}
+
+	// A burst of internal errors since the last probe.
+	cur := counterValue(totalXDSInternalErrors)
+	delta := cur - h.lastInternalErrors
+	h.lastInternalErrors = cur
+	if delta > healthErrorBurst {
+		adsLog.Warnf("Health: %v internal xDS errors since last probe, reporting NOT_SERVING", delta)
+		return false
+	}
+	return true
+}
+
+// counterValue reads the current value of a prometheus counter.
+func counterValue(c prometheus.Counter) float64 {
+	m := &dto.Metric{}
+	if err := c.Write(m); err != nil {
+		return 0
+	}
+	return m.GetCounter().GetValue()
+}
@@ -0,0 +1,128 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"io"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+)
+
+// External health-check infrastructure can stream endpoint health
+// transitions into Pilot instead of POSTing them one by one. The feed is a
+// client-streaming gRPC call on the discovery port; each message reports one
+// (service, address, status) transition. Reports merge with registry data at
+// push time under the precedence rules of healthStatusFor: an explicit
+// report always wins over label-derived defaults, the latest report for an
+// address wins overall, and the registry stays the source of endpoint
+// existence - a report for an address no registry serves has no effect.
+//
+// The messages and service descriptor are written out by hand rather than
+// generated; the proto codec marshals them through the field tags.
+
+// EndpointHealth is one health transition reported over the feed.
+type EndpointHealth struct {
+	Service string `protobuf:"bytes,1,opt,name=service,proto3" json:"service,omitempty"`
+	Address string `protobuf:"bytes,2,opt,name=address,proto3" json:"address,omitempty"`
+	Healthy bool   `protobuf:"varint,3,opt,name=healthy,proto3" json:"healthy,omitempty"`
+	Source  string `protobuf:"bytes,4,opt,name=source,proto3" json:"source,omitempty"`
+}
+
+// Reset implements proto.Message.
+func (m *EndpointHealth) Reset() { *m = EndpointHealth{} }
+
+// String implements proto.Message.
+func (m *EndpointHealth) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage implements proto.Message.
+func (*EndpointHealth) ProtoMessage() {}
+
+// HealthFeedAck closes a feed stream, reporting how many transitions were
+// accepted.
+type HealthFeedAck struct {
+	Accepted uint32 `protobuf:"varint,1,opt,name=accepted,proto3" json:"accepted,omitempty"`
+}
+
+// Reset implements proto.Message.
+func (m *HealthFeedAck) Reset() { *m = HealthFeedAck{} }
+
+// String implements proto.Message.
+func (m *HealthFeedAck) String() string { return proto.CompactTextString(m) }
+
+// ProtoMessage implements proto.Message.
+func (*HealthFeedAck) ProtoMessage() {}
+
+var healthFeedRejected = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "pilot_health_feed_rejected",
+	Help: "Health feed reports dropped for missing an address.",
+})
+
+func init() {
+	prometheus.MustRegister(healthFeedRejected)
+}
+
+// healthFeedServer is the handler interface behind healthFeedServiceDesc.
+type healthFeedServer interface {
+	reportHealthFeed(grpc.ServerStream) error
+}
+
+var healthFeedServiceDesc = grpc.ServiceDesc{
+	ServiceName: "istio.pilot.v2.HealthFeed",
+	HandlerType: (*healthFeedServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Report",
+			Handler:       healthFeedReportHandler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "pilot/pkg/proxy/envoy/v2/healthfeed.go",
+}
+
+func healthFeedReportHandler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(healthFeedServer).reportHealthFeed(stream)
+}
+
+// reportHealthFeed consumes one feed stream, applying each transition as it
+// arrives so a long-lived checker stream takes effect immediately.
+func (s *DiscoveryServer) reportHealthFeed(stream grpc.ServerStream) error {
+	accepted := uint32(0)
+	for {
+		m := &EndpointHealth{}
+		err := stream.RecvMsg(m)
+		if err == io.EOF {
+			return stream.SendMsg(&HealthFeedAck{Accepted: accepted})
+		}
+		if err != nil {
+			return err
+		}
+		if m.Address == "" {
+			healthFeedRejected.Add(1)
+			continue
+		}
+		source := m.Source
+		if source == "" {
+			source = "feed"
+		}
+		if m.Service != "" {
+			source = source + "/" + m.Service
+		}
+		s.reportEndpointHealth(m.Address, m.Healthy, source)
+		accepted++
+	}
+}
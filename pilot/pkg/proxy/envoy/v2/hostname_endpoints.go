@@ -0,0 +1,131 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"net"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"istio.io/istio/pkg/features/pilot"
+)
+
+// ServiceEntry endpoints may name a host (an RDS instance, a SaaS endpoint)
+// rather than an IP. EDS can only carry addresses, so such endpoints used to
+// be silently unrepresentable. Two modes are supported, selected per endpoint
+// with the istio.io/resolve label: "pilot" (default) resolves the hostname
+// control-plane-side, caches the addresses and re-resolves them periodically;
+// "envoy" leaves the endpoint out of EDS entirely, for ServiceEntries whose
+// cluster is configured with Envoy-side (STRICT_DNS) resolution.
+
+// resolveLabel selects who resolves a hostname endpoint.
+const (
+	resolveLabel      = "istio.io/resolve"
+	resolveModeEnvoy  = "envoy"
+	defaultDNSRefresh = 60 * time.Second
+)
+
+var (
+	// hostnameRefresh is the re-resolution interval (PILOT_HOSTNAME_ENDPOINT_REFRESH).
+	hostnameRefresh time.Duration
+
+	// hostnameLookup is net.LookupHost, replaceable in tests.
+	hostnameLookup = net.LookupHost
+
+	hostnameMutex       sync.RWMutex
+	hostnameResolutions = map[string][]string{}
+
+	hostnameResolutionErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "pilot_eds_hostname_resolution_errors",
+		Help: "Failed DNS resolutions of hostname-typed endpoints.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(hostnameResolutionErrors)
+	hostnameRefresh = envDuration(pilot.HostnameEndpointRefresh, defaultDNSRefresh)
+}
+
+// isIPAddress reports whether a TCP endpoint address is a literal IP, i.e.
+// needs no resolution.
+func isIPAddress(address string) bool {
+	return net.ParseIP(address) != nil
+}
+
+// envoyResolved reports whether the endpoint opted out of control-plane
+// resolution and is resolved by Envoy via a DNS cluster instead.
+func envoyResolved(labels map[string]string) bool {
+	return labels[resolveLabel] == resolveModeEnvoy
+}
+
+// resolveHostname returns the cached addresses for a hostname endpoint,
+// resolving it on first use. Refreshes happen in periodicHostnameRefresh, so
+// the push path never blocks on DNS beyond the first sighting of a host.
+func resolveHostname(host string) []string {
+	hostnameMutex.RLock()
+	addrs, f := hostnameResolutions[host]
+	hostnameMutex.RUnlock()
+	if f {
+		return addrs
+	}
+	addrs, err := hostnameLookup(host)
+	if err != nil {
+		hostnameResolutionErrors.Add(1)
+		adsLog.Warnf("EDS: resolving endpoint hostname %s: %v", host, err)
+		addrs = nil
+	}
+	hostnameMutex.Lock()
+	hostnameResolutions[host] = addrs
+	hostnameMutex.Unlock()
+	return addrs
+}
+
+// periodicHostnameRefresh re-resolves all known hostname endpoints and
+// triggers an incremental push when any of them changed.
+func (s *DiscoveryServer) periodicHostnameRefresh() {
+	ticker := time.NewTicker(hostnameRefresh)
+	defer ticker.Stop()
+	for range ticker.C {
+		hostnameMutex.RLock()
+		hosts := make([]string, 0, len(hostnameResolutions))
+		for host := range hostnameResolutions {
+			hosts = append(hosts, host)
+		}
+		hostnameMutex.RUnlock()
+
+		changed := false
+		for _, host := range hosts {
+			addrs, err := hostnameLookup(host)
+			if err != nil {
+				hostnameResolutionErrors.Add(1)
+				adsLog.Warnf("EDS: re-resolving endpoint hostname %s: %v", host, err)
+				continue
+			}
+			hostnameMutex.Lock()
+			if !reflect.DeepEqual(hostnameResolutions[host], addrs) {
+				hostnameResolutions[host] = addrs
+				changed = true
+			}
+			hostnameMutex.Unlock()
+		}
+		if changed {
+			adsLog.Infof("EDS: hostname endpoints changed, pushing")
+			s.ConfigUpdate(false)
+		}
+	}
+}
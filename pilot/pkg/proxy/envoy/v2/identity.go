@@ -0,0 +1,144 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Connection IDs are node + counter, so a reconnecting proxy starts over and
+// its per-connection accounting is lost. Proxies also get a stable identity -
+// node ID plus the pod UID from node metadata - tracked across reconnects
+// with a generation counter, so per-proxy history survives stream restarts.
+
+// podUIDMetadataKey is the node metadata key carrying the pod UID, injected
+// by the sidecar bootstrap.
+const podUIDMetadataKey = "POD_UID"
+
+// ProxyIdentity accumulates per-proxy state across connections.
+type ProxyIdentity struct {
+	// NodeID is the Envoy node ID, PodUID the pod UID from node metadata
+	// (empty for proxies that do not report one).
+	NodeID string
+	PodUID string
+
+	// Generation counts the streams this proxy has opened; the current
+	// connection carries it for correlation in logs and debug output.
+	Generation int
+
+	// FirstSeen is when the first stream of this proxy connected,
+	// LastConnect when the latest one did.
+	FirstSeen   time.Time
+	LastConnect time.Time
+
+	// TotalBytesSent accumulates response bytes over closed connections, by
+	// xDS short type. The live connection's counters are folded in when it
+	// closes.
+	TotalBytesSent map[string]uint64
+}
+
+var (
+	proxyIdentitiesMutex sync.Mutex
+	proxyIdentities      = map[string]*ProxyIdentity{}
+
+	proxyReconnects = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "pilot_proxy_reconnects",
+		Help: "Streams opened by proxies that had connected before.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(proxyReconnects)
+}
+
+// stableProxyID keys the identity map: node ID plus pod UID, so a node name
+// reused by a new pod starts a fresh identity.
+func stableProxyID(nodeID, podUID string) string {
+	if podUID == "" {
+		return nodeID
+	}
+	return nodeID + "/" + podUID
+}
+
+// registerProxyIdentity attaches the stable identity to a new connection.
+// Called once, when the first discovery request names the node.
+func registerProxyIdentity(con *XdsConnection) {
+	if con.modelNode == nil {
+		return
+	}
+	podUID := con.modelNode.Metadata[podUIDMetadataKey]
+	id := stableProxyID(con.modelNode.ID, podUID)
+
+	proxyIdentitiesMutex.Lock()
+	defer proxyIdentitiesMutex.Unlock()
+	pi, f := proxyIdentities[id]
+	if !f {
+		pi = &ProxyIdentity{
+			NodeID:         con.modelNode.ID,
+			PodUID:         podUID,
+			FirstSeen:      time.Now(),
+			TotalBytesSent: map[string]uint64{},
+		}
+		proxyIdentities[id] = pi
+	} else {
+		proxyReconnects.Add(1)
+	}
+	pi.Generation++
+	pi.LastConnect = time.Now()
+
+	con.mu.Lock()
+	con.proxyID = id
+	con.generation = pi.Generation
+	con.mu.Unlock()
+}
+
+// foldProxyIdentity folds a closing connection's accounting into its
+// identity, so totals survive the reconnect.
+func foldProxyIdentity(con *XdsConnection) {
+	con.mu.RLock()
+	id := con.proxyID
+	sent := make(map[string]uint64, len(con.BytesSent))
+	for k, v := range con.BytesSent {
+		sent[k] = v
+	}
+	con.mu.RUnlock()
+	if id == "" {
+		return
+	}
+
+	proxyIdentitiesMutex.Lock()
+	defer proxyIdentitiesMutex.Unlock()
+	pi, f := proxyIdentities[id]
+	if !f {
+		return
+	}
+	for k, v := range sent {
+		pi.TotalBytesSent[k] += v
+	}
+}
+
+// identityz lists the tracked proxy identities.
+func (s *DiscoveryServer) identityz(w http.ResponseWriter, req *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	proxyIdentitiesMutex.Lock()
+	out, _ := json.MarshalIndent(proxyIdentities, " ", " ")
+	proxyIdentitiesMutex.Unlock()
+	_, _ = w.Write(out)
+}
@@ -0,0 +1,152 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+
+	networking "istio.io/api/networking/v1alpha3"
+	"istio.io/istio/pilot/pkg/config/kube/crd"
+	"istio.io/istio/pilot/pkg/model"
+)
+
+// PushImpact is the dry-run report for a proposed config change: which
+// services and clusters it touches, and how many connected proxies would be
+// pushed if it were applied.
+type PushImpact struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+
+	// Hosts the config applies to, as written in the config.
+	Hosts []string `json:"hosts"`
+
+	// MatchedServices are the known services the hosts resolve to.
+	MatchedServices []string `json:"matched_services"`
+
+	// AffectedClusters are the currently watched EDS clusters for the matched services.
+	AffectedClusters []string `json:"affected_clusters"`
+
+	// WatchingProxies is the number of connections watching an affected cluster.
+	WatchingProxies int `json:"watching_proxies"`
+
+	// ConnectedProxies is the total connection count - the blast radius of a full push.
+	ConnectedProxies int `json:"connected_proxies"`
+
+	// Scope indicates the xDS types a change of this kind triggers today.
+	Scope string `json:"scope"`
+}
+
+// configImpact evaluates a proposed config (YAML in the request body, same
+// format accepted by kubectl/istioctl) against the current push context and
+// reports its push blast radius without applying it.
+// It is mapped to /debug/push_impact.
+func (s *DiscoveryServer) configImpact(w http.ResponseWriter, req *http.Request) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "unable to read config: %v", err)
+		return
+	}
+	configs, _, err := crd.ParseInputs(string(body))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "unable to parse config: %v", err)
+		return
+	}
+	if len(configs) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "no config found in request body")
+		return
+	}
+
+	reports := make([]PushImpact, 0, len(configs))
+	for _, cfg := range configs {
+		reports = append(reports, s.impactOf(cfg))
+	}
+	w.Header().Add("Content-Type", "application/json")
+	out, err := json.MarshalIndent(reports, "", "  ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "unable to marshal impact report: %v", err)
+		return
+	}
+	_, _ = w.Write(out)
+}
+
+func (s *DiscoveryServer) impactOf(cfg model.Config) PushImpact {
+	report := PushImpact{
+		Type:             cfg.Type,
+		Name:             cfg.Name,
+		Hosts:            []string{},
+		MatchedServices:  []string{},
+		AffectedClusters: []string{},
+		ConnectedProxies: adsClientCount(),
+	}
+
+	switch cfg.Type {
+	case model.DestinationRule.Type:
+		dr := cfg.Spec.(*networking.DestinationRule)
+		report.Hosts = append(report.Hosts, dr.Host)
+		// Subset or policy changes recompute clusters and their endpoints.
+		report.Scope = "cds/eds"
+	case model.VirtualService.Type:
+		vs := cfg.Spec.(*networking.VirtualService)
+		report.Hosts = append(report.Hosts, vs.Hosts...)
+		report.Scope = "full"
+	default:
+		// Other config kinds currently trigger a full push to everyone.
+		report.Scope = "full"
+		return report
+	}
+
+	// Resolve the hosts against known services.
+	push := s.globalPushContext()
+	matched := map[string]bool{}
+	for _, h := range report.Hosts {
+		for svcHost := range push.ServicePort2Name {
+			if model.Hostname(h).Matches(model.Hostname(svcHost)) {
+				matched[svcHost] = true
+			}
+		}
+	}
+	for svcHost := range matched {
+		report.MatchedServices = append(report.MatchedServices, svcHost)
+	}
+	sort.Strings(report.MatchedServices)
+
+	// Find the currently watched clusters for the matched services and who watches them.
+	watchers := map[string]bool{}
+	edsClusterMutex.RLock()
+	for clusterName, c := range edsClusters {
+		_, _, hostname, _ := model.ParseSubsetKey(clusterName)
+		if !matched[string(hostname)] {
+			continue
+		}
+		report.AffectedClusters = append(report.AffectedClusters, clusterName)
+		c.mutex.Lock()
+		for conID := range c.EdsClients {
+			watchers[conID] = true
+		}
+		c.mutex.Unlock()
+	}
+	edsClusterMutex.RUnlock()
+	sort.Strings(report.AffectedClusters)
+	report.WatchingProxies = len(watchers)
+	return report
+}
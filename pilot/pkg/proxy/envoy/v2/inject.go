@@ -0,0 +1,206 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/features/pilot"
+)
+
+// Manual endpoint injection: an authenticated admin API to inject or
+// override the endpoints of a service, as a clearly marked shard with a TTL.
+// Operators use it to hotfix discovery during incidents, or to test traffic
+// paths before a registry integration is complete. Disabled unless
+// PILOT_INJECT_TOKEN is set.
+
+// manualShardName marks injected shards, so they are distinguishable from
+// registry-provided ones in debug output.
+const manualShardName = "manual"
+
+// defaultInjectTTL is how long injected endpoints live when the request does
+// not specify a TTL.
+const defaultInjectTTL = 30 * time.Minute
+
+// InjectEndpoint is one endpoint in an injection request.
+type InjectEndpoint struct {
+	Address         string            `json:"address"`
+	Port            uint32            `json:"port"`
+	ServicePortName string            `json:"servicePortName"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	ServiceAccount  string            `json:"serviceAccount,omitempty"`
+	Network         string            `json:"network,omitempty"`
+	UID             string            `json:"uid,omitempty"`
+}
+
+// InjectRequest replaces the manual shard of a service. An empty endpoint
+// list removes the shard.
+type InjectRequest struct {
+	Service string `json:"service"`
+	// TTL after which the injected shard is removed, for example "10m".
+	// Defaults to 30m.
+	TTL       string           `json:"ttl,omitempty"`
+	Endpoints []InjectEndpoint `json:"endpoints"`
+}
+
+// injectAuthorized verifies the bearer token. The API is disabled entirely
+// when no token is configured.
+func injectAuthorized(w http.ResponseWriter, req *http.Request) bool {
+	if pilot.InjectToken == "" {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintln(w, "endpoint injection is disabled, set PILOT_INJECT_TOKEN to enable")
+		return false
+	}
+	if req.Header.Get("Authorization") != "Bearer "+pilot.InjectToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintln(w, "missing or invalid token")
+		return false
+	}
+	return true
+}
+
+// injectz implements the manual endpoint injection API.
+// POST replaces the manual shard of a service, GET lists manual shards.
+// It is mapped to /debug/inject on the monitor port (9093).
+func (s *DiscoveryServer) injectz(w http.ResponseWriter, req *http.Request) {
+	if !injectAuthorized(w, req) {
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+
+	switch req.Method {
+	case http.MethodGet:
+		s.listManualShards(w)
+	case http.MethodPost:
+		var ir InjectRequest
+		if err := json.NewDecoder(req.Body).Decode(&ir); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "{\"error\": %q}\n", err.Error())
+			return
+		}
+		if err := s.injectEndpoints(&ir); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "{\"error\": %q}\n", err.Error())
+			return
+		}
+		fmt.Fprintf(w, "{\"service\": %q, \"injected\": %d}\n", ir.Service, len(ir.Endpoints))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// listManualShards writes the currently injected shards.
+func (s *DiscoveryServer) listManualShards(w http.ResponseWriter) {
+	out := map[string][]*model.IstioEndpoint{}
+	s.mutex.RLock()
+	for svc, ep := range s.EndpointShardsByService {
+		ep.mutex.RLock()
+		if shard, f := ep.Shards[manualShardName]; f {
+			out[svc] = shard.Entries
+		}
+		ep.mutex.RUnlock()
+	}
+	s.mutex.RUnlock()
+	b, _ := json.MarshalIndent(out, " ", " ")
+	_, _ = w.Write(b)
+}
+
+// injectEndpoints replaces the manual shard and schedules its removal.
+func (s *DiscoveryServer) injectEndpoints(ir *InjectRequest) error {
+	if ir.Service == "" {
+		return fmt.Errorf("service is required")
+	}
+	ttl := defaultInjectTTL
+	if ir.TTL != "" {
+		d, err := time.ParseDuration(ir.TTL)
+		if err != nil {
+			return fmt.Errorf("invalid ttl: %v", err)
+		}
+		ttl = d
+	}
+
+	if len(ir.Endpoints) == 0 {
+		s.removeManualShard(ir.Service, time.Time{})
+		adsLog.Infof("Injection: removed manual endpoints for %s", ir.Service)
+		return nil
+	}
+
+	entries := make([]*model.IstioEndpoint, 0, len(ir.Endpoints))
+	for _, e := range ir.Endpoints {
+		if e.Address == "" || e.Port == 0 || e.ServicePortName == "" {
+			return fmt.Errorf("address, port and servicePortName are required for each endpoint")
+		}
+		entries = append(entries, &model.IstioEndpoint{
+			Family:          model.AddressFamilyTCP,
+			Address:         e.Address,
+			EndpointPort:    e.Port,
+			ServicePortName: e.ServicePortName,
+			Labels:          e.Labels,
+			ServiceAccount:  e.ServiceAccount,
+			Network:         e.Network,
+			UID:             e.UID,
+		})
+	}
+
+	adsLog.Infof("Injection: %d manual endpoints for %s, ttl %v", len(entries), ir.Service, ttl)
+	s.edsUpdate(manualShardName, ir.Service, entries, false)
+
+	// Capture the update time, so re-injection extends rather than fights
+	// the scheduled removal.
+	s.mutex.RLock()
+	var injected time.Time
+	if ep, f := s.EndpointShardsByService[ir.Service]; f {
+		ep.mutex.RLock()
+		if shard, f := ep.Shards[manualShardName]; f {
+			injected = shard.LastUpdate
+		}
+		ep.mutex.RUnlock()
+	}
+	s.mutex.RUnlock()
+	time.AfterFunc(ttl, func() { s.removeManualShard(ir.Service, injected) })
+	return nil
+}
+
+// removeManualShard deletes the manual shard of a service and pushes. When
+// injectedAt is non-zero, a shard replaced since then is left alone - its own
+// TTL timer owns it.
+func (s *DiscoveryServer) removeManualShard(serviceName string, injectedAt time.Time) {
+	s.mutex.Lock()
+	ep, f := s.EndpointShardsByService[serviceName]
+	if !f {
+		s.mutex.Unlock()
+		return
+	}
+	ep.mutex.Lock()
+	shard, f := ep.Shards[manualShardName]
+	if !f || (!injectedAt.IsZero() && shard.LastUpdate.After(injectedAt)) {
+		ep.mutex.Unlock()
+		s.mutex.Unlock()
+		return
+	}
+	delete(ep.Shards, manualShardName)
+	ep.epoch++
+	ep.mutex.Unlock()
+	s.updateIPIndexLocked(serviceName, manualShardName, nil)
+	s.edsUpdates[serviceName] = ep
+	s.mutex.Unlock()
+
+	adsLog.Infof("Injection: manual endpoints for %s expired", serviceName)
+	s.ConfigUpdate(false)
+}
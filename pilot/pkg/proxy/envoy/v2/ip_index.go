@@ -0,0 +1,116 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+// Reverse index from endpoint IP to owning workload, maintained alongside
+// the shards. Inbound config generation and incident debugging both need to
+// answer "who owns this IP" without scanning every shard of every service.
+
+// IPWorkload describes one owner of an endpoint address. An address can have
+// several owners - one per (service, shard) referencing it.
+type IPWorkload struct {
+	Address        string            `json:"address"`
+	Service        string            `json:"service"`
+	Shard          string            `json:"shard"`
+	UID            string            `json:"uid,omitempty"`
+	ServiceAccount string            `json:"serviceAccount,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+}
+
+// updateIPIndexLocked replaces the index entries contributed by one
+// (service, shard) pair. Entries is nil when the shard was removed. Caller
+// must hold s.mutex.
+func (s *DiscoveryServer) updateIPIndexLocked(serviceName, shard string, entries []*model.IstioEndpoint) {
+	key := serviceName + "|" + shard
+
+	// Drop the previous contribution of the shard.
+	for addr, owners := range s.ipIndex {
+		if _, f := owners[key]; f {
+			delete(owners, key)
+			if len(owners) == 0 {
+				delete(s.ipIndex, addr)
+			}
+		}
+	}
+
+	for _, e := range entries {
+		owners := s.ipIndex[e.Address]
+		if owners == nil {
+			owners = map[string]IPWorkload{}
+			s.ipIndex[e.Address] = owners
+		}
+		owners[key] = IPWorkload{
+			Address:        e.Address,
+			Service:        serviceName,
+			Shard:          shard,
+			UID:            e.UID,
+			ServiceAccount: e.ServiceAccount,
+			Labels:         e.Labels,
+		}
+	}
+}
+
+// WorkloadsByAddress returns the owners of an endpoint address, or nil when
+// the address is unknown.
+func (s *DiscoveryServer) WorkloadsByAddress(address string) []IPWorkload {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	owners := s.ipIndex[address]
+	if len(owners) == 0 {
+		return nil
+	}
+	out := make([]IPWorkload, 0, len(owners))
+	for _, w := range owners {
+		out = append(out, w)
+	}
+	return out
+}
+
+// ip2workload answers "who owns this IP". With ?ip= it returns the owners of
+// one address, without it the whole index.
+// It is mapped to /debug/ip2workload on the monitor port (9093).
+func (s *DiscoveryServer) ip2workload(w http.ResponseWriter, req *http.Request) {
+	_ = req.ParseForm()
+	w.Header().Add("Content-Type", "application/json")
+
+	if ip := req.Form.Get("ip"); ip != "" {
+		workloads := s.WorkloadsByAddress(ip)
+		if workloads == nil {
+			w.WriteHeader(404)
+			return
+		}
+		b, _ := json.MarshalIndent(workloads, " ", " ")
+		_, _ = w.Write(b)
+		return
+	}
+
+	out := map[string][]IPWorkload{}
+	s.mutex.RLock()
+	for addr, owners := range s.ipIndex {
+		for _, wl := range owners {
+			out[addr] = append(out[addr], wl)
+		}
+	}
+	s.mutex.RUnlock()
+	b, _ := json.MarshalIndent(out, " ", " ")
+	_, _ = w.Write(b)
+}
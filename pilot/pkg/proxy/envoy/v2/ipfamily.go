@@ -0,0 +1,226 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/endpoint"
+	"github.com/gogo/protobuf/types"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/features/pilot"
+)
+
+// Dual-stack services have both IPv4 and IPv6 endpoints, and pushing both
+// families to every proxy indiscriminately puts unreachable addresses into
+// v4-only pods. The IP-family policy decides per service which family a
+// proxy receives, weighed against what the proxy declared it can use. Like
+// the visibility policy it is enforced at push time through the plugin
+// chain, so generation stays shared.
+
+// ipFamilyMetadataKey is the node metadata key a proxy declares its
+// capability in: "v4", "v6" or "dual". Empty means dual - the historical
+// assumption.
+const ipFamilyMetadataKey = "IP_FAMILY"
+
+// IPFamilyPolicy declares the emitted family per service. Loaded from the
+// JSON file named by PILOT_IP_FAMILY_POLICY.
+type IPFamilyPolicy struct {
+	// Default applies to services without a matching entry: "prefer_v4",
+	// "prefer_v6" or "both" (the default).
+	Default string `json:"default,omitempty"`
+
+	// Services maps a hostname or wildcard pattern to its policy.
+	Services map[string]string `json:"services,omitempty"`
+}
+
+// ipFamilyPolicy is the active policy, nil when filtering is disabled.
+var ipFamilyPolicy *IPFamilyPolicy
+
+func init() {
+	if pilot.IPFamilyPolicy == "" {
+		return
+	}
+	p, err := loadIPFamilyPolicy(pilot.IPFamilyPolicy)
+	if err != nil {
+		adsLog.Errorf("IP family policy disabled: %v", err)
+		return
+	}
+	ipFamilyPolicy = p
+}
+
+func loadIPFamilyPolicy(path string) (*IPFamilyPolicy, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %v", path, err)
+	}
+	p := &IPFamilyPolicy{}
+	if err := json.Unmarshal(b, p); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	return p, nil
+}
+
+// policyFor returns the policy for a service hostname.
+func (p *IPFamilyPolicy) policyFor(hostname model.Hostname) string {
+	for pattern, policy := range p.Services {
+		if model.Hostname(pattern).Matches(hostname) {
+			return policy
+		}
+	}
+	if p.Default == "" {
+		return "both"
+	}
+	return p.Default
+}
+
+// lbEndpointFamily classifies an endpoint as "v4" or "v6"; non-IP endpoints
+// (pipes, hostnames) return "" and are never filtered.
+func lbEndpointFamily(ep *endpoint.LbEndpoint) string {
+	if ep.Endpoint == nil || ep.Endpoint.Address == nil {
+		return ""
+	}
+	sa := ep.Endpoint.Address.GetSocketAddress()
+	if sa == nil {
+		return ""
+	}
+	ip := net.ParseIP(sa.Address)
+	if ip == nil {
+		return ""
+	}
+	if ip.To4() != nil {
+		return "v4"
+	}
+	return "v6"
+}
+
+// proxyIPFamily returns what the proxy declared it can use.
+func proxyIPFamily(node *model.Proxy) string {
+	if node == nil {
+		return "dual"
+	}
+	switch node.Metadata[ipFamilyMetadataKey] {
+	case "v4":
+		return "v4"
+	case "v6":
+		return "v6"
+	}
+	return "dual"
+}
+
+// emitFamily decides whether a family is pushed, given the service policy,
+// the proxy capability and which families the assignment actually contains.
+func emitFamily(family, policy, capability string, hasV4, hasV6 bool) bool {
+	if family == "" {
+		return true
+	}
+	// Never push a family the proxy cannot use, unless it is all there is.
+	if capability != "dual" && capability != family && hasV4 && hasV6 {
+		return false
+	}
+	if !hasV4 || !hasV6 {
+		// Single-family service: nothing to prefer between.
+		return true
+	}
+	switch policy {
+	case "prefer_v4":
+		return family == "v4" || capability == "v6"
+	case "prefer_v6":
+		return family == "v6" || capability == "v4"
+	}
+	return true
+}
+
+// ipFamilyPlugin enforces the policy on pushed assignments. It is
+// registered by NewDiscoveryServer when PILOT_IP_FAMILY_POLICY is set.
+type ipFamilyPlugin struct {
+	s *DiscoveryServer
+}
+
+func (p *ipFamilyPlugin) Name() string {
+	return "ipfamily"
+}
+
+// OnPushEds drops endpoints of the non-preferred family and reports the
+// number withheld per cluster through push status.
+func (p *ipFamilyPlugin) OnPushEds(con *XdsConnection, cla *xdsapi.ClusterLoadAssignment) (*xdsapi.ClusterLoadAssignment, error) {
+	_, _, hostname, _, err := model.ParseSubsetKeyStrict(cla.ClusterName)
+	if err != nil {
+		return cla, nil
+	}
+	policy := ipFamilyPolicy.policyFor(hostname)
+	capability := proxyIPFamily(con.modelNode)
+	if policy == "both" && capability == "dual" {
+		return cla, nil
+	}
+
+	hasV4, hasV6 := false, false
+	for _, locEps := range cla.Endpoints {
+		for _, ep := range locEps.LbEndpoints {
+			switch lbEndpointFamily(&ep) {
+			case "v4":
+				hasV4 = true
+			case "v6":
+				hasV6 = true
+			}
+		}
+	}
+
+	dropped := 0
+	filtered := make([]endpoint.LocalityLbEndpoints, 0, len(cla.Endpoints))
+	for _, locEps := range cla.Endpoints {
+		keep := make([]endpoint.LbEndpoint, 0, len(locEps.LbEndpoints))
+		for _, ep := range locEps.LbEndpoints {
+			if !emitFamily(lbEndpointFamily(&ep), policy, capability, hasV4, hasV6) {
+				dropped++
+				continue
+			}
+			keep = append(keep, ep)
+		}
+		if len(keep) == len(locEps.LbEndpoints) {
+			filtered = append(filtered, locEps)
+			continue
+		}
+		if len(keep) == 0 {
+			continue
+		}
+		locEps.LbEndpoints = keep
+		locEps.LoadBalancingWeight = &types.UInt32Value{Value: uint32(len(keep))}
+		filtered = append(filtered, locEps)
+	}
+	if dropped == 0 {
+		return cla, nil
+	}
+
+	push := p.s.Env.PushContext
+	push.Add(model.ProxyStatusIPFamilyFiltered, cla.ClusterName, con.modelNode,
+		fmt.Sprintf("%d endpoints withheld by policy %s for %s proxy", dropped, policy, capability))
+
+	return &xdsapi.ClusterLoadAssignment{
+		ClusterName: cla.ClusterName,
+		Endpoints:   filtered,
+		Policy:      cla.Policy,
+	}, nil
+}
+
+// OnPushCds leaves clusters untouched - the policy only restricts endpoints.
+func (p *ipFamilyPlugin) OnPushCds(con *XdsConnection, cluster *xdsapi.Cluster) (*xdsapi.Cluster, error) {
+	return cluster, nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"testing"
+)
+
+func TestEmitFamily(t *testing.T) {
+	cases := []struct {
+		name                       string
+		family, policy, capability string
+		hasV4, hasV6               bool
+		emit                       bool
+	}{
+		{"both policy dual proxy", "v6", "both", "dual", true, true, true},
+		{"prefer v4 drops v6", "v6", "prefer_v4", "dual", true, true, false},
+		{"prefer v4 keeps v4", "v4", "prefer_v4", "dual", true, true, true},
+		{"prefer v6 drops v4", "v4", "prefer_v6", "dual", true, true, false},
+		{"prefer v4 but v6-only proxy", "v6", "prefer_v4", "v6", true, true, true},
+		{"v4-only proxy never gets v6", "v6", "both", "v4", true, true, false},
+		{"single family untouched", "v6", "prefer_v4", "dual", false, true, true},
+		{"non-ip endpoints untouched", "", "prefer_v4", "v4", true, true, true},
+	}
+	for _, c := range cases {
+		if got := emitFamily(c.family, c.policy, c.capability, c.hasV4, c.hasV6); got != c.emit {
+			t.Errorf("%s: emitFamily(%q, %q, %q, %v, %v) = %v, want %v",
+				c.name, c.family, c.policy, c.capability, c.hasV4, c.hasV6, got, c.emit)
+		}
+	}
+}
+
+func TestPolicyFor(t *testing.T) {
+	p := &IPFamilyPolicy{
+		Default:  "both",
+		Services: map[string]string{"*.internal": "prefer_v6"},
+	}
+	if got := p.policyFor("db.internal"); got != "prefer_v6" {
+		t.Errorf("policyFor(db.internal) = %q", got)
+	}
+	if got := p.policyFor("web.ns.svc.cluster.local"); got != "both" {
+		t.Errorf("policyFor(web.ns.svc.cluster.local) = %q", got)
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"strings"
+
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/features/pilot"
+)
+
+// localityLabels holds the label names mapped to region, zone and subzone,
+// configured with PILOT_LOCALITY_LABELS. Empty entries are skipped.
+var localityLabels = parseLocalityLabels(pilot.LocalityLabels)
+
+func parseLocalityLabels(env string) [3]string {
+	out := [3]string{}
+	if env == "" {
+		return out
+	}
+	for i, l := range strings.Split(env, ",") {
+		if i >= len(out) {
+			break
+		}
+		out[i] = strings.TrimSpace(l)
+	}
+	return out
+}
+
+// localityFromLabels builds the three-level locality for an endpoint from its
+// labels. Configured custom labels (e.g. rack labels in on-prem clusters) win;
+// otherwise the registry-provided availability zone is used as the zone, which
+// matches the older Pilot datamodel.
+func localityFromLabels(labels map[string]string) core.Locality {
+	loc := core.Locality{
+		Region:  labels[localityLabels[0]],
+		Zone:    labels[localityLabels[1]],
+		SubZone: labels[localityLabels[2]],
+	}
+	if loc.Region == "" && loc.Zone == "" && loc.SubZone == "" {
+		loc.Zone = labels[model.AZLabel]
+	}
+	return loc
+}
+
+// localityKey returns the map key grouping endpoints of the same locality.
+func localityKey(loc *core.Locality) string {
+	return loc.Region + "/" + loc.Zone + "/" + loc.SubZone
+}
@@ -0,0 +1,53 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"testing"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+func TestLocalityFromLabels(t *testing.T) {
+	saved := localityLabels
+	defer func() { localityLabels = saved }()
+
+	localityLabels = parseLocalityLabels("topology.example.com/region, topology.example.com/zone, example.com/rack")
+
+	loc := localityFromLabels(map[string]string{
+		"topology.example.com/region": "us-east",
+		"topology.example.com/zone":   "dc-1",
+		"example.com/rack":            "rack-42",
+	})
+	if loc.Region != "us-east" || loc.Zone != "dc-1" || loc.SubZone != "rack-42" {
+		t.Errorf("unexpected locality from custom labels: %v", loc)
+	}
+	if key := localityKey(&loc); key != "us-east/dc-1/rack-42" {
+		t.Errorf("unexpected locality key %q", key)
+	}
+
+	// Without any custom label present, fall back to the availability zone label.
+	loc = localityFromLabels(map[string]string{model.AZLabel: "az-1"})
+	if loc.Region != "" || loc.Zone != "az-1" || loc.SubZone != "" {
+		t.Errorf("expected az fallback, got %v", loc)
+	}
+
+	// Without configuration the availability zone is used directly.
+	localityLabels = parseLocalityLabels("")
+	loc = localityFromLabels(map[string]string{model.AZLabel: "az-2"})
+	if loc.Zone != "az-2" {
+		t.Errorf("expected az-2, got %v", loc)
+	}
+}
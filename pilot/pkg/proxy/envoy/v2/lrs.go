@@ -0,0 +1,246 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/endpoint"
+	lrsgrpc "github.com/envoyproxy/go-control-plane/envoy/service/load_stats/v2"
+	"github.com/gogo/protobuf/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/peer"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+// LRS gives the control plane a mesh-wide view of what the data plane is
+// actually doing with the endpoints we push. The reports are aggregated per
+// cluster/endpoint, and endpoints that proxies keep reporting as failing
+// (errors with no successes) are flagged as likely ejected by outlier
+// detection - visible in /debug/outlierz and metrics.
+
+// lrsReportInterval is the interval proxies are asked to report load at.
+const lrsReportInterval = 30 * time.Second
+
+// lrsStaleAfter is how long a report is considered representative; older
+// entries are dropped from the view.
+const lrsStaleAfter = 5 * time.Minute
+
+// endpointLoad aggregates the most recent reports for one endpoint of a
+// cluster, across all reporting proxies.
+type endpointLoad struct {
+	// Success and Errors accumulate the request counts reported since the
+	// entry was last reset.
+	Success uint64
+	Errors  uint64
+
+	// Reporters is the set of proxies that contributed to the entry.
+	Reporters map[string]bool
+
+	// LastReport is when the entry was last updated.
+	LastReport time.Time
+}
+
+// Ejected reports whether the endpoint looks ejected: traffic is attempted
+// and everything fails.
+func (l *endpointLoad) Ejected() bool {
+	return l.Errors > 0 && l.Success == 0
+}
+
+var (
+	// lrsMutex guards lrsLoads.
+	lrsMutex sync.RWMutex
+
+	// lrsLoads aggregates reports by cluster name, then endpoint address.
+	lrsLoads = map[string]map[string]*endpointLoad{}
+
+	lrsEjectedEndpoints = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "pilot_lrs_ejected_endpoints",
+		Help: "Endpoints reported by proxies as failing all requests, likely ejected by outlier detection.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(lrsEjectedEndpoints)
+}
+
+// StreamLoadStats implements the Load Reporting Service. All clusters are
+// subscribed with endpoint granularity.
+func (s *DiscoveryServer) StreamLoadStats(stream lrsgrpc.LoadReportingService_StreamLoadStatsServer) error {
+	peerAddr := "0.0.0.0"
+	if peerInfo, ok := peer.FromContext(stream.Context()); ok {
+		peerAddr = peerInfo.Addr.String()
+	}
+
+	nodeID := ""
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if nodeID == "" && req.Node != nil {
+			nodeID = req.Node.Id
+			adsLog.Infof("LRS: new reporter %s from %s", nodeID, peerAddr)
+		}
+
+		recordLoadStats(nodeID, req.ClusterStats)
+
+		res := &lrsgrpc.LoadStatsResponse{
+			// Empty cluster list with endpoint granularity: report on
+			// everything the proxy has.
+			LoadReportingInterval:     types.DurationProto(lrsReportInterval),
+			ReportEndpointGranularity: true,
+		}
+		if err := stream.Send(res); err != nil {
+			return err
+		}
+	}
+}
+
+// recordLoadStats merges one report into the aggregated per-endpoint view.
+func recordLoadStats(nodeID string, stats []*endpoint.ClusterStats) {
+	if len(stats) == 0 {
+		return
+	}
+	now := time.Now()
+	lrsMutex.Lock()
+	defer lrsMutex.Unlock()
+	for _, cs := range stats {
+		eps := lrsLoads[cs.ClusterName]
+		if eps == nil {
+			eps = map[string]*endpointLoad{}
+			lrsLoads[cs.ClusterName] = eps
+		}
+		for _, ls := range cs.UpstreamLocalityStats {
+			for _, es := range ls.UpstreamEndpointStats {
+				addr := ""
+				if sa := es.Address.GetSocketAddress(); sa != nil {
+					addr = sa.Address
+				}
+				if addr == "" {
+					continue
+				}
+				l := eps[addr]
+				if l == nil || now.Sub(l.LastReport) > lrsStaleAfter {
+					l = &endpointLoad{Reporters: map[string]bool{}}
+					eps[addr] = l
+				}
+				l.Success += es.TotalSuccessfulRequests
+				l.Errors += es.TotalErrorRequests
+				if nodeID != "" {
+					l.Reporters[nodeID] = true
+				}
+				l.LastReport = now
+				if l.Ejected() {
+					_, _, hostname, _, err := model.ParseSubsetKeyStrict(cs.ClusterName)
+					if err == nil {
+						emitAnomaly(AnomalyEndpointEject, string(hostname),
+							fmt.Sprintf("endpoint %s of %s is failing all requests (%d errors)", addr, cs.ClusterName, l.Errors))
+					}
+				}
+			}
+		}
+	}
+	updateEjectedGaugeLocked(now)
+}
+
+// updateEjectedGaugeLocked recounts ejected endpoints. Caller must hold
+// lrsMutex.
+func updateEjectedGaugeLocked(now time.Time) {
+	ejected := 0
+	for _, eps := range lrsLoads {
+		for addr, l := range eps {
+			if now.Sub(l.LastReport) > lrsStaleAfter {
+				delete(eps, addr)
+				continue
+			}
+			if l.Ejected() {
+				ejected++
+			}
+		}
+	}
+	lrsEjectedEndpoints.Set(float64(ejected))
+}
+
+// OutlierEndpoint is one endpoint in the outlierz view.
+type OutlierEndpoint struct {
+	Address   string
+	Success   uint64
+	Errors    uint64
+	Reporters int
+	// InShards is false when the data plane reports an endpoint discovery no
+	// longer knows about - usually a proxy lagging behind a push.
+	InShards bool
+}
+
+// outlierz reports endpoints the data plane keeps failing on, grouped by
+// service, cross-checked against shard state.
+// It is mapped to /debug/outlierz on the monitor port (9093).
+func (s *DiscoveryServer) outlierz(w http.ResponseWriter, req *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+
+	out := map[string][]OutlierEndpoint{}
+	now := time.Now()
+	lrsMutex.RLock()
+	for clusterName, eps := range lrsLoads {
+		_, _, hostname, _ := model.ParseSubsetKey(clusterName)
+		for addr, l := range eps {
+			if now.Sub(l.LastReport) > lrsStaleAfter || !l.Ejected() {
+				continue
+			}
+			out[string(hostname)] = append(out[string(hostname)], OutlierEndpoint{
+				Address:   addr,
+				Success:   l.Success,
+				Errors:    l.Errors,
+				Reporters: len(l.Reporters),
+				InShards:  s.endpointInShards(string(hostname), addr),
+			})
+		}
+	}
+	lrsMutex.RUnlock()
+
+	b, _ := json.MarshalIndent(out, " ", " ")
+	_, _ = w.Write(b)
+}
+
+// endpointInShards checks whether discovery still has the address for the
+// service.
+func (s *DiscoveryServer) endpointInShards(serviceName, address string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	ep, f := s.EndpointShardsByService[serviceName]
+	if !f {
+		return false
+	}
+	ep.mutex.RLock()
+	defer ep.mutex.RUnlock()
+	for _, shard := range ep.Shards {
+		for _, e := range shard.Entries {
+			if e.Address == address {
+				return true
+			}
+		}
+	}
+	return false
+}
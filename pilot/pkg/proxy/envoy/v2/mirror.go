@@ -0,0 +1,121 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	networking "istio.io/api/networking/v1alpha3"
+	"istio.io/istio/pilot/pkg/model"
+)
+
+// Routes can mirror traffic to a shadow service the proxy never subscribed
+// to on its own. The endpoints of mirror targets are derived at push time
+// and included with the proxy's EDS response, so mirrored requests don't
+// fail while Envoy warms the cluster. Derived watches are tracked per
+// connection and dropped again when the mirror is removed.
+
+var derivedWatchEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "pilot_eds_derived_watches",
+	Help: "EDS watches derived from traffic mirroring, by event (add, remove).",
+}, []string{"event"})
+
+func init() {
+	prometheus.MustRegister(derivedWatchEvents)
+}
+
+// mirrorHosts collects the mirror target hosts of all virtual services.
+// Hosts were resolved to FQDNs when the push context was initialized.
+func mirrorHosts(push *model.PushContext) map[string]bool {
+	out := map[string]bool{}
+	for _, cfg := range push.VirtualServiceConfigs {
+		vs, ok := cfg.Spec.(*networking.VirtualService)
+		if !ok {
+			continue
+		}
+		for _, http := range vs.Http {
+			if http.Mirror != nil && http.Mirror.Host != "" {
+				out[http.Mirror.Host] = true
+			}
+		}
+	}
+	return out
+}
+
+// derivedMirrorClusters returns the clusters this connection needs beyond
+// its own subscriptions: one outbound cluster per port of each mirror
+// target known to the mesh.
+func (s *DiscoveryServer) derivedMirrorClusters(push *model.PushContext, con *XdsConnection) []string {
+	hosts := mirrorHosts(push)
+	if len(hosts) == 0 {
+		return nil
+	}
+	subscribed := map[string]bool{}
+	con.mu.RLock()
+	for _, c := range con.Clusters {
+		subscribed[c] = true
+	}
+	con.mu.RUnlock()
+	out := []string{}
+	for host := range hosts {
+		ports, f := push.ServicePort2Name[host]
+		if !f {
+			continue
+		}
+		for _, port := range ports {
+			cn := model.BuildSubsetKey(model.TrafficDirectionOutbound, "", model.Hostname(host), port.Port)
+			if !subscribed[cn] {
+				out = append(out, cn)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// updateDerivedWatches reconciles the connection's derived EDS watches with
+// the current mirror configuration and returns the derived cluster list.
+// Watches whose mirror was removed are unregistered, so the cluster can be
+// garbage collected once no proxy needs it.
+func (s *DiscoveryServer) updateDerivedWatches(push *model.PushContext, con *XdsConnection) []string {
+	derived := s.derivedMirrorClusters(push, con)
+	want := make(map[string]bool, len(derived))
+	for _, c := range derived {
+		want[c] = true
+	}
+
+	con.mu.Lock()
+	prev := con.DerivedClusters
+	con.DerivedClusters = derived
+	con.mu.Unlock()
+
+	had := make(map[string]bool, len(prev))
+	for _, c := range prev {
+		had[c] = true
+		if !want[c] {
+			s.removeEdsCon(c, con.ConID, con)
+			derivedWatchEvents.With(prometheus.Labels{"event": "remove"}).Add(1)
+		}
+	}
+	for _, c := range derived {
+		if !had[c] {
+			s.addEdsCon(c, con.ConID, con)
+			derivedWatchEvents.With(prometheus.Labels{"event": "add"}).Add(1)
+		}
+	}
+	return derived
+}
@@ -0,0 +1,95 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// A proxy subscribing to clusters Pilot cannot serve - unparseable names,
+// or services Pilot does not know - signals a mismatch between the CDS
+// output and the service state. The offenders are recorded per connection
+// with counts and exposed on /debug/missingz, instead of being only log
+// noise.
+
+// MissingCluster is one cluster a connection requested but Pilot could not
+// serve.
+type MissingCluster struct {
+	Cluster  string
+	Reason   string
+	Count    int
+	LastSeen time.Time
+}
+
+var missingClusters = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "pilot_xds_missing_clusters",
+	Help: "EDS subscriptions Pilot could not serve, by reason (malformed, no_service).",
+}, []string{"reason"})
+
+func init() {
+	prometheus.MustRegister(missingClusters)
+}
+
+// recordMissingCluster notes that the connection asked for a cluster Pilot
+// cannot serve.
+func recordMissingCluster(con *XdsConnection, clusterName, reason string) {
+	missingClusters.With(prometheus.Labels{"reason": reason}).Add(1)
+	con.mu.Lock()
+	defer con.mu.Unlock()
+	if con.missingClusters == nil {
+		con.missingClusters = map[string]*MissingCluster{}
+	}
+	mc, f := con.missingClusters[clusterName]
+	if !f {
+		mc = &MissingCluster{Cluster: clusterName, Reason: reason}
+		con.missingClusters[clusterName] = mc
+	}
+	mc.Reason = reason
+	mc.Count++
+	mc.LastSeen = time.Now()
+}
+
+// clearMissingCluster drops the record once the cluster becomes servable.
+func clearMissingCluster(con *XdsConnection, clusterName string) {
+	con.mu.Lock()
+	defer con.mu.Unlock()
+	delete(con.missingClusters, clusterName)
+}
+
+// missingz lists per connection the requested clusters Pilot could not
+// serve.
+func (s *DiscoveryServer) missingz(w http.ResponseWriter, req *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	out := map[string][]*MissingCluster{}
+	adsClientsMutex.RLock()
+	for conID, con := range adsClients {
+		con.mu.RLock()
+		if len(con.missingClusters) > 0 {
+			list := make([]*MissingCluster, 0, len(con.missingClusters))
+			for _, mc := range con.missingClusters {
+				list = append(list, mc)
+			}
+			out[conID] = list
+		}
+		con.mu.RUnlock()
+	}
+	adsClientsMutex.RUnlock()
+	b, _ := json.MarshalIndent(out, " ", " ")
+	_, _ = w.Write(b)
+}
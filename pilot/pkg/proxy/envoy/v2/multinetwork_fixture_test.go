@@ -0,0 +1,180 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/endpoint"
+	"github.com/gogo/protobuf/types"
+
+	meshconfig "istio.io/api/mesh/v1alpha1"
+	"istio.io/istio/pilot/pkg/model"
+)
+
+// MultiNetworkFixture assembles the pieces a split-horizon test needs -
+// MeshNetworks with gateways, per-network endpoints and proxies carrying
+// network metadata - so scenario tests describe the mesh instead of
+// hand-rolling proto structures.
+//
+//	f := NewMultiNetworkFixture().
+//		Network("network1", "1.1.1.1", 80).
+//		Network("network2", "2.2.2.2", 80).
+//		Endpoints("network1", "10.0.0.1", "10.0.0.2").
+//		Endpoints("network2", "20.0.0.1")
+//	filtered := EndpointsByNetworkFilter(f.ClusterEndpoints(), f.Proxy("network1"), f.Environment())
+type MultiNetworkFixture struct {
+	// networkOrder preserves insertion order so generated endpoints are
+	// deterministic across runs.
+	networkOrder []string
+	gateways     map[string][]*meshconfig.Network_IstioNetworkGateway
+	endpoints    map[string][]string
+	localities   map[string]*core.Locality
+}
+
+// NewMultiNetworkFixture returns an empty fixture.
+func NewMultiNetworkFixture() *MultiNetworkFixture {
+	return &MultiNetworkFixture{
+		gateways:   map[string][]*meshconfig.Network_IstioNetworkGateway{},
+		endpoints:  map[string][]string{},
+		localities: map[string]*core.Locality{},
+	}
+}
+
+func (f *MultiNetworkFixture) ensureNetwork(name string) {
+	for _, n := range f.networkOrder {
+		if n == name {
+			return
+		}
+	}
+	f.networkOrder = append(f.networkOrder, name)
+	f.gateways[name] = []*meshconfig.Network_IstioNetworkGateway{}
+}
+
+// Network declares a network with one gateway. Call it again with the same
+// name to add a second gateway; use NetworkWithoutGateway for a network
+// reachable only directly.
+func (f *MultiNetworkFixture) Network(name, gatewayAddress string, port uint32) *MultiNetworkFixture {
+	f.ensureNetwork(name)
+	f.gateways[name] = append(f.gateways[name], &meshconfig.Network_IstioNetworkGateway{
+		Gw: &meshconfig.Network_IstioNetworkGateway_Address{
+			Address: gatewayAddress,
+		},
+		Port: port,
+	})
+	return f
+}
+
+// NetworkWithoutGateway declares a network that has no gateway, to test the
+// behavior for unreachable remote endpoints.
+func (f *MultiNetworkFixture) NetworkWithoutGateway(name string) *MultiNetworkFixture {
+	f.ensureNetwork(name)
+	return f
+}
+
+// Endpoints adds endpoints on a network, by address.
+func (f *MultiNetworkFixture) Endpoints(network string, addresses ...string) *MultiNetworkFixture {
+	f.ensureNetwork(network)
+	f.endpoints[network] = append(f.endpoints[network], addresses...)
+	return f
+}
+
+// Locality sets the locality of a network's endpoints.
+func (f *MultiNetworkFixture) Locality(network, region, zone string) *MultiNetworkFixture {
+	f.ensureNetwork(network)
+	f.localities[network] = &core.Locality{Region: region, Zone: zone}
+	return f
+}
+
+// Environment returns a model.Environment with the fixture's MeshNetworks.
+func (f *MultiNetworkFixture) Environment() *model.Environment {
+	networks := map[string]*meshconfig.Network{}
+	for _, name := range f.networkOrder {
+		networks[name] = &meshconfig.Network{Gateways: f.gateways[name]}
+	}
+	return &model.Environment{
+		MeshNetworks: &meshconfig.MeshNetworks{Networks: networks},
+	}
+}
+
+// ClusterEndpoints returns the fixture's endpoints as one LocalityLbEndpoints
+// per network, each endpoint tagged with its network in the Istio filter
+// metadata - the shape the split-horizon filter consumes.
+func (f *MultiNetworkFixture) ClusterEndpoints() []endpoint.LocalityLbEndpoints {
+	out := []endpoint.LocalityLbEndpoints{}
+	for _, name := range f.networkOrder {
+		addresses := f.endpoints[name]
+		if len(addresses) == 0 {
+			continue
+		}
+		locLbEp := endpoint.LocalityLbEndpoints{
+			Locality: f.localities[name],
+			LoadBalancingWeight: &types.UInt32Value{
+				Value: uint32(len(addresses)),
+			},
+		}
+		for _, addr := range addresses {
+			locLbEp.LbEndpoints = append(locLbEp.LbEndpoints, networkLbEndpoint(addr, name))
+		}
+		out = append(out, locLbEp)
+	}
+	return out
+}
+
+// Proxy returns a connection for a sidecar on the given network. An empty
+// network returns a proxy without network metadata - the pre-multi-network
+// behavior.
+func (f *MultiNetworkFixture) Proxy(network string) *XdsConnection {
+	var metadata map[string]string
+	if network != "" {
+		metadata = map[string]string{"NETWORK": network}
+	}
+	return &XdsConnection{
+		ConID: connectionID("fixture.test"),
+		modelNode: &model.Proxy{
+			ID:       "fixture.test",
+			Type:     model.Sidecar,
+			Metadata: metadata,
+		},
+	}
+}
+
+// networkLbEndpoint builds one LbEndpoint with the network recorded in the
+// Istio filter metadata, the same way the EDS generator tags endpoints.
+func networkLbEndpoint(address, network string) endpoint.LbEndpoint {
+	return endpoint.LbEndpoint{
+		Endpoint: &endpoint.Endpoint{
+			Address: &core.Address{
+				Address: &core.Address_SocketAddress{
+					SocketAddress: &core.SocketAddress{
+						Address: address,
+					},
+				},
+			},
+		},
+		Metadata: &core.Metadata{
+			FilterMetadata: map[string]*types.Struct{
+				"istio": {
+					Fields: map[string]*types.Value{
+						"network": {
+							Kind: &types.Value_StringValue{
+								StringValue: network,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"testing"
+)
+
+// Scenario tests for split-horizon EDS, built on the multi-network fixture.
+
+func TestSplitHorizonScenarios(t *testing.T) {
+	f := NewMultiNetworkFixture().
+		Network("network1", "1.1.1.1", 80).
+		Network("network2", "2.2.2.2", 80).
+		NetworkWithoutGateway("network3").
+		Endpoints("network1", "10.0.0.1", "10.0.0.2").
+		Endpoints("network2", "20.0.0.1").
+		Endpoints("network3", "30.0.0.1")
+	env := f.Environment()
+
+	cases := []struct {
+		name string
+		// network the watching proxy is on; "" means no network metadata
+		proxyNetwork string
+		// address of the first LbEndpoint per expected LocalityLbEndpoints,
+		// with the expected weight
+		want map[string]uint32
+	}{
+		{
+			// Local endpoints stay direct; network2 is reached through its
+			// gateway with weight 1; network3 has no gateway and is dropped.
+			name:         "local plus remote gateway",
+			proxyNetwork: "network1",
+			want:         map[string]uint32{"10.0.0.1": 2, "2.2.2.2": 1},
+		},
+		{
+			// Both remote networks with gateways collapse to gateway
+			// endpoints weighted by their endpoint counts.
+			name:         "all remote",
+			proxyNetwork: "network3",
+			want:         map[string]uint32{"1.1.1.1": 2, "2.2.2.2": 1, "30.0.0.1": 1},
+		},
+		{
+			// A proxy without network metadata gets the unfiltered set.
+			name:         "no network metadata",
+			proxyNetwork: "",
+			want:         map[string]uint32{"10.0.0.1": 2, "20.0.0.1": 1, "30.0.0.1": 1},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			filtered := EndpointsByNetworkFilter(f.ClusterEndpoints(), f.Proxy(c.proxyNetwork), env)
+			if len(filtered) != len(c.want) {
+				t.Fatalf("got %d LocalityLbEndpoints, want %d: %v", len(filtered), len(c.want), filtered)
+			}
+			for _, ep := range filtered {
+				addr := ep.LbEndpoints[0].Endpoint.Address.GetSocketAddress().Address
+				weight, ok := c.want[addr]
+				if !ok {
+					t.Errorf("unexpected endpoint %s", addr)
+					continue
+				}
+				if ep.LoadBalancingWeight.GetValue() != weight {
+					t.Errorf("endpoint %s weight %d, want %d", addr, ep.LoadBalancingWeight.GetValue(), weight)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitHorizonGatewayLocality(t *testing.T) {
+	f := NewMultiNetworkFixture().
+		Network("network1", "1.1.1.1", 80).
+		Network("network2", "2.2.2.2", 80).
+		Endpoints("network1", "10.0.0.1").
+		Endpoints("network2", "20.0.0.1").
+		Locality("network2", "europe-west4", "europe-west4-a")
+
+	filtered := EndpointsByNetworkFilter(f.ClusterEndpoints(), f.Proxy("network1"), f.Environment())
+	for _, ep := range filtered {
+		if ep.LbEndpoints[0].Endpoint.Address.GetSocketAddress().Address != "2.2.2.2" {
+			continue
+		}
+		if ep.Locality == nil || ep.Locality.Region != "europe-west4" {
+			t.Errorf("gateway endpoint locality = %v, want europe-west4", ep.Locality)
+		}
+		return
+	}
+	t.Fatalf("no gateway endpoint for network2 in %v", filtered)
+}
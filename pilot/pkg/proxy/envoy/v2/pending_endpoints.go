@@ -0,0 +1,85 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+// Registries deliver service and endpoint events on independent watches, so
+// endpoints can arrive before their service is known (ServicePort2Name has no
+// entry yet). Such updates used to force an expensive full push just to pick
+// up the stray endpoints. Instead they are parked here, keyed by hostname,
+// and replayed through the normal update path when SvcUpdate delivers the
+// service definition.
+
+var (
+	edsOutOfOrderEndpoints = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "pilot_eds_out_of_order_updates",
+		Help: "Endpoint updates that arrived before their service definition and were buffered.",
+	})
+
+	edsPendingEndpoints = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "pilot_eds_pending_endpoints",
+		Help: "Endpoints currently buffered waiting for their service definition.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(edsOutOfOrderEndpoints)
+	prometheus.MustRegister(edsPendingEndpoints)
+}
+
+// bufferPendingLocked parks an endpoint update whose service has not been
+// seen yet, replacing any previous buffer for the same shard. Returns false
+// when the service is known, in which case the caller proceeds normally.
+// Caller must hold s.mutex.
+func (s *DiscoveryServer) bufferPendingLocked(pc *model.PushContext, shard, serviceName string,
+	entries []*model.IstioEndpoint) bool {
+	if _, f := pc.ServicePort2Name[serviceName]; f {
+		return false
+	}
+	if s.pendingEndpoints == nil {
+		s.pendingEndpoints = map[string]map[string][]*model.IstioEndpoint{}
+	}
+	shards, f := s.pendingEndpoints[serviceName]
+	if !f {
+		shards = map[string][]*model.IstioEndpoint{}
+		s.pendingEndpoints[serviceName] = shards
+	}
+	edsPendingEndpoints.Sub(float64(len(shards[shard])))
+	shards[shard] = entries
+	edsOutOfOrderEndpoints.Add(1)
+	edsPendingEndpoints.Add(float64(len(entries)))
+	adsLog.Infof("EDS: buffering %d endpoints for %s shard %s, service not yet defined",
+		len(entries), serviceName, shard)
+	return true
+}
+
+// takePendingLocked removes and returns the buffered shards for a service,
+// if any. Caller must hold s.mutex.
+func (s *DiscoveryServer) takePendingLocked(serviceName string) map[string][]*model.IstioEndpoint {
+	shards, f := s.pendingEndpoints[serviceName]
+	if !f {
+		return nil
+	}
+	delete(s.pendingEndpoints, serviceName)
+	for _, entries := range shards {
+		edsPendingEndpoints.Sub(float64(len(entries)))
+	}
+	return shards
+}
@@ -0,0 +1,234 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"istio.io/istio/pkg/features/pilot"
+)
+
+// A full push interrupted by a Pilot restart leaves no record of which
+// proxies got the new config. The push ledger tracks, per push generation,
+// which connections completed their push; with PILOT_PUSH_LEDGER_FILE it is
+// persisted across restarts, so reconnecting proxies that missed the
+// interrupted generation are detected (and excluded from stream resumption).
+// PILOT_PUSH_TIMEOUT bounds a generation: stragglers still pending after the
+// timeout are logged and counted instead of silently hanging the "push
+// finished" signal forever.
+
+var (
+	pushLedgerTimeout time.Duration
+
+	pushStragglers = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "pilot_push_stragglers",
+		Help: "Connections that had not completed a full push within PILOT_PUSH_TIMEOUT.",
+	})
+
+	pushInterruptedProxies = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "pilot_push_interrupted_proxies",
+		Help: "Reconnecting proxies that had missed the push generation interrupted by the last restart.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(pushStragglers)
+	prometheus.MustRegister(pushInterruptedProxies)
+	pushLedgerTimeout = envDuration(pilot.PushTimeout, 0)
+}
+
+// PushLedger records per-proxy completion of the current push generation.
+type PushLedger struct {
+	mu   sync.Mutex
+	path string
+
+	// previous is the ledger persisted by the last process, when it recorded
+	// an unfinished generation.
+	previous *pushGeneration
+
+	// Current generation, nil before the first full push.
+	current *pushGeneration
+}
+
+// pushGeneration is the persisted state of one full push.
+type pushGeneration struct {
+	Generation string               `json:"generation"`
+	Started    time.Time            `json:"started"`
+	Expected   map[string]bool      `json:"expected"`
+	Completed  map[string]time.Time `json:"completed"`
+	Finished   bool                 `json:"finished"`
+}
+
+// newPushLedger creates the ledger, loading the previous process's state
+// from the persistence file when one is configured.
+func newPushLedger(path string) *PushLedger {
+	l := &PushLedger{path: path}
+	if path == "" {
+		return l
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			adsLog.Warnf("Push ledger: reading %s: %v", path, err)
+		}
+		return l
+	}
+	b, err = OpenSnapshot(b)
+	if err != nil {
+		adsLog.Warnf("Push ledger: decrypting %s: %v", path, err)
+		return l
+	}
+	prev := &pushGeneration{}
+	if err := json.Unmarshal(b, prev); err != nil {
+		adsLog.Warnf("Push ledger: parsing %s: %v", path, err)
+		return l
+	}
+	if !prev.Finished {
+		adsLog.Infof("Push ledger: generation %s was interrupted, %d of %d proxies had completed",
+			prev.Generation, len(prev.Completed), len(prev.Expected))
+		l.previous = prev
+	}
+	return l
+}
+
+// begin opens a new push generation covering the given node IDs.
+func (l *PushLedger) begin(version string, nodeIDs []string) {
+	l.mu.Lock()
+	l.current = &pushGeneration{
+		Generation: version,
+		Started:    time.Now(),
+		Expected:   map[string]bool{},
+		Completed:  map[string]time.Time{},
+	}
+	for _, id := range nodeIDs {
+		l.current.Expected[id] = true
+	}
+	l.persistLocked()
+	l.mu.Unlock()
+
+	if pushLedgerTimeout > 0 {
+		time.AfterFunc(pushLedgerTimeout, func() { l.reportStragglers(version) })
+	}
+}
+
+// markCompleted records that a proxy finished its push for a generation.
+func (l *PushLedger) markCompleted(version, nodeID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.current == nil || l.current.Generation != version {
+		return
+	}
+	l.current.Completed[nodeID] = time.Now()
+	if !l.current.Finished && len(l.current.Completed) >= len(l.current.Expected) {
+		l.current.Finished = true
+		adsLog.Infof("Push ledger: generation %s complete, %d proxies in %v",
+			version, len(l.current.Completed), time.Since(l.current.Started))
+	}
+	l.persistLocked()
+}
+
+// interrupted reports whether the proxy missed the generation interrupted by
+// the last restart. Once reported, the proxy is counted and cleared, so the
+// full push it is about to receive settles its debt.
+func (l *PushLedger) interrupted(nodeID string) bool {
+	if nodeID == "" {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.previous == nil {
+		return false
+	}
+	if _, f := l.previous.Completed[nodeID]; f {
+		return false
+	}
+	if !l.previous.Expected[nodeID] {
+		return false
+	}
+	delete(l.previous.Expected, nodeID)
+	pushInterruptedProxies.Add(1)
+	adsLog.Infof("Push ledger: %s missed interrupted generation %s, forcing full push",
+		nodeID, l.previous.Generation)
+	return true
+}
+
+// reportStragglers logs connections still pending when the timeout fires.
+func (l *PushLedger) reportStragglers(version string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.current == nil || l.current.Generation != version || l.current.Finished {
+		return
+	}
+	for id := range l.current.Expected {
+		if _, f := l.current.Completed[id]; !f {
+			pushStragglers.Add(1)
+			adsLog.Warnf("Push ledger: %s did not complete push %s within %v", id, version, pushLedgerTimeout)
+		}
+	}
+}
+
+// persistLocked writes the current generation atomically. Caller holds l.mu.
+func (l *PushLedger) persistLocked() {
+	if l.path == "" || l.current == nil {
+		return
+	}
+	b, err := json.Marshal(l.current)
+	if err != nil {
+		return
+	}
+	// The ledger names every proxy in the mesh; with PILOT_SNAPSHOT_KEY it
+	// is encrypted at rest. A broken key skips the write - never plaintext.
+	b, err = SealSnapshot(b)
+	if err != nil {
+		adsLog.Warnf("Push ledger: not persisting %s: %v", l.path, err)
+		return
+	}
+	tmp := l.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		adsLog.Warnf("Push ledger: writing %s: %v", tmp, err)
+		return
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		adsLog.Warnf("Push ledger: renaming %s: %v", tmp, err)
+	}
+}
+
+// connectionNodeID is the stable proxy identity used in the ledger - the
+// node ID survives reconnects, unlike the ConID.
+func connectionNodeID(con *XdsConnection) string {
+	if con == nil || con.modelNode == nil {
+		return ""
+	}
+	return con.modelNode.ID
+}
+
+// ledgerz exposes the ledger state for debugging.
+func (s *DiscoveryServer) ledgerz(w http.ResponseWriter, req *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	s.pushLedger.mu.Lock()
+	out, _ := json.MarshalIndent(map[string]interface{}{
+		"current":  s.pushLedger.current,
+		"previous": s.pushLedger.previous,
+	}, " ", " ")
+	s.pushLedger.mu.Unlock()
+	_, _ = w.Write(out)
+}
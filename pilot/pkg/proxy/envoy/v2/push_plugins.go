@@ -0,0 +1,108 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"time"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PushPlugin is invoked at push time, once per generated resource for a given
+// proxy, similar in spirit to the networking plugins invoked at generation
+// time. A plugin can inspect and mutate the resource, or veto it by returning
+// an error - vendors use this for compliance filtering on endpoints.
+type PushPlugin interface {
+	// Name identifies the plugin in metrics and logs.
+	Name() string
+
+	// OnPushEds may replace the assignment pushed for a cluster. Returning an
+	// error vetoes the resource for this proxy.
+	OnPushEds(con *XdsConnection, cla *xdsapi.ClusterLoadAssignment) (*xdsapi.ClusterLoadAssignment, error)
+
+	// OnPushCds may replace a cluster. Returning an error vetoes the resource
+	// for this proxy.
+	OnPushCds(con *XdsConnection, cluster *xdsapi.Cluster) (*xdsapi.Cluster, error)
+}
+
+var (
+	pushPluginDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "pilot_xds_push_plugin_duration",
+		Help:    "Time spent in each push plugin, per invocation.",
+		Buckets: []float64{.0001, .001, .01, .1, 1},
+	}, []string{"plugin"})
+
+	pushPluginVetoes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pilot_xds_push_plugin_vetoes",
+		Help: "Resources vetoed by push plugins.",
+	}, []string{"plugin"})
+)
+
+func init() {
+	prometheus.MustRegister(pushPluginDuration)
+	prometheus.MustRegister(pushPluginVetoes)
+}
+
+// RegisterPushPlugin appends a plugin to the push-time chain. Must be called
+// before the server starts serving.
+func (s *DiscoveryServer) RegisterPushPlugin(p PushPlugin) {
+	s.pushPlugins = append(s.pushPlugins, p)
+}
+
+// applyEdsPushPlugins runs the chain on an assignment. The second return is
+// false if a plugin vetoed the resource.
+func (s *DiscoveryServer) applyEdsPushPlugins(con *XdsConnection, cla *xdsapi.ClusterLoadAssignment) (*xdsapi.ClusterLoadAssignment, bool) {
+	for _, p := range s.pushPlugins {
+		t0 := time.Now()
+		out, err := p.OnPushEds(con, cla)
+		pushPluginDuration.With(prometheus.Labels{"plugin": p.Name()}).Observe(time.Since(t0).Seconds())
+		if err != nil {
+			pushPluginVetoes.With(prometheus.Labels{"plugin": p.Name()}).Add(1)
+			adsLog.Infof("EDS: plugin %s vetoed %s for %s: %v", p.Name(), cla.ClusterName, con.ConID, err)
+			return nil, false
+		}
+		cla = out
+	}
+	return cla, true
+}
+
+// applyCdsPushPlugins runs the chain on the generated clusters, dropping the
+// vetoed ones.
+func (s *DiscoveryServer) applyCdsPushPlugins(con *XdsConnection, clusters []*xdsapi.Cluster) []*xdsapi.Cluster {
+	if len(s.pushPlugins) == 0 {
+		return clusters
+	}
+	out := make([]*xdsapi.Cluster, 0, len(clusters))
+	for _, c := range clusters {
+		vetoed := false
+		for _, p := range s.pushPlugins {
+			t0 := time.Now()
+			cc, err := p.OnPushCds(con, c)
+			pushPluginDuration.With(prometheus.Labels{"plugin": p.Name()}).Observe(time.Since(t0).Seconds())
+			if err != nil {
+				pushPluginVetoes.With(prometheus.Labels{"plugin": p.Name()}).Add(1)
+				adsLog.Infof("CDS: plugin %s vetoed %s for %s: %v", p.Name(), c.Name, con.ConID, err)
+				vetoed = true
+				break
+			}
+			c = cc
+		}
+		if !vetoed {
+			out = append(out, c)
+		}
+	}
+	return out
+}
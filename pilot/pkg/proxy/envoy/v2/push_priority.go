@@ -0,0 +1,70 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"sort"
+	"strings"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/features/pilot"
+)
+
+// During a full push connections are served in whatever order the connection
+// table yields, so an ingress gateway can sit behind hundreds of sidecars
+// while throttled. Gateways affect traffic entering the mesh and should
+// converge first; connections whose node type is in the priority set are
+// scheduled ahead of the rest. PILOT_PUSH_PRIORITY_TYPES overrides the set
+// ("-" disables prioritization).
+
+// priorityNodeTypes holds the prioritized types, from PILOT_PUSH_PRIORITY_TYPES.
+var priorityNodeTypes map[model.NodeType]bool
+
+func init() {
+	priorityNodeTypes = parsePriorityTypes(pilot.PushPriorityTypes)
+}
+
+// parsePriorityTypes builds the priority set: default router+ingress, "-"
+// for none.
+func parsePriorityTypes(env string) map[model.NodeType]bool {
+	switch env {
+	case "":
+		return map[model.NodeType]bool{model.Router: true, model.Ingress: true}
+	case "-":
+		return map[model.NodeType]bool{}
+	}
+	out := map[model.NodeType]bool{}
+	for _, t := range strings.Split(env, ",") {
+		out[model.NodeType(strings.TrimSpace(t))] = true
+	}
+	return out
+}
+
+// priorityConnection reports whether a connection belongs to the priority
+// lane.
+func priorityConnection(con *XdsConnection) bool {
+	return con.modelNode != nil && priorityNodeTypes[con.modelNode.Type]
+}
+
+// sortByPushPriority moves priority-lane connections to the front, keeping
+// the relative order within each class.
+func sortByPushPriority(pending []*XdsConnection) {
+	if len(priorityNodeTypes) == 0 {
+		return
+	}
+	sort.SliceStable(pending, func(i, j int) bool {
+		return priorityConnection(pending[i]) && !priorityConnection(pending[j])
+	})
+}
@@ -0,0 +1,129 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// A connection's place in the push pipeline used to live implicitly in
+// booleans and nonces, which made "why is this proxy not converging" a
+// debugging session. The explicit state machine tracks where each
+// connection is - idle, queued behind a push event, generating config,
+// sending, awaiting the ACK, or sitting on a NACK - with the time spent in
+// each state. A connection stuck in one state shows up both in the duration
+// histogram and on /debug/pushstatez.
+
+type pushState int
+
+const (
+	pushStateIdle pushState = iota
+	pushStateQueued
+	pushStateGenerating
+	pushStateSending
+	pushStateAwaitingAck
+	pushStateNacked
+)
+
+func (p pushState) String() string {
+	switch p {
+	case pushStateIdle:
+		return "idle"
+	case pushStateQueued:
+		return "queued"
+	case pushStateGenerating:
+		return "generating"
+	case pushStateSending:
+		return "sending"
+	case pushStateAwaitingAck:
+		return "awaiting_ack"
+	case pushStateNacked:
+		return "nacked"
+	}
+	return "unknown"
+}
+
+var pushStateDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "pilot_xds_push_state_seconds",
+	Help:    "Time connections spend in each push pipeline state.",
+	Buckets: []float64{.01, .1, 1, 5, 30, 120, 600},
+}, []string{"state"})
+
+func init() {
+	prometheus.MustRegister(pushStateDuration)
+}
+
+// setPushState transitions the connection, accounting the time spent in the
+// state it leaves.
+func (conn *XdsConnection) setPushState(next pushState) {
+	now := time.Now()
+	conn.mu.Lock()
+	if conn.pushState != next {
+		if !conn.pushStateSince.IsZero() {
+			pushStateDuration.With(prometheus.Labels{"state": conn.pushState.String()}).
+				Observe(now.Sub(conn.pushStateSince).Seconds())
+		}
+		conn.pushState = next
+		conn.pushStateSince = now
+	}
+	conn.mu.Unlock()
+}
+
+// noteAck marks the pipeline drained for this connection.
+func (conn *XdsConnection) noteAck() {
+	conn.setPushState(pushStateIdle)
+}
+
+// noteNack parks the connection in the nacked state until the next send.
+func (conn *XdsConnection) noteNack() {
+	conn.setPushState(pushStateNacked)
+}
+
+// PushStateStatus is one connection's pipeline state on /debug/pushstatez.
+type PushStateStatus struct {
+	ProxyID string  `json:"proxy"`
+	State   string  `json:"state"`
+	Since   string  `json:"since"`
+	Seconds float64 `json:"seconds"`
+}
+
+// pushstatez lists every connection's pipeline state, longest-stuck first.
+func (s *DiscoveryServer) pushstatez(w http.ResponseWriter, req *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	out := []PushStateStatus{}
+	adsClientsMutex.RLock()
+	for conID, con := range adsClients {
+		con.mu.RLock()
+		st := PushStateStatus{
+			ProxyID: conID,
+			State:   con.pushState.String(),
+			Since:   con.pushStateSince.Format(time.RFC3339),
+		}
+		if !con.pushStateSince.IsZero() {
+			st.Seconds = time.Since(con.pushStateSince).Seconds()
+		}
+		con.mu.RUnlock()
+		out = append(out, st)
+	}
+	adsClientsMutex.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Seconds > out[j].Seconds })
+	b, _ := json.MarshalIndent(out, " ", " ")
+	_, _ = w.Write(b)
+}
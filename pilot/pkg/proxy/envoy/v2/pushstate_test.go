@@ -0,0 +1,64 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"testing"
+)
+
+func TestPushStateTransitions(t *testing.T) {
+	con := newXdsConnection("127.0.0.1:8080", nil)
+	if con.pushState != pushStateIdle {
+		t.Fatalf("new connection in state %v, want idle", con.pushState)
+	}
+
+	con.setPushState(pushStateQueued)
+	con.setPushState(pushStateGenerating)
+	con.setPushState(pushStateSending)
+	con.setPushState(pushStateAwaitingAck)
+	since := con.pushStateSince
+
+	// Re-entering the same state must not reset the clock - that would hide
+	// a stuck connection.
+	con.setPushState(pushStateAwaitingAck)
+	if !con.pushStateSince.Equal(since) {
+		t.Errorf("re-entering a state reset pushStateSince")
+	}
+
+	con.noteNack()
+	if con.pushState != pushStateNacked {
+		t.Errorf("after NACK in state %v, want nacked", con.pushState)
+	}
+	con.noteAck()
+	if con.pushState != pushStateIdle {
+		t.Errorf("after ACK in state %v, want idle", con.pushState)
+	}
+}
+
+func TestPushStateString(t *testing.T) {
+	states := map[pushState]string{
+		pushStateIdle:        "idle",
+		pushStateQueued:      "queued",
+		pushStateGenerating:  "generating",
+		pushStateSending:     "sending",
+		pushStateAwaitingAck: "awaiting_ack",
+		pushStateNacked:      "nacked",
+	}
+	for st, want := range states {
+		if st.String() != want {
+			t.Errorf("%d.String() = %q, want %q", st, st.String(), want)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// Removing a remote cluster from a multicluster mesh removes its shard from
+// every service at once. The removal dry-run reports, per service, how many
+// endpoints that shard contributes and which services would be left empty -
+// so the operator sees the blast radius before touching the secret, not
+// after the proxies do.
+
+// ServiceImpact is the effect of a shard removal on one service.
+type ServiceImpact struct {
+	Service string `json:"service"`
+	// LostEndpoints is the number of endpoints the shard contributes.
+	LostEndpoints int `json:"lostEndpoints"`
+	// RemainingEndpoints counts endpoints from all other shards.
+	RemainingEndpoints int `json:"remainingEndpoints"`
+	// BecomesEmpty is set when no other shard has endpoints for the service.
+	BecomesEmpty bool `json:"becomesEmpty"`
+}
+
+// RegistryRemovalImpact is the dry-run report for removing one shard
+// (registry).
+type RegistryRemovalImpact struct {
+	Shard string `json:"shard"`
+	// Services lists only services the shard contributes endpoints to.
+	Services      []*ServiceImpact `json:"services"`
+	TotalLost     int              `json:"totalLost"`
+	EmptyServices int              `json:"emptyServices"`
+}
+
+// registryRemovalImpact analyzes EndpointShardsByService for one shard.
+func (s *DiscoveryServer) registryRemovalImpact(shard string) *RegistryRemovalImpact {
+	out := &RegistryRemovalImpact{
+		Shard:    shard,
+		Services: []*ServiceImpact{},
+	}
+
+	s.mutex.RLock()
+	services := make(map[string]*EndpointShardsByService, len(s.EndpointShardsByService))
+	for svc, ep := range s.EndpointShardsByService {
+		services[svc] = ep
+	}
+	s.mutex.RUnlock()
+
+	for svc, ep := range services {
+		shards, _ := ep.snapshot()
+		lost := 0
+		remaining := 0
+		for name, es := range shards {
+			if name == shard {
+				lost += len(es.Entries)
+			} else {
+				remaining += len(es.Entries)
+			}
+		}
+		if lost == 0 {
+			continue
+		}
+		out.Services = append(out.Services, &ServiceImpact{
+			Service:            svc,
+			LostEndpoints:      lost,
+			RemainingEndpoints: remaining,
+			BecomesEmpty:       remaining == 0,
+		})
+		out.TotalLost += lost
+		if remaining == 0 {
+			out.EmptyServices++
+		}
+	}
+	sort.Slice(out.Services, func(i, j int) bool { return out.Services[i].Service < out.Services[j].Service })
+	return out
+}
+
+// removalImpactz serves the registry removal dry-run:
+// GET /debug/registry_removal?shard=<registry>. Read-only, no token needed.
+func (s *DiscoveryServer) removalImpactz(w http.ResponseWriter, req *http.Request) {
+	shard := req.URL.Query().Get("shard")
+	if shard == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("missing shard parameter"))
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+	b, _ := json.MarshalIndent(s.registryRemovalImpact(shard), " ", " ")
+	_, _ = w.Write(b)
+}
@@ -0,0 +1,75 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"testing"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+func shardWithEndpoints(name string, addrs ...string) *EndpointShard {
+	es := &EndpointShard{Shard: name}
+	for _, a := range addrs {
+		es.Entries = append(es.Entries, &model.IstioEndpoint{Address: a, EndpointPort: 80})
+	}
+	return es
+}
+
+func TestRegistryRemovalImpact(t *testing.T) {
+	s := &DiscoveryServer{
+		EndpointShardsByService: map[string]*EndpointShardsByService{
+			// Loses one of three endpoints.
+			"web.ns.svc.cluster.local": {
+				Shards: map[string]*EndpointShard{
+					"remote1": shardWithEndpoints("remote1", "10.0.0.1"),
+					"local":   shardWithEndpoints("local", "10.1.0.1", "10.1.0.2"),
+				},
+			},
+			// Only exists in the removed registry - becomes empty.
+			"db.ns.svc.cluster.local": {
+				Shards: map[string]*EndpointShard{
+					"remote1": shardWithEndpoints("remote1", "10.0.0.5", "10.0.0.6"),
+				},
+			},
+			// Untouched by the removal - not reported.
+			"cache.ns.svc.cluster.local": {
+				Shards: map[string]*EndpointShard{
+					"local": shardWithEndpoints("local", "10.1.0.9"),
+				},
+			},
+		},
+	}
+
+	impact := s.registryRemovalImpact("remote1")
+	if len(impact.Services) != 2 {
+		t.Fatalf("got %d impacted services, want 2: %+v", len(impact.Services), impact.Services)
+	}
+	if impact.TotalLost != 3 {
+		t.Errorf("TotalLost = %d, want 3", impact.TotalLost)
+	}
+	if impact.EmptyServices != 1 {
+		t.Errorf("EmptyServices = %d, want 1", impact.EmptyServices)
+	}
+
+	db := impact.Services[0]
+	if db.Service != "db.ns.svc.cluster.local" || !db.BecomesEmpty || db.LostEndpoints != 2 {
+		t.Errorf("unexpected impact for db: %+v", db)
+	}
+	web := impact.Services[1]
+	if web.Service != "web.ns.svc.cluster.local" || web.BecomesEmpty || web.LostEndpoints != 1 || web.RemainingEndpoints != 2 {
+		t.Errorf("unexpected impact for web: %+v", web)
+	}
+}
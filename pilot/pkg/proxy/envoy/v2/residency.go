@@ -0,0 +1,136 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"fmt"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/endpoint"
+	"github.com/gogo/protobuf/types"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/features/pilot"
+)
+
+// Data-residency filtering: endpoints carrying the residency label (selected
+// by PILOT_RESIDENCY_LABEL) are only pushed to proxies declaring the same
+// residency in their node metadata. Unlabeled endpoints remain visible to
+// everyone. Withheld endpoints are reported through push status, so the
+// restriction is observable rather than a silent gap in EDS.
+
+// residencyLabel is the endpoint label carrying the residency zone.
+// Filtering is disabled when empty.
+var residencyLabel = pilot.ResidencyLabel
+
+// residencyMetadataKey is the node metadata key declaring the residency a
+// proxy belongs to, typically injected from a namespace label.
+const residencyMetadataKey = "RESIDENCY"
+
+// stampResidency copies the residency label into the endpoint's istio filter
+// metadata, so push-time filtering does not need the original labels.
+func stampResidency(ep *endpoint.LbEndpoint, labels map[string]string) {
+	if residencyLabel == "" {
+		return
+	}
+	residency := labels[residencyLabel]
+	if residency == "" {
+		return
+	}
+	if ep.Metadata == nil {
+		ep.Metadata = &core.Metadata{
+			FilterMetadata: map[string]*types.Struct{
+				"istio": {
+					Fields: map[string]*types.Value{},
+				},
+			},
+		}
+	}
+	ep.Metadata.FilterMetadata["istio"].Fields["residency"] = &types.Value{Kind: &types.Value_StringValue{StringValue: residency}}
+}
+
+// epResidency extracts the residency stamped on an endpoint, or "" for
+// unrestricted endpoints.
+func epResidency(ep *endpoint.LbEndpoint) string {
+	if ep.Metadata == nil || ep.Metadata.FilterMetadata["istio"] == nil ||
+		ep.Metadata.FilterMetadata["istio"].Fields == nil ||
+		ep.Metadata.FilterMetadata["istio"].Fields["residency"] == nil {
+		return ""
+	}
+	return ep.Metadata.FilterMetadata["istio"].Fields["residency"].GetStringValue()
+}
+
+// residencyPlugin is the built-in push plugin enforcing the restriction. It
+// is registered by NewDiscoveryServer when PILOT_RESIDENCY_LABEL is set.
+type residencyPlugin struct {
+	s *DiscoveryServer
+}
+
+func (p *residencyPlugin) Name() string {
+	return "residency"
+}
+
+// OnPushEds removes endpoints the proxy may not receive and reports the
+// number withheld per cluster through push status.
+func (p *residencyPlugin) OnPushEds(con *XdsConnection, cla *xdsapi.ClusterLoadAssignment) (*xdsapi.ClusterLoadAssignment, error) {
+	proxyResidency := ""
+	if con.modelNode != nil {
+		proxyResidency = con.modelNode.Metadata[residencyMetadataKey]
+	}
+
+	denied := 0
+	filtered := make([]endpoint.LocalityLbEndpoints, 0, len(cla.Endpoints))
+	for _, locEps := range cla.Endpoints {
+		keep := make([]endpoint.LbEndpoint, 0, len(locEps.LbEndpoints))
+		for _, ep := range locEps.LbEndpoints {
+			r := epResidency(&ep)
+			if r != "" && r != proxyResidency {
+				denied++
+				continue
+			}
+			keep = append(keep, ep)
+		}
+		if len(keep) == len(locEps.LbEndpoints) {
+			// Nothing withheld in this locality, keep it as is.
+			filtered = append(filtered, locEps)
+			continue
+		}
+		if len(keep) == 0 {
+			continue
+		}
+		locEps.LbEndpoints = keep
+		locEps.LoadBalancingWeight = &types.UInt32Value{Value: uint32(len(keep))}
+		filtered = append(filtered, locEps)
+	}
+	if denied == 0 {
+		return cla, nil
+	}
+
+	push := p.s.Env.PushContext
+	push.Add(model.ProxyStatusResidencyDenied, cla.ClusterName, con.modelNode,
+		fmt.Sprintf("%d endpoints withheld from residency %q", denied, proxyResidency))
+
+	return &xdsapi.ClusterLoadAssignment{
+		ClusterName: cla.ClusterName,
+		Endpoints:   filtered,
+		Policy:      cla.Policy,
+	}, nil
+}
+
+// OnPushCds leaves clusters untouched - residency only restricts endpoints.
+func (p *residencyPlugin) OnPushCds(con *XdsConnection, cluster *xdsapi.Cluster) (*xdsapi.Cluster, error) {
+	return cluster, nil
+}
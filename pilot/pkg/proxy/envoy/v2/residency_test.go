@@ -0,0 +1,79 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"testing"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/endpoint"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+func residencyEndpoint(t *testing.T, residency string) endpoint.LbEndpoint {
+	t.Helper()
+	ep := buildEnvoyLbEndpoint("uid", model.AddressFamilyTCP, "10.0.0.1", 80, "")
+	stampResidency(ep, map[string]string{residencyLabel: residency})
+	return *ep
+}
+
+func TestResidencyFilter(t *testing.T) {
+	saved := residencyLabel
+	residencyLabel = "residency"
+	defer func() { residencyLabel = saved }()
+
+	env := &model.Environment{PushContext: model.NewPushContext()}
+	p := &residencyPlugin{s: &DiscoveryServer{Env: env}}
+
+	cla := &xdsapi.ClusterLoadAssignment{
+		ClusterName: "outbound|80||svc.test.svc.cluster.local",
+		Endpoints: []endpoint.LocalityLbEndpoints{
+			{
+				LbEndpoints: []endpoint.LbEndpoint{
+					residencyEndpoint(t, "eu"),
+					residencyEndpoint(t, "us"),
+					residencyEndpoint(t, ""),
+				},
+			},
+		},
+	}
+
+	con := &XdsConnection{
+		ConID:     "test-1",
+		modelNode: &model.Proxy{ID: "test", Metadata: map[string]string{residencyMetadataKey: "eu"}},
+	}
+
+	out, err := p.OnPushEds(con, cla)
+	if err != nil {
+		t.Fatalf("unexpected veto: %v", err)
+	}
+	if len(out.Endpoints) != 1 || len(out.Endpoints[0].LbEndpoints) != 2 {
+		t.Fatalf("expected eu and unlabeled endpoints to remain, got %v", out.Endpoints)
+	}
+	if len(env.PushContext.ProxyStatus[model.ProxyStatusResidencyDenied.Name]) != 1 {
+		t.Errorf("expected a push status event for the withheld endpoint")
+	}
+
+	// A proxy with no declared residency only sees unrestricted endpoints.
+	con.modelNode.Metadata = map[string]string{}
+	out, err = p.OnPushEds(con, cla)
+	if err != nil {
+		t.Fatalf("unexpected veto: %v", err)
+	}
+	if len(out.Endpoints) != 1 || len(out.Endpoints[0].LbEndpoints) != 1 {
+		t.Fatalf("expected only the unlabeled endpoint, got %v", out.Endpoints)
+	}
+}
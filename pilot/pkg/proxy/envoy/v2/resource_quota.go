@@ -0,0 +1,65 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"istio.io/istio/pkg/features/pilot"
+)
+
+// Per-connection resource accounting: how many clusters each stream watches
+// and how many response bytes it has been sent, with an optional quota on
+// watched clusters. A single gateway subscribing to everything can otherwise
+// dominate Pilot's memory and push time.
+
+var (
+	// maxClustersPerConnection rejects EDS subscriptions watching more
+	// clusters than the limit. Zero (default) means no limit.
+	maxClustersPerConnection int
+
+	xdsBytesSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pilot_xds_response_bytes",
+		Help: "Response bytes sent to proxies, by xDS type.",
+	}, []string{"type"})
+
+	clusterQuotaRejections = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "pilot_xds_cluster_quota_rejections",
+		Help: "EDS subscriptions rejected for watching more clusters than PILOT_MAX_CLUSTERS_PER_CONNECTION.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(xdsBytesSent)
+	prometheus.MustRegister(clusterQuotaRejections)
+	maxClustersPerConnection = intEnv(pilot.MaxClustersPerConnection, 0)
+}
+
+// recordBytesSentLocked accounts a pushed response on the connection and the
+// global counter. Caller must hold conn.mu.
+func (conn *XdsConnection) recordBytesSentLocked(typeURL string, bytes int) {
+	short := xdsShortType(typeURL)
+	if conn.BytesSent == nil {
+		conn.BytesSent = map[string]uint64{}
+	}
+	conn.BytesSent[short] += uint64(bytes)
+	xdsBytesSent.With(prometheus.Labels{"type": short}).Add(float64(bytes))
+}
+
+// overClusterQuota reports whether a subscription exceeds the per-connection
+// cluster quota.
+func overClusterQuota(clusters []string) bool {
+	return maxClustersPerConnection > 0 && len(clusters) > maxClustersPerConnection
+}
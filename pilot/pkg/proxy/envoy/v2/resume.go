@@ -0,0 +1,61 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"istio.io/istio/pkg/features/pilot"
+)
+
+// Stream resumption: the first request on a reconnected stream carries the
+// version the proxy last accepted (version_info, per the xDS protocol). When
+// it matches the version we are currently serving, re-sending the resource is
+// pure reconnect-storm bandwidth - the proxy already has it. The next config
+// change pushes normally on the established watch.
+
+// streamResumption gates the optimization (PILOT_ENABLE_STREAM_RESUMPTION).
+var streamResumption = pilot.StreamResumption
+
+var xdsResumed = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "pilot_xds_resumed_watches",
+	Help: "Initial pushes skipped because the reconnecting proxy already held the current version.",
+}, []string{"type"})
+
+func init() {
+	prometheus.MustRegister(xdsResumed)
+}
+
+// canResume reports whether the initial push for a watch can be skipped: the
+// request declares the version the proxy holds, and it is the version we
+// would push. A proxy that missed the previous push generation (per the push
+// ledger) is never resumed - it must be brought up to date.
+func (s *DiscoveryServer) canResume(con *XdsConnection, discReq *xdsapi.DiscoveryRequest) bool {
+	if !streamResumption || discReq.VersionInfo == "" {
+		return false
+	}
+	if s.pushLedger.interrupted(connectionNodeID(con)) {
+		return false
+	}
+	return discReq.VersionInfo == versionInfo()
+}
+
+// resumeWatch records a skipped initial push.
+func resumeWatch(con *XdsConnection, discReq *xdsapi.DiscoveryRequest) {
+	xdsResumed.With(prometheus.Labels{"type": xdsShortType(discReq.TypeUrl)}).Add(1)
+	adsLog.Infof("ADS: resuming %s watch for %s at version %s, initial push skipped",
+		xdsShortType(discReq.TypeUrl), con.ConID, discReq.VersionInfo)
+}
@@ -0,0 +1,54 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The periodic resync (V2_REFRESH) is a failsafe, not a config change. A
+// proxy on a constrained network that has not yet ACKed the previous full
+// push gains nothing from another one stacking up behind it - the resync
+// skips such connections and counts the skips. Config-change pushes are
+// never skipped.
+
+var periodicResyncSkips = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "pilot_periodic_resync_skips",
+	Help: "Periodic full pushes skipped because the proxy had not ACKed the previous push.",
+})
+
+func init() {
+	prometheus.MustRegister(periodicResyncSkips)
+}
+
+// ackedLastPush reports whether the proxy responded (ACK or NACK) to the
+// last response sent on every type it watches.
+func (conn *XdsConnection) ackedLastPush() bool {
+	conn.mu.RLock()
+	defer conn.mu.RUnlock()
+	if conn.CDSWatch && conn.ClusterNonceSent != "" && conn.ClusterNonceSent != conn.ClusterNonceAcked {
+		return false
+	}
+	if conn.LDSWatch && conn.ListenerNonceSent != "" && conn.ListenerNonceSent != conn.ListenerNonceAcked {
+		return false
+	}
+	if len(conn.Routes) > 0 && conn.RouteNonceSent != "" && conn.RouteNonceSent != conn.RouteNonceAcked {
+		return false
+	}
+	if len(conn.Clusters) > 0 && conn.EndpointNonceSent != "" && conn.EndpointNonceSent != conn.EndpointNonceAcked {
+		return false
+	}
+	return true
+}
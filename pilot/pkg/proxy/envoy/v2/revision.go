@@ -0,0 +1,64 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+// Control-plane canarying: proxies can be pinned to a control-plane revision
+// through node metadata, and a Pilot carrying a different revision politely
+// redirects them (closes the stream with a hint) instead of serving them, so
+// a canary Pilot build doesn't mix proxy populations with the stable one.
+
+// revisionMetadataKey is the node metadata key carrying the control-plane
+// revision the proxy was injected for.
+const revisionMetadataKey = "CONTROL_PLANE_REVISION"
+
+var revisionRedirected = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "pilot_xds_revision_redirected",
+	Help: "Connections redirected because the proxy is pinned to a different control-plane revision.",
+})
+
+func init() {
+	prometheus.MustRegister(revisionRedirected)
+}
+
+// revisionOf returns the control-plane revision a proxy is pinned to, or ""
+// when the proxy accepts any revision.
+func revisionOf(node *model.Proxy) string {
+	if node == nil {
+		return ""
+	}
+	return node.Metadata[revisionMetadataKey]
+}
+
+// checkRevision verifies a pinned proxy is talking to the matching control
+// plane revision. Unpinned proxies and unversioned Pilots accept everything.
+func (s *DiscoveryServer) checkRevision(node *model.Proxy) error {
+	if s.Revision == "" {
+		return nil
+	}
+	r := revisionOf(node)
+	if r == "" || r == s.Revision {
+		return nil
+	}
+	revisionRedirected.Add(1)
+	return fmt.Errorf("proxy is pinned to control-plane revision %q, this instance serves %q - reconnect to the matching revision", r, s.Revision)
+}
@@ -0,0 +1,97 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// revisionLabel is the label identifying the ReplicaSet/revision that owns an
+// endpoint. Kubernetes stamps it on every pod created by a Deployment, so the
+// endpoint labels carried in the shards are enough to correlate a rollout.
+const revisionLabel = "pod-template-hash"
+
+// RolloutRevision is the share of a service's endpoints owned by one revision.
+type RolloutRevision struct {
+	Endpoints int     `json:"endpoints"`
+	Percent   float64 `json:"percent"`
+}
+
+// RolloutStatus reports, per service, how the endpoints are distributed over
+// deployment revisions - e.g. "80% of endpoints now on revision X".
+type RolloutStatus struct {
+	Service   string                     `json:"service"`
+	Endpoints int                        `json:"endpoints"`
+	Revisions map[string]RolloutRevision `json:"revisions"`
+
+	// ByShard breaks the revision counts down by shard (registry/cluster).
+	ByShard map[string]map[string]int `json:"by_shard,omitempty"`
+}
+
+// rolloutz reports rollout progress per service, computed purely from the EDS
+// shard data. An optional 'svc' parameter restricts the output to one service.
+// It is mapped to /debug/rolloutz.
+func (s *DiscoveryServer) rolloutz(w http.ResponseWriter, req *http.Request) {
+	_ = req.ParseForm()
+	w.Header().Add("Content-Type", "application/json")
+	svcName := req.Form.Get("svc")
+
+	out := []RolloutStatus{}
+	s.mutex.RLock()
+	for svc, ep := range s.EndpointShardsByService {
+		if svcName != "" && svcName != svc {
+			continue
+		}
+		status := RolloutStatus{
+			Service:   svc,
+			Revisions: map[string]RolloutRevision{},
+			ByShard:   map[string]map[string]int{},
+		}
+		ep.mutex.RLock()
+		for shard, es := range ep.Shards {
+			for _, e := range es.Entries {
+				rev := e.Labels[revisionLabel]
+				if rev == "" {
+					rev = "<none>"
+				}
+				status.Endpoints++
+				r := status.Revisions[rev]
+				r.Endpoints++
+				status.Revisions[rev] = r
+				if status.ByShard[shard] == nil {
+					status.ByShard[shard] = map[string]int{}
+				}
+				status.ByShard[shard][rev]++
+			}
+		}
+		ep.mutex.RUnlock()
+		for rev, r := range status.Revisions {
+			r.Percent = float64(r.Endpoints) * 100 / float64(status.Endpoints)
+			status.Revisions[rev] = r
+		}
+		out = append(out, status)
+	}
+	s.mutex.RUnlock()
+
+	b, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "unable to marshal rollout status: %v", err)
+		return
+	}
+	_, _ = w.Write(b)
+}
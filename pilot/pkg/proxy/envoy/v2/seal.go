@@ -0,0 +1,165 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"istio.io/istio/pkg/features/pilot"
+)
+
+// Persisted discovery state - the push ledger, shard snapshots written by
+// store backends - is an endpoint dump, and an endpoint dump is the mesh's
+// internal topology. When PILOT_SNAPSHOT_KEY is set, SealSnapshot wraps such
+// blobs in AES-GCM before they reach disk and OpenSnapshot unwraps them on
+// load. The key comes from a pluggable source (file, environment variable;
+// external sources register a scheme), so deployments can wire in their
+// secret management. Encryption fails closed: a configured but unusable key
+// disables persistence rather than writing plaintext.
+
+// sealedMagic prefixes encrypted blobs, so plaintext files written before
+// the key was configured are still readable.
+var sealedMagic = []byte("ISNAP1")
+
+// SnapshotKeySource returns the 32-byte encryption key for the ref part of
+// PILOT_SNAPSHOT_KEY (the text after "scheme://").
+type SnapshotKeySource func(ref string) ([]byte, error)
+
+var snapshotKeySources = map[string]SnapshotKeySource{
+	"file": fileKeySource,
+	"env":  envKeySource,
+}
+
+var (
+	// snapshotAEAD is non-nil when encryption is configured and usable.
+	snapshotAEAD cipher.AEAD
+
+	// snapshotKeyBroken is set when a key was configured but could not be
+	// loaded - sealing must fail rather than fall back to plaintext.
+	snapshotKeyBroken bool
+)
+
+func init() {
+	if err := loadSnapshotKey(); err != nil {
+		snapshotKeyBroken = true
+		adsLog.Errorf("Snapshot encryption disabled, persistence will fail closed: %v", err)
+	}
+}
+
+// RegisterSnapshotKeySource registers a key source under a scheme, e.g.
+// "vault". Called from init() of the source's package.
+func RegisterSnapshotKeySource(scheme string, source SnapshotKeySource) {
+	snapshotKeySources[scheme] = source
+}
+
+func loadSnapshotKey() error {
+	if pilot.SnapshotKey == "" {
+		return nil
+	}
+	parts := strings.SplitN(pilot.SnapshotKey, "://", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("PILOT_SNAPSHOT_KEY must be scheme://ref, got %q", pilot.SnapshotKey)
+	}
+	source, f := snapshotKeySources[parts[0]]
+	if !f {
+		return fmt.Errorf("unknown snapshot key source %q", parts[0])
+	}
+	key, err := source(parts[1])
+	if err != nil {
+		return err
+	}
+	return installSnapshotKey(key)
+}
+
+// installSnapshotKey builds the AEAD from a raw or base64-encoded 32-byte
+// key.
+func installSnapshotKey(key []byte) error {
+	if len(key) != 32 {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(key)))
+		if err != nil || len(decoded) != 32 {
+			return fmt.Errorf("snapshot key must be 32 bytes, raw or base64, got %d bytes", len(key))
+		}
+		key = decoded
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	snapshotAEAD = aead
+	adsLog.Infof("Snapshot encryption enabled")
+	return nil
+}
+
+func fileKeySource(ref string) ([]byte, error) {
+	return ioutil.ReadFile(ref)
+}
+
+func envKeySource(ref string) ([]byte, error) {
+	v := os.Getenv(ref)
+	if v == "" {
+		return nil, fmt.Errorf("snapshot key variable %s is empty", ref)
+	}
+	return []byte(v), nil
+}
+
+// SealSnapshot encrypts a blob for persistence. Without a configured key the
+// blob passes through unchanged; with a broken key it fails, so callers skip
+// the write instead of persisting plaintext.
+func SealSnapshot(plaintext []byte) ([]byte, error) {
+	if snapshotKeyBroken {
+		return nil, fmt.Errorf("snapshot key configured but unusable")
+	}
+	if snapshotAEAD == nil {
+		return plaintext, nil
+	}
+	nonce := make([]byte, snapshotAEAD.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(sealedMagic)+len(nonce)+len(plaintext)+snapshotAEAD.Overhead())
+	out = append(out, sealedMagic...)
+	out = append(out, nonce...)
+	return snapshotAEAD.Seal(out, nonce, plaintext, nil), nil
+}
+
+// OpenSnapshot decrypts a blob read from persistence. Plaintext blobs - from
+// before the key was configured - pass through; encrypted blobs without a
+// usable key are an error.
+func OpenSnapshot(blob []byte) ([]byte, error) {
+	if !bytes.HasPrefix(blob, sealedMagic) {
+		return blob, nil
+	}
+	if snapshotAEAD == nil {
+		return nil, fmt.Errorf("snapshot is encrypted but no usable PILOT_SNAPSHOT_KEY is configured")
+	}
+	rest := blob[len(sealedMagic):]
+	if len(rest) < snapshotAEAD.NonceSize() {
+		return nil, fmt.Errorf("encrypted snapshot truncated")
+	}
+	nonce := rest[:snapshotAEAD.NonceSize()]
+	return snapshotAEAD.Open(nil, nonce, rest[snapshotAEAD.NonceSize():], nil)
+}
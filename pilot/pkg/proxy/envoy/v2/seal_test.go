@@ -0,0 +1,83 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSealSnapshotRoundTrip(t *testing.T) {
+	defer func() { snapshotAEAD = nil }()
+	if err := installSnapshotKey(bytes.Repeat([]byte("k"), 32)); err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := []byte(`{"generation":"v1","expected":{"a.ns":true}}`)
+	sealed, err := SealSnapshot(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, []byte("generation")) {
+		t.Errorf("sealed blob leaks plaintext")
+	}
+	if !bytes.HasPrefix(sealed, sealedMagic) {
+		t.Errorf("sealed blob missing magic prefix")
+	}
+
+	opened, err := OpenSnapshot(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Errorf("round trip mismatch: %q", opened)
+	}
+
+	// Tampered ciphertext must not open.
+	sealed[len(sealed)-1] ^= 0xff
+	if _, err := OpenSnapshot(sealed); err == nil {
+		t.Errorf("tampered snapshot opened without error")
+	}
+
+	// Plaintext blobs from before the key was configured pass through.
+	if out, err := OpenSnapshot(plaintext); err != nil || !bytes.Equal(out, plaintext) {
+		t.Errorf("plaintext passthrough failed: %v", err)
+	}
+}
+
+func TestSealSnapshotWithoutKey(t *testing.T) {
+	if snapshotAEAD != nil {
+		t.Skip("key configured in environment")
+	}
+	plaintext := []byte("state")
+	sealed, err := SealSnapshot(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sealed, plaintext) {
+		t.Errorf("sealing without a key must pass through")
+	}
+}
+
+func TestInstallSnapshotKeyValidation(t *testing.T) {
+	defer func() { snapshotAEAD = nil }()
+	if err := installSnapshotKey([]byte("short")); err == nil {
+		t.Errorf("short key accepted")
+	}
+	// Base64 of 32 bytes is accepted.
+	if err := installSnapshotKey([]byte("a2tra2tra2tra2tra2tra2tra2tra2tra2tra2tra2s=")); err != nil {
+		t.Errorf("base64 key rejected: %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+// Registries replace whole shards, so "endpoints changed for service X" is
+// all an operator can see today. Computing the delta against the previous
+// shard contents makes each update traceable: which addresses appeared,
+// disappeared or changed shape, and when.
+
+// shardDeltaSamples bounds how many addresses are named in the log line.
+const shardDeltaSamples = 3
+
+var shardEndpointChanges = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "pilot_eds_shard_endpoint_changes",
+	Help: "Endpoints added, removed or modified by shard updates.",
+}, []string{"change"})
+
+func init() {
+	prometheus.MustRegister(shardEndpointChanges)
+}
+
+// shardDelta compares the previous and new contents of a shard and returns
+// the addresses added, removed and modified. Endpoints are keyed by UID when
+// the registry provides one, by address and port otherwise; an endpoint
+// present on both sides but with different labels, service account, network
+// or port counts as modified.
+func shardDelta(prev, next []*model.IstioEndpoint) (added, removed, modified []string) {
+	prevByKey := make(map[string]*model.IstioEndpoint, len(prev))
+	for _, e := range prev {
+		prevByKey[shardEndpointKey(e)] = e
+	}
+	for _, e := range next {
+		key := shardEndpointKey(e)
+		old, f := prevByKey[key]
+		if !f {
+			added = append(added, e.Address)
+			continue
+		}
+		delete(prevByKey, key)
+		if old.Address != e.Address || old.EndpointPort != e.EndpointPort ||
+			old.ServicePortName != e.ServicePortName || old.ServiceAccount != e.ServiceAccount ||
+			old.Network != e.Network || !reflect.DeepEqual(old.Labels, e.Labels) {
+			modified = append(modified, e.Address)
+		}
+	}
+	for _, e := range prevByKey {
+		removed = append(removed, e.Address)
+	}
+	return
+}
+
+func shardEndpointKey(e *model.IstioEndpoint) string {
+	if e.UID != "" {
+		return e.UID
+	}
+	return fmt.Sprintf("%s:%d", e.Address, e.EndpointPort)
+}
+
+// logShardDelta records what a shard replacement actually changed. The
+// summary is logged at debug level with sample addresses; counters are
+// always updated.
+func logShardDelta(serviceName, shard string, prev, next []*model.IstioEndpoint) {
+	added, removed, modified := shardDelta(prev, next)
+	if len(added) == 0 && len(removed) == 0 && len(modified) == 0 {
+		return
+	}
+	shardEndpointChanges.With(prometheus.Labels{"change": "added"}).Add(float64(len(added)))
+	shardEndpointChanges.With(prometheus.Labels{"change": "removed"}).Add(float64(len(removed)))
+	shardEndpointChanges.With(prometheus.Labels{"change": "modified"}).Add(float64(len(modified)))
+	recordServiceChurn(serviceName, len(added), len(removed), len(modified))
+	if adsLog.DebugEnabled() {
+		adsLog.Debugf("EDS: shard %s/%s delta: %d added %s, %d removed %s, %d modified %s",
+			serviceName, shard,
+			len(added), sampleAddresses(added),
+			len(removed), sampleAddresses(removed),
+			len(modified), sampleAddresses(modified))
+	}
+}
+
+// sampleAddresses renders up to shardDeltaSamples addresses for a log line.
+func sampleAddresses(addresses []string) string {
+	if len(addresses) == 0 {
+		return "[]"
+	}
+	if len(addresses) > shardDeltaSamples {
+		return "[" + strings.Join(addresses[:shardDeltaSamples], " ") + " ...]"
+	}
+	return "[" + strings.Join(addresses, " ") + "]"
+}
@@ -0,0 +1,55 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"testing"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+func TestShardDelta(t *testing.T) {
+	ep := func(addr string, port uint32, labels map[string]string) *model.IstioEndpoint {
+		return &model.IstioEndpoint{Address: addr, EndpointPort: port, Labels: labels}
+	}
+
+	prev := []*model.IstioEndpoint{
+		ep("10.1.1.1", 80, nil),
+		ep("10.1.1.2", 80, map[string]string{"version": "v1"}),
+		ep("10.1.1.3", 80, nil),
+	}
+	next := []*model.IstioEndpoint{
+		ep("10.1.1.1", 80, nil),                               // unchanged
+		ep("10.1.1.2", 80, map[string]string{"version": "v2"}), // modified
+		ep("10.1.1.4", 80, nil),                               // added
+	}
+
+	added, removed, modified := shardDelta(prev, next)
+	if len(added) != 1 || added[0] != "10.1.1.4" {
+		t.Errorf("added: got %v, want [10.1.1.4]", added)
+	}
+	if len(removed) != 1 || removed[0] != "10.1.1.3" {
+		t.Errorf("removed: got %v, want [10.1.1.3]", removed)
+	}
+	if len(modified) != 1 || modified[0] != "10.1.1.2" {
+		t.Errorf("modified: got %v, want [10.1.1.2]", modified)
+	}
+
+	// No change at all.
+	added, removed, modified = shardDelta(prev, prev)
+	if len(added)+len(removed)+len(modified) != 0 {
+		t.Errorf("identical shards: got %v %v %v, want empty", added, removed, modified)
+	}
+}
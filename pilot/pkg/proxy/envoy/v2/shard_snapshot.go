@@ -0,0 +1,54 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Push computation works on an immutable snapshot of a service's shards
+// instead of holding the per-service lock for the whole assignment build.
+// Shards are replaced wholesale by edsUpdate (copy-on-write: an *EndpointShard
+// and its Entries are never mutated after publication), so copying the map
+// under the read lock yields a consistent view and the build itself never
+// contends with registry writes.
+
+var edsStaleSnapshots = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "pilot_eds_stale_snapshots",
+	Help: "Assignments computed from a shard snapshot that was replaced during the computation.",
+})
+
+func init() {
+	prometheus.MustRegister(edsStaleSnapshots)
+}
+
+// snapshot returns a consistent copy of the shard map and the epoch it was
+// taken at.
+func (ep *EndpointShardsByService) snapshot() (map[string]*EndpointShard, uint64) {
+	ep.mutex.RLock()
+	defer ep.mutex.RUnlock()
+	out := make(map[string]*EndpointShard, len(ep.Shards))
+	for k, v := range ep.Shards {
+		out[k] = v
+	}
+	return out, ep.epoch
+}
+
+// epochNow returns the current mutation epoch of the service's shards.
+func (ep *EndpointShardsByService) epochNow() uint64 {
+	ep.mutex.RLock()
+	defer ep.mutex.RUnlock()
+	return ep.epoch
+}
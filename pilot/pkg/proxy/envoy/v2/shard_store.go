@@ -0,0 +1,148 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/features/pilot"
+)
+
+// In HA deployments each Pilot replica rebuilds EndpointShardsByService from
+// its own registry watches, and replicas can disagree during registry
+// failover. A ShardStore is an optional external backend (etcd, redis, ...)
+// that shard updates are written through to and that is replayed at startup,
+// so all replicas serve from one authoritative endpoint store and a fresh
+// replica is warm before its watches catch up.
+//
+// Backends live out of tree and register a factory by scheme. The in-memory
+// map stays authoritative for serving; the store is strictly write-through,
+// so a broken backend degrades to today's behavior instead of breaking EDS.
+// Backends persisting to disk should wrap their serialized payloads with
+// SealSnapshot/OpenSnapshot, so PILOT_SNAPSHOT_KEY covers them too.
+
+// ShardStore persists endpoint shards outside the Pilot process.
+type ShardStore interface {
+	// Name returns the backend name, for logging and /debug output.
+	Name() string
+
+	// WriteShard replaces the stored entries for one shard of a service.
+	WriteShard(serviceName, shard string, entries []*model.IstioEndpoint) error
+
+	// DeleteShard removes one shard of a service from the store.
+	DeleteShard(serviceName, shard string) error
+
+	// LoadAll returns every stored shard, keyed by service name then shard.
+	// It is called once at startup to warm the in-memory state.
+	LoadAll() (map[string]map[string][]*model.IstioEndpoint, error)
+}
+
+// ShardStoreFactory creates a ShardStore for the address part of
+// PILOT_SHARD_STORE (the text after "scheme://").
+type ShardStoreFactory func(address string) (ShardStore, error)
+
+var shardStoreFactories = map[string]ShardStoreFactory{}
+
+var shardStoreErrors = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "pilot_shard_store_errors",
+	Help: "Failed writes to the external shard store.",
+})
+
+func init() {
+	prometheus.MustRegister(shardStoreErrors)
+}
+
+// RegisterShardStore registers a persistence backend under a scheme, e.g.
+// "etcd". Called from init() of the backend's package.
+func RegisterShardStore(scheme string, factory ShardStoreFactory) {
+	shardStoreFactories[scheme] = factory
+}
+
+// openShardStore opens the backend selected by PILOT_SHARD_STORE, or returns
+// nil if none is configured.
+func openShardStore() (ShardStore, error) {
+	if pilot.ShardStore == "" {
+		return nil, nil
+	}
+	parts := strings.SplitN(pilot.ShardStore, "://", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("PILOT_SHARD_STORE must be scheme://address, got %q", pilot.ShardStore)
+	}
+	factory, f := shardStoreFactories[parts[0]]
+	if !f {
+		return nil, fmt.Errorf("unknown shard store backend %q", parts[0])
+	}
+	return factory(parts[1])
+}
+
+// writeShardStore mirrors a shard update to the external store, if one is
+// configured. Errors are counted and logged but never block the update.
+func (s *DiscoveryServer) writeShardStore(serviceName, shard string, entries []*model.IstioEndpoint) {
+	if s.shardStore == nil {
+		return
+	}
+	if err := s.shardStore.WriteShard(serviceName, shard, entries); err != nil {
+		shardStoreErrors.Add(1)
+		adsLog.Warnf("EDS: shard store %s write %s/%s: %v", s.shardStore.Name(), serviceName, shard, err)
+	}
+}
+
+// deleteShardStore mirrors a shard removal to the external store.
+func (s *DiscoveryServer) deleteShardStore(serviceName, shard string) {
+	if s.shardStore == nil {
+		return
+	}
+	if err := s.shardStore.DeleteShard(serviceName, shard); err != nil {
+		shardStoreErrors.Add(1)
+		adsLog.Warnf("EDS: shard store %s delete %s/%s: %v", s.shardStore.Name(), serviceName, shard, err)
+	}
+}
+
+// restoreShards replays the external store into EndpointShardsByService, so a
+// fresh replica serves endpoints before its registry watches catch up. Shards
+// already populated by a registry are left alone.
+func (s *DiscoveryServer) restoreShards() {
+	stored, err := s.shardStore.LoadAll()
+	if err != nil {
+		adsLog.Warnf("EDS: shard store %s load: %v", s.shardStore.Name(), err)
+		return
+	}
+	restored := 0
+	for serviceName, shards := range stored {
+		for shard, entries := range shards {
+			s.mutex.Lock()
+			ep, f := s.EndpointShardsByService[serviceName]
+			if f {
+				ep.mutex.RLock()
+				_, f := ep.Shards[shard]
+				ep.mutex.RUnlock()
+				if f {
+					s.mutex.Unlock()
+					continue
+				}
+			}
+			s.mutex.Unlock()
+			s.edsUpdate(shard, serviceName, entries, true)
+			restored++
+		}
+	}
+	if restored > 0 {
+		adsLog.Infof("EDS: restored %d shards from shard store %s", restored, s.shardStore.Name())
+	}
+}
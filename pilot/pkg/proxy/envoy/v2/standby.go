@@ -0,0 +1,108 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"istio.io/istio/pkg/features/pilot"
+)
+
+// A replica started with PILOT_STANDBY=1 keeps doing everything that warms
+// it up - registry watches, shard updates, shard store replay, imports -
+// but refuses proxy streams and reports NOT_SERVING, so the load balancer
+// keeps proxies on the active replicas. Promotion (POST /debug/standby) is
+// instant: the replica is already warm, it only starts accepting streams.
+// Demotion does not cut existing streams; it stops new ones and lets the
+// health status drain the rest.
+
+var (
+	// standbyFlag is 1 while the replica refuses proxy streams.
+	standbyFlag int32
+
+	standbyGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "pilot_standby",
+		Help: "Whether this replica is in standby mode (1) or active (0).",
+	})
+
+	standbyRejects = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "pilot_standby_rejected_streams",
+		Help: "Proxy streams refused while in standby mode.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(standbyGauge)
+	prometheus.MustRegister(standbyRejects)
+	if pilot.Standby {
+		atomic.StoreInt32(&standbyFlag, 1)
+		standbyGauge.Set(1)
+	}
+}
+
+// inStandby reports whether proxy streams are currently refused.
+func inStandby() bool {
+	return atomic.LoadInt32(&standbyFlag) == 1
+}
+
+// setStandby flips the mode at runtime.
+func setStandby(standby bool) {
+	v := int32(0)
+	if standby {
+		v = 1
+	}
+	if atomic.SwapInt32(&standbyFlag, v) == v {
+		return
+	}
+	standbyGauge.Set(float64(v))
+	if standby {
+		adsLog.Infof("Standby: replica demoted, refusing new proxy streams")
+	} else {
+		adsLog.Infof("Standby: replica promoted, accepting proxy streams")
+	}
+}
+
+// standbyz reports (GET) and switches (POST) the standby mode. Promotion is
+// the failover path during incidents, so it shares the injection token and
+// is mapped to /debug/standby on the monitor port (9093).
+func (s *DiscoveryServer) standbyz(w http.ResponseWriter, req *http.Request) {
+	if !injectAuthorized(w, req) {
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+
+	switch req.Method {
+	case http.MethodGet:
+		fmt.Fprintf(w, "{\"standby\": %v}\n", inStandby())
+	case http.MethodPost:
+		var body struct {
+			Standby bool `json:"standby"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "{\"error\": %q}\n", err.Error())
+			return
+		}
+		setStandby(body.Standby)
+		fmt.Fprintf(w, "{\"standby\": %v}\n", inStandby())
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Some proxies (0.7 and some custom clients) open a separate EDS stream per
+// cluster instead of using a single aggregated (ADS) stream. This produces a
+// connection explosion on large meshes. The code here detects and reports the
+// stream topology for each proxy, and optionally rejects the per-cluster style.
+
+var (
+	edsOnlyStreams = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "pilot_xds_eds_only_streams",
+		Help: "Number of streams watching endpoints without a cluster watch (non-ADS usage).",
+	})
+
+	edsOnlyStreamsRejected = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "pilot_xds_eds_only_streams_rejected",
+		Help: "Number of non-ADS EDS streams rejected by PILOT_REJECT_NON_ADS_EDS.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(edsOnlyStreams)
+	prometheus.MustRegister(edsOnlyStreamsRejected)
+}
+
+// StreamTopology describes how a single proxy is connected to this pilot:
+// one aggregated stream or multiple per-type streams.
+type StreamTopology struct {
+	ProxyID string `json:"proxy"`
+
+	// Connections is the total number of streams opened by the proxy.
+	Connections int `json:"connections"`
+
+	// AdsStreams counts streams that watch clusters or listeners - the
+	// expected topology is a single such stream per proxy.
+	AdsStreams int `json:"ads_streams"`
+
+	// EdsOnlyStreams counts streams that only watch endpoints. Envoys
+	// configured without ADS open one of these per cluster.
+	EdsOnlyStreams int `json:"eds_only_streams"`
+
+	// WatchedClusters is the total number of clusters watched over all streams.
+	WatchedClusters int `json:"watched_clusters"`
+
+	// BytesSent is the response bytes pushed to the proxy over all streams,
+	// by xDS type.
+	BytesSent map[string]uint64 `json:"bytes_sent,omitempty"`
+}
+
+// updateEdsOnlyStreams recomputes the eds-only stream gauge. Caller must not
+// hold adsClientsMutex.
+func updateEdsOnlyStreams() {
+	n := 0
+	adsClientsMutex.RLock()
+	for _, con := range adsClients {
+		con.mu.RLock()
+		if con.EdsOnly {
+			n++
+		}
+		con.mu.RUnlock()
+	}
+	adsClientsMutex.RUnlock()
+	edsOnlyStreams.Set(float64(n))
+}
+
+// streamTopologies builds the per-proxy stream topology from the connection table.
+func streamTopologies() []StreamTopology {
+	out := []StreamTopology{}
+	adsClientsMutex.RLock()
+	defer adsClientsMutex.RUnlock()
+	for proxyID, connections := range adsSidecarIDConnectionsMap {
+		st := StreamTopology{ProxyID: proxyID}
+		for _, con := range connections {
+			con.mu.RLock()
+			st.Connections++
+			if con.CDSWatch || con.LDSWatch {
+				st.AdsStreams++
+			} else if len(con.Clusters) > 0 {
+				st.EdsOnlyStreams++
+			}
+			st.WatchedClusters += len(con.Clusters)
+			for typ, b := range con.BytesSent {
+				if st.BytesSent == nil {
+					st.BytesSent = map[string]uint64{}
+				}
+				st.BytesSent[typ] += b
+			}
+			con.mu.RUnlock()
+		}
+		out = append(out, st)
+	}
+	return out
+}
+
+// streamsz lists the stream topology of each connected proxy, to diagnose
+// proxies using N per-cluster EDS streams instead of a single ADS stream.
+// It is mapped to /debug/streamz.
+func (s *DiscoveryServer) streamsz(w http.ResponseWriter, req *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	out, err := json.MarshalIndent(streamTopologies(), "", "  ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "unable to marshal stream topology: %v", err)
+		return
+	}
+	_, _ = w.Write(out)
+}
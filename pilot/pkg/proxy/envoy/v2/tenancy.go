@@ -0,0 +1,92 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+// Multi-tenancy: a hosted control plane runs one DiscoveryServer per tenant
+// inside a single process, each with its own environment, shard map and push
+// context. The tenant of a proxy is declared in its node metadata; a server
+// configured with a tenant refuses proxies of other tenants, so pushes and
+// debug state never mix.
+
+// tenantMetadataKey is the node metadata key carrying the mesh/tenant identifier.
+const tenantMetadataKey = "TENANT"
+
+var tenantRejected = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "pilot_xds_tenant_rejected",
+	Help: "Connections rejected because the proxy belongs to a different tenant.",
+})
+
+func init() {
+	prometheus.MustRegister(tenantRejected)
+}
+
+// tenantOf returns the tenant a proxy declared in its metadata, or "" for
+// single-tenant deployments.
+func tenantOf(node *model.Proxy) string {
+	if node == nil {
+		return ""
+	}
+	return node.Metadata[tenantMetadataKey]
+}
+
+// checkTenant verifies a proxy belongs to the tenant this server is serving.
+// Servers without a configured tenant accept everything (single-tenant mode).
+func (s *DiscoveryServer) checkTenant(node *model.Proxy) error {
+	if s.Tenant == "" {
+		return nil
+	}
+	if t := tenantOf(node); t != s.Tenant {
+		tenantRejected.Add(1)
+		return fmt.Errorf("proxy tenant %q is not served by this instance", t)
+	}
+	return nil
+}
+
+// tenantz summarizes connections per tenant. It is mapped to /debug/tenantz.
+func (s *DiscoveryServer) tenantz(w http.ResponseWriter, req *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	counts := map[string]int{}
+	adsClientsMutex.RLock()
+	for _, con := range adsClients {
+		con.mu.RLock()
+		tenant := tenantOf(con.modelNode)
+		con.mu.RUnlock()
+		if tenant == "" {
+			tenant = "<default>"
+		}
+		counts[tenant]++
+	}
+	adsClientsMutex.RUnlock()
+	out, err := json.MarshalIndent(map[string]interface{}{
+		"serving":     s.Tenant,
+		"connections": counts,
+	}, "", "  ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "unable to marshal tenant info: %v", err)
+		return
+	}
+	_, _ = w.Write(out)
+}
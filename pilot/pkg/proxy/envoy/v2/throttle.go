@@ -0,0 +1,117 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"golang.org/x/time/rate"
+)
+
+// The push throttle is set from PILOT_PUSH_THROTTLE/PILOT_PUSH_BURST at
+// startup. During a push-backpressure incident operators need to see the
+// effective limits and relieve them without a redeploy - throttlez exposes
+// the settings and allows a bounded, audited live adjustment. The new
+// connection limiter is kept at twice the regular one, as at startup.
+
+// Bounds for live adjustment: refuse obviously dangerous values rather than
+// trust an operator typing under stress.
+const (
+	throttleMin      = 1
+	throttleMax      = 1000
+	throttleBurstMax = 10000
+)
+
+// ThrottleStatus is the current push throttle configuration.
+type ThrottleStatus struct {
+	PushThrottle int `json:"pushThrottle"`
+	PushBurst    int `json:"pushBurst"`
+}
+
+// ThrottleRequest adjusts the push throttle at runtime.
+type ThrottleRequest struct {
+	PushThrottle int `json:"pushThrottle"`
+	PushBurst    int `json:"pushBurst"`
+}
+
+// throttlez exposes the push throttle. GET returns the current settings,
+// POST adjusts them within bounds. It shares the injection token and is
+// mapped to /debug/throttlez on the monitor port (9093).
+func (s *DiscoveryServer) throttlez(w http.ResponseWriter, req *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+
+	switch req.Method {
+	case http.MethodGet:
+		s.throttleMutex.RLock()
+		st := ThrottleStatus{PushThrottle: s.pushThrottle, PushBurst: s.pushBurst}
+		s.throttleMutex.RUnlock()
+		b, _ := json.MarshalIndent(st, " ", " ")
+		_, _ = w.Write(b)
+	case http.MethodPost:
+		if !injectAuthorized(w, req) {
+			return
+		}
+		var tr ThrottleRequest
+		if err := json.NewDecoder(req.Body).Decode(&tr); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "{\"error\": %q}\n", err.Error())
+			return
+		}
+		if tr.PushThrottle < throttleMin || tr.PushThrottle > throttleMax ||
+			tr.PushBurst < throttleMin || tr.PushBurst > throttleBurstMax {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "{\"error\": \"throttle must be in [%d,%d] and burst in [%d,%d]\"}\n",
+				throttleMin, throttleMax, throttleMin, throttleBurstMax)
+			return
+		}
+		s.setPushThrottle(tr.PushThrottle, tr.PushBurst, req.RemoteAddr)
+		fmt.Fprintf(w, "{\"pushThrottle\": %d, \"pushBurst\": %d}\n", tr.PushThrottle, tr.PushBurst)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// setPushThrottle applies new limits with an audit log of who changed what.
+// rate.Limiter has no way to change its burst, so the limiters are replaced;
+// in-flight Wait calls finish against the old limiter, new pushes see the new
+// limits.
+func (s *DiscoveryServer) setPushThrottle(throttle, burst int, who string) {
+	s.throttleMutex.Lock()
+	old := ThrottleStatus{PushThrottle: s.pushThrottle, PushBurst: s.pushBurst}
+	s.pushThrottle = throttle
+	s.pushBurst = burst
+	s.rateLimiter = rate.NewLimiter(rate.Limit(throttle), burst)
+	s.initRateLimiter = rate.NewLimiter(rate.Limit(throttle*2), burst*2)
+	s.throttleMutex.Unlock()
+
+	adsLog.Infof("Audit: push throttle changed from %d/%d to %d/%d by %s",
+		old.PushThrottle, old.PushBurst, throttle, burst, who)
+}
+
+// limiter returns the live push rate limiter.
+func (s *DiscoveryServer) limiter() *rate.Limiter {
+	s.throttleMutex.RLock()
+	defer s.throttleMutex.RUnlock()
+	return s.rateLimiter
+}
+
+// initLimiter returns the live rate limiter for new connections.
+func (s *DiscoveryServer) initLimiter() *rate.Limiter {
+	s.throttleMutex.RLock()
+	defer s.throttleMutex.RUnlock()
+	return s.initRateLimiter
+}
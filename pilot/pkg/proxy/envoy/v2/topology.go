@@ -0,0 +1,151 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+// Topology dumps answer "what does the mesh look like right now" for
+// visualization tooling: services with their shards, endpoints and networks,
+// and which proxies watch which clusters. Everything is computed on demand
+// from DiscoveryServer state; ?limit= bounds the number of services and
+// ?format=dot renders Graphviz instead of JSON.
+
+// TopologyEndpoint is one endpoint in a topology snapshot.
+type TopologyEndpoint struct {
+	Address string `json:"address"`
+	Network string `json:"network,omitempty"`
+}
+
+// TopologyShard is one registry shard of a service.
+type TopologyShard struct {
+	Shard     string             `json:"shard"`
+	Endpoints []TopologyEndpoint `json:"endpoints"`
+}
+
+// TopologyService is a service with its shards and watching proxies.
+type TopologyService struct {
+	Service  string          `json:"service"`
+	Shards   []TopologyShard `json:"shards"`
+	Watchers []string        `json:"watchers,omitempty"`
+}
+
+// Topology is the full snapshot.
+type Topology struct {
+	Services  []TopologyService `json:"services"`
+	Proxies   int               `json:"proxies"`
+	Truncated bool              `json:"truncated,omitempty"`
+}
+
+// topologySnapshot assembles the current topology, bounded by limit services
+// (0 for all).
+func (s *DiscoveryServer) topologySnapshot(limit int) *Topology {
+	// Cluster watchers, grouped by service hostname.
+	watchers := map[string][]string{}
+	edsClusterMutex.RLock()
+	for clusterName, c := range edsClusters {
+		_, _, hostname, _, err := model.ParseSubsetKeyStrict(clusterName)
+		if err != nil {
+			continue
+		}
+		for conID := range c.EdsClients {
+			watchers[string(hostname)] = append(watchers[string(hostname)], conID)
+		}
+	}
+	edsClusterMutex.RUnlock()
+
+	top := &Topology{Proxies: adsClientCount()}
+
+	s.mutex.RLock()
+	services := make([]string, 0, len(s.EndpointShardsByService))
+	for svc := range s.EndpointShardsByService {
+		services = append(services, svc)
+	}
+	sort.Strings(services)
+	if limit > 0 && len(services) > limit {
+		services = services[:limit]
+		top.Truncated = true
+	}
+	for _, svc := range services {
+		ts := TopologyService{Service: svc, Watchers: watchers[svc]}
+		sort.Strings(ts.Watchers)
+		ep := s.EndpointShardsByService[svc]
+		ep.mutex.RLock()
+		shards := make([]string, 0, len(ep.Shards))
+		for shard := range ep.Shards {
+			shards = append(shards, shard)
+		}
+		sort.Strings(shards)
+		for _, shard := range shards {
+			tsh := TopologyShard{Shard: shard}
+			for _, e := range ep.Shards[shard].Entries {
+				tsh.Endpoints = append(tsh.Endpoints, TopologyEndpoint{Address: e.Address, Network: e.Network})
+			}
+			ts.Shards = append(ts.Shards, tsh)
+		}
+		ep.mutex.RUnlock()
+		top.Services = append(top.Services, ts)
+	}
+	s.mutex.RUnlock()
+	return top
+}
+
+// topologyz handles /debug/topologyz.
+func (s *DiscoveryServer) topologyz(w http.ResponseWriter, req *http.Request) {
+	_ = req.ParseForm()
+	top := s.topologySnapshot(debugLimit(req))
+	out, done := debugOutput(w, req)
+	defer done()
+	if req.Form.Get("format") == "dot" {
+		w.Header().Set("Content-Type", "text/vnd.graphviz")
+		writeTopologyDot(out, top)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	b, _ := json.MarshalIndent(top, " ", " ")
+	_, _ = out.Write(b)
+}
+
+// writeTopologyDot renders the snapshot as a Graphviz digraph: proxies point
+// at the services they watch, services point at their endpoints grouped per
+// shard, endpoints carry the network as a label.
+func writeTopologyDot(out io.Writer, top *Topology) {
+	fmt.Fprintln(out, "digraph topology {")
+	fmt.Fprintln(out, "  rankdir=LR;")
+	for _, svc := range top.Services {
+		fmt.Fprintf(out, "  %q [shape=box];\n", svc.Service)
+		for _, watcher := range svc.Watchers {
+			fmt.Fprintf(out, "  %q -> %q;\n", watcher, svc.Service)
+		}
+		for _, shard := range svc.Shards {
+			for _, e := range shard.Endpoints {
+				label := e.Address
+				if e.Network != "" {
+					label = e.Address + "\\n" + e.Network
+				}
+				fmt.Fprintf(out, "  %q [label=%q];\n", svc.Service+"/"+e.Address, label)
+				fmt.Fprintf(out, "  %q -> %q [label=%q];\n", svc.Service, svc.Service+"/"+e.Address, shard.Shard)
+			}
+		}
+	}
+	fmt.Fprintln(out, "}")
+}
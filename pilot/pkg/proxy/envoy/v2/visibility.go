@@ -0,0 +1,191 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	xdsapi "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/features/pilot"
+)
+
+// Every sidecar can discover every service in the mesh today, so internal
+// services leak into configs (and mixer reports) of unrelated namespaces.
+// The visibility policy restores exportTo semantics at push time: a service
+// may be private to its namespace ("."), exported to specific namespaces, or
+// mesh-wide ("*"). Enforcement happens in the CDS/EDS push path through the
+// push plugin chain, so generation stays shared across proxies.
+
+// VisibilityPolicy declares which namespaces may discover each service.
+// Loaded from the JSON file named by PILOT_VISIBILITY_POLICY.
+type VisibilityPolicy struct {
+	// Default applies to services without a matching entry: "*" (mesh-wide,
+	// the default) or ".".
+	Default string `json:"default,omitempty"`
+
+	// Services maps a hostname or wildcard pattern (e.g. "*.internal") to
+	// the namespaces allowed to see it: explicit names, "." for the
+	// service's own namespace, "*" for everyone.
+	Services map[string][]string `json:"services,omitempty"`
+}
+
+// visibilityPolicy is the active policy, nil when enforcement is disabled.
+var visibilityPolicy *VisibilityPolicy
+
+func init() {
+	if pilot.VisibilityPolicy == "" {
+		return
+	}
+	p, err := loadVisibilityPolicy(pilot.VisibilityPolicy)
+	if err != nil {
+		adsLog.Errorf("visibility policy disabled: %v", err)
+		return
+	}
+	visibilityPolicy = p
+}
+
+func loadVisibilityPolicy(path string) (*VisibilityPolicy, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %v", path, err)
+	}
+	p := &VisibilityPolicy{}
+	if err := json.Unmarshal(b, p); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	return p, nil
+}
+
+// scopesFor returns the allowed scopes of the policy entry governing a
+// hostname. Overlapping patterns are resolved deterministically - an exact
+// entry wins over any wildcard, a longer (more specific) wildcard wins over a
+// shorter one, and equal lengths break lexically - so a service's visibility
+// never depends on map iteration order.
+func (p *VisibilityPolicy) scopesFor(hostname model.Hostname) ([]string, bool) {
+	if allowed, f := p.Services[string(hostname)]; f {
+		return allowed, true
+	}
+	best := ""
+	var bestScopes []string
+	found := false
+	for pattern, allowed := range p.Services {
+		if !model.Hostname(pattern).Matches(hostname) {
+			continue
+		}
+		if !found || len(pattern) > len(best) || (len(pattern) == len(best) && pattern < best) {
+			best = pattern
+			bestScopes = allowed
+			found = true
+		}
+	}
+	return bestScopes, found
+}
+
+// visibleTo reports whether a service hostname may be discovered by a proxy
+// in the given namespace.
+func (p *VisibilityPolicy) visibleTo(hostname model.Hostname, namespace string) bool {
+	scopes, found := p.scopesFor(hostname)
+	if !found {
+		scopes = []string{p.Default}
+		if p.Default == "" {
+			scopes = []string{"*"}
+		}
+	}
+	for _, scope := range scopes {
+		switch scope {
+		case "*":
+			return true
+		case ".":
+			if serviceNamespace(hostname) == namespace {
+				return true
+			}
+		default:
+			if scope == namespace {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// serviceNamespace derives the namespace from a cluster-local hostname
+// ("name.namespace.svc..."). Hostnames with another shape (external
+// services) have no namespace and are only matched by "*" or explicit lists.
+func serviceNamespace(hostname model.Hostname) string {
+	parts := strings.Split(string(hostname), ".")
+	if len(parts) < 3 || parts[2] != "svc" {
+		return ""
+	}
+	return parts[1]
+}
+
+// proxyNamespace derives the namespace from the proxy ID ("name.namespace"),
+// the same convention the mixer plugin relies on.
+func proxyNamespace(node *model.Proxy) string {
+	if node == nil {
+		return ""
+	}
+	parts := strings.Split(node.ID, ".")
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+// visibilityPlugin enforces the policy on pushed clusters and assignments.
+// Gateways and routers are exempt: they route on behalf of the whole mesh.
+type visibilityPlugin struct {
+	s *DiscoveryServer
+}
+
+func (p *visibilityPlugin) Name() string {
+	return "visibility"
+}
+
+func (p *visibilityPlugin) denied(con *XdsConnection, clusterName string) bool {
+	if con.modelNode == nil || con.modelNode.Type != model.Sidecar {
+		return false
+	}
+	_, _, hostname, _, err := model.ParseSubsetKeyStrict(clusterName)
+	if err != nil {
+		// Not a service cluster (inbound, static) - never withheld.
+		return false
+	}
+	if visibilityPolicy.visibleTo(hostname, proxyNamespace(con.modelNode)) {
+		return false
+	}
+	p.s.Env.PushContext.Add(model.ProxyStatusVisibilityDenied, string(hostname), con.modelNode,
+		fmt.Sprintf("not exported to %s", proxyNamespace(con.modelNode)))
+	return true
+}
+
+func (p *visibilityPlugin) OnPushEds(con *XdsConnection, cla *xdsapi.ClusterLoadAssignment) (*xdsapi.ClusterLoadAssignment, error) {
+	if p.denied(con, cla.ClusterName) {
+		return nil, fmt.Errorf("service not visible to namespace %q", proxyNamespace(con.modelNode))
+	}
+	return cla, nil
+}
+
+func (p *visibilityPlugin) OnPushCds(con *XdsConnection, cluster *xdsapi.Cluster) (*xdsapi.Cluster, error) {
+	if p.denied(con, cluster.Name) {
+		return nil, fmt.Errorf("service not visible to namespace %q", proxyNamespace(con.modelNode))
+	}
+	return cluster, nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"testing"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+func TestVisibilityPolicy(t *testing.T) {
+	p := &VisibilityPolicy{
+		Services: map[string][]string{
+			"private.backend.svc.cluster.local": {"."},
+			"shared.backend.svc.cluster.local":  {".", "frontend"},
+			"*.external.example.com":            {"edge"},
+		},
+	}
+
+	cases := []struct {
+		hostname  string
+		namespace string
+		visible   bool
+	}{
+		// Private: own namespace only.
+		{"private.backend.svc.cluster.local", "backend", true},
+		{"private.backend.svc.cluster.local", "frontend", false},
+		// Exported to a specific namespace.
+		{"shared.backend.svc.cluster.local", "frontend", true},
+		{"shared.backend.svc.cluster.local", "other", false},
+		// Wildcard pattern, explicit namespace list.
+		{"api.external.example.com", "edge", true},
+		{"api.external.example.com", "backend", false},
+		// No entry: default is mesh-wide.
+		{"open.default.svc.cluster.local", "anywhere", true},
+	}
+	for _, c := range cases {
+		if got := p.visibleTo(model.Hostname(c.hostname), c.namespace); got != c.visible {
+			t.Errorf("visibleTo(%s, %s) = %v, want %v", c.hostname, c.namespace, got, c.visible)
+		}
+	}
+
+	// Overlapping patterns resolve deterministically: exact beats wildcard,
+	// and the most specific wildcard beats a broader one.
+	overlap := &VisibilityPolicy{
+		Services: map[string][]string{
+			"api.external.example.com":   {"edge"},
+			"*.external.example.com":     {"backend"},
+			"*.example.com":              {"frontend"},
+			"www.external.example.com":   {},
+			"*.sub.external.example.com": {"sub"},
+		},
+	}
+	overlapCases := []struct {
+		hostname  string
+		namespace string
+		visible   bool
+	}{
+		// Exact entry wins over both wildcards.
+		{"api.external.example.com", "edge", true},
+		{"api.external.example.com", "backend", false},
+		// An exact entry with an empty scope list hides the service, even
+		// though wildcards covering it would allow it.
+		{"www.external.example.com", "backend", false},
+		{"www.external.example.com", "frontend", false},
+		// Longest matching wildcard wins.
+		{"db.external.example.com", "backend", true},
+		{"db.external.example.com", "frontend", false},
+		{"a.sub.external.example.com", "sub", true},
+		{"a.sub.external.example.com", "backend", false},
+		// Only the broad wildcard matches.
+		{"web.example.com", "frontend", true},
+		{"web.example.com", "backend", false},
+	}
+	for _, c := range overlapCases {
+		if got := overlap.visibleTo(model.Hostname(c.hostname), c.namespace); got != c.visible {
+			t.Errorf("visibleTo(%s, %s) = %v, want %v", c.hostname, c.namespace, got, c.visible)
+		}
+	}
+
+	// A "." default makes everything namespace-private unless listed.
+	strict := &VisibilityPolicy{Default: "."}
+	if strict.visibleTo("a.ns1.svc.cluster.local", "ns2") {
+		t.Error("default-private service visible across namespaces")
+	}
+	if !strict.visibleTo("a.ns1.svc.cluster.local", "ns1") {
+		t.Error("default-private service not visible to own namespace")
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Mesh-expansion VMs have no kubelet probing them, so their endpoints were
+// always pushed as healthy. A VM can instead register a health-check
+// definition with its workload labels; once it does, the endpoint's EDS
+// health status comes from reports fed to Pilot (by an agent or an external
+// checker) rather than from optimism. The definition itself - port and path -
+// is carried on the labels so whoever runs the probe knows what to hit.
+
+const (
+	// HealthCheckPortLabel declares the port a workload's health check
+	// listens on. Its presence switches the endpoint from assumed-healthy to
+	// report-driven health.
+	HealthCheckPortLabel = "istio.io/healthCheckPort"
+
+	// HealthCheckPathLabel optionally declares the HTTP path of the health
+	// check; an empty path means a TCP check on the port.
+	HealthCheckPathLabel = "istio.io/healthCheckPath"
+)
+
+// vmHealthReport is the last reported state for one address.
+type vmHealthReport struct {
+	Healthy  bool
+	Source   string
+	Reported time.Time
+}
+
+var (
+	// vmHealthMutex guards vmHealth.
+	vmHealthMutex sync.RWMutex
+
+	// vmHealth holds the reported state, keyed by endpoint address.
+	vmHealth = map[string]*vmHealthReport{}
+
+	vmHealthReports = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pilot_vm_health_reports",
+		Help: "Workload health reports received, by reported status.",
+	}, []string{"status"})
+)
+
+func init() {
+	prometheus.MustRegister(vmHealthReports)
+}
+
+// healthStatusFor returns the EDS health status for an endpoint. An explicit
+// report takes precedence over anything label-derived. Without a report,
+// endpoints with no registered health check keep the zero UNKNOWN status
+// Envoy treats as healthy - the historical behavior - while endpoints that
+// registered a check are unhealthy until a report says otherwise.
+func healthStatusFor(address string, labels map[string]string) core.HealthStatus {
+	vmHealthMutex.RLock()
+	r := vmHealth[address]
+	vmHealthMutex.RUnlock()
+	if r != nil {
+		if r.Healthy {
+			return core.HealthStatus_HEALTHY
+		}
+		return core.HealthStatus_UNHEALTHY
+	}
+	if labels[HealthCheckPortLabel] == "" {
+		return core.HealthStatus_UNKNOWN
+	}
+	return core.HealthStatus_UNHEALTHY
+}
+
+// reportEndpointHealth records a health report for an address and pushes if
+// the state changed. It returns whether a push was triggered.
+func (s *DiscoveryServer) reportEndpointHealth(address string, healthy bool, source string) bool {
+	status := "unhealthy"
+	if healthy {
+		status = "healthy"
+	}
+	vmHealthReports.With(prometheus.Labels{"status": status}).Add(1)
+
+	vmHealthMutex.Lock()
+	prev, f := vmHealth[address]
+	vmHealth[address] = &vmHealthReport{Healthy: healthy, Source: source, Reported: time.Now()}
+	vmHealthMutex.Unlock()
+
+	if f && prev.Healthy == healthy {
+		return false
+	}
+	adsLog.Infof("VM health: %s healthy=%v source=%s", address, healthy, source)
+
+	// Assignments are precomputed per cluster - force a recompute so the
+	// change takes effect everywhere.
+	s.configUpdateCause(true, pushCauseEndpointHealth)
+	return true
+}
+
+// VMHealthRequest is one POSTed health report.
+type VMHealthRequest struct {
+	Address string `json:"address"`
+	Healthy bool   `json:"healthy"`
+}
+
+// vmhealthz implements the health-report admin API. POST reports a state,
+// GET lists the known reports. It shares the injection token and is mapped
+// to /debug/vmhealth on the monitor port (9093).
+func (s *DiscoveryServer) vmhealthz(w http.ResponseWriter, req *http.Request) {
+	if !injectAuthorized(w, req) {
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+
+	switch req.Method {
+	case http.MethodGet:
+		vmHealthMutex.RLock()
+		out := make(map[string]*vmHealthReport, len(vmHealth))
+		for a, r := range vmHealth {
+			out[a] = r
+		}
+		vmHealthMutex.RUnlock()
+		b, _ := json.MarshalIndent(out, " ", " ")
+		_, _ = w.Write(b)
+	case http.MethodPost:
+		var hr VMHealthRequest
+		if err := json.NewDecoder(req.Body).Decode(&hr); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "{\"error\": %q}\n", err.Error())
+			return
+		}
+		if hr.Address == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(w, "{\"error\": \"address is required\"}")
+			return
+		}
+		pushed := s.reportEndpointHealth(hr.Address, hr.Healthy, "debug")
+		fmt.Fprintf(w, "{\"address\": %q, \"healthy\": %v, \"pushed\": %v}\n", hr.Address, hr.Healthy, pushed)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"testing"
+	"time"
+
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+)
+
+func TestHealthStatusFor(t *testing.T) {
+	checked := map[string]string{HealthCheckPortLabel: "8080"}
+
+	// No health check registered: stay with the zero status.
+	if got := healthStatusFor("10.0.0.1", nil); got != core.HealthStatus_UNKNOWN {
+		t.Errorf("unchecked endpoint: got %v, want UNKNOWN", got)
+	}
+
+	// Registered check without any report: not assumed healthy.
+	if got := healthStatusFor("10.0.0.1", checked); got != core.HealthStatus_UNHEALTHY {
+		t.Errorf("unreported endpoint: got %v, want UNHEALTHY", got)
+	}
+
+	vmHealthMutex.Lock()
+	vmHealth["10.0.0.1"] = &vmHealthReport{Healthy: true, Source: "test", Reported: time.Now()}
+	vmHealthMutex.Unlock()
+	if got := healthStatusFor("10.0.0.1", checked); got != core.HealthStatus_HEALTHY {
+		t.Errorf("healthy report: got %v, want HEALTHY", got)
+	}
+
+	vmHealthMutex.Lock()
+	vmHealth["10.0.0.1"] = &vmHealthReport{Healthy: false, Source: "test", Reported: time.Now()}
+	vmHealthMutex.Unlock()
+	if got := healthStatusFor("10.0.0.1", checked); got != core.HealthStatus_UNHEALTHY {
+		t.Errorf("unhealthy report: got %v, want UNHEALTHY", got)
+	}
+
+	vmHealthMutex.Lock()
+	delete(vmHealth, "10.0.0.1")
+	vmHealthMutex.Unlock()
+}
@@ -0,0 +1,157 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"math"
+	"sort"
+
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/endpoint"
+	"github.com/gogo/protobuf/types"
+
+	"istio.io/istio/pkg/features/pilot"
+)
+
+// maxLoadBalancingWeight is the historical weight ceiling: old Envoys only
+// accepted [1, 128], which quantizes the weights on large meshes, but raising
+// it silently changes every computed traffic split - so the larger range is
+// strictly opt-in.
+const maxLoadBalancingWeight = 128
+
+// edsMaxWeight, if set with PILOT_EDS_MAX_LB_WEIGHT, replaces the default
+// ceiling for meshes where every proxy accepts larger values.
+var edsMaxWeight = uint32(intEnv(pilot.EdsMaxLbWeight, 0))
+
+// maxLoadBalancingWeightFor returns the weight ceiling for a connection.
+func maxLoadBalancingWeightFor(con *XdsConnection) uint32 {
+	if edsMaxWeight > 0 {
+		return edsMaxWeight
+	}
+	return maxLoadBalancingWeight
+}
+
+// Weight normalization strategies, selected with PILOT_EDS_WEIGHT_NORMALIZATION.
+const (
+	// weightProportional scales weights to [1, 128] proportionally, rounding up.
+	// This is the historical default; Ceil can distort ratios when there are
+	// many small localities.
+	weightProportional = "proportional"
+
+	// weightLargestRemainder distributes exactly 128 over the localities using
+	// the largest-remainder method, preserving ratios much better for many
+	// small localities.
+	weightLargestRemainder = "largest-remainder"
+
+	// weightPassthrough leaves the raw endpoint counts as weights.
+	weightPassthrough = "passthrough"
+
+	// weightEqual assigns every locality the same weight.
+	weightEqual = "equal"
+)
+
+// weightNormalization is the selected strategy - see the constants above.
+var weightNormalization = parseWeightNormalization(pilot.EdsWeightNormalization)
+
+func parseWeightNormalization(env string) string {
+	switch env {
+	case weightLargestRemainder, weightPassthrough, weightEqual:
+		return env
+	case "", weightProportional:
+		return weightProportional
+	}
+	adsLog.Warnf("Unknown weight normalization %q, using %s", env, weightProportional)
+	return weightProportional
+}
+
+// normalizeLoadBalancingWeight sets LoadBalancingWeight with a valid value,
+// using the configured normalization strategy.
+func normalizeLoadBalancingWeight(endpoints []endpoint.LocalityLbEndpoints, maxWeight uint32) []endpoint.LocalityLbEndpoints {
+	var totalLbEndpointsNum uint32
+
+	for _, localityLbEndpoint := range endpoints {
+		totalLbEndpointsNum += localityLbEndpoint.GetLoadBalancingWeight().GetValue()
+	}
+	if totalLbEndpointsNum == 0 {
+		return endpoints
+	}
+
+	switch weightNormalization {
+	case weightPassthrough:
+		return endpoints
+	case weightEqual:
+		out := make([]endpoint.LocalityLbEndpoints, len(endpoints))
+		for i, localityLbEndpoint := range endpoints {
+			localityLbEndpoint.LoadBalancingWeight = &types.UInt32Value{Value: 1}
+			out[i] = localityLbEndpoint
+		}
+		return out
+	case weightLargestRemainder:
+		return normalizeLargestRemainder(endpoints, totalLbEndpointsNum, maxWeight)
+	}
+
+	out := make([]endpoint.LocalityLbEndpoints, len(endpoints))
+	for i, localityLbEndpoint := range endpoints {
+		weight := float64(localityLbEndpoint.GetLoadBalancingWeight().GetValue()*maxWeight) / float64(totalLbEndpointsNum)
+		localityLbEndpoint.LoadBalancingWeight = &types.UInt32Value{
+			Value: uint32(math.Ceil(weight)),
+		}
+		out[i] = localityLbEndpoint
+	}
+
+	return out
+}
+
+// normalizeLargestRemainder apportions exactly maxWeight over the
+// localities: each gets the floor of its proportional share (at least 1), and
+// the leftover units go to the largest fractional remainders.
+func normalizeLargestRemainder(endpoints []endpoint.LocalityLbEndpoints, total uint32, maxWeight uint32) []endpoint.LocalityLbEndpoints {
+	out := make([]endpoint.LocalityLbEndpoints, len(endpoints))
+	assigned := uint32(0)
+	remainders := make([]float64, len(endpoints))
+	for i, localityLbEndpoint := range endpoints {
+		share := float64(localityLbEndpoint.GetLoadBalancingWeight().GetValue()) * float64(maxWeight) / float64(total)
+		w := uint32(math.Floor(share))
+		if w < 1 {
+			w = 1
+		}
+		remainders[i] = share - math.Floor(share)
+		localityLbEndpoint.LoadBalancingWeight = &types.UInt32Value{Value: w}
+		out[i] = localityLbEndpoint
+		assigned += w
+	}
+
+	if assigned >= maxWeight {
+		// More localities than weight units (every one got the minimum of 1) -
+		// nothing left to distribute.
+		return out
+	}
+
+	// Hand the remaining units to the largest remainders.
+	order := make([]int, len(out))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return remainders[order[a]] > remainders[order[b]] })
+	for n := maxWeight - assigned; n > 0; {
+		for _, i := range order {
+			if n == 0 {
+				break
+			}
+			out[i].LoadBalancingWeight.Value++
+			n--
+		}
+	}
+	return out
+}
@@ -0,0 +1,126 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"testing"
+
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/endpoint"
+	"github.com/gogo/protobuf/types"
+
+	"istio.io/istio/pilot/pkg/model"
+)
+
+func localitiesWithCounts(counts ...uint32) []endpoint.LocalityLbEndpoints {
+	out := make([]endpoint.LocalityLbEndpoints, 0, len(counts))
+	for _, c := range counts {
+		out = append(out, endpoint.LocalityLbEndpoints{
+			LoadBalancingWeight: &types.UInt32Value{Value: c},
+		})
+	}
+	return out
+}
+
+func weightsOf(eps []endpoint.LocalityLbEndpoints) []uint32 {
+	out := make([]uint32, 0, len(eps))
+	for _, ep := range eps {
+		out = append(out, ep.GetLoadBalancingWeight().GetValue())
+	}
+	return out
+}
+
+func withNormalization(t *testing.T, mode string, f func()) {
+	saved := weightNormalization
+	defer func() { weightNormalization = saved }()
+	weightNormalization = parseWeightNormalization(mode)
+	f()
+	_ = t
+}
+
+func TestNormalizeWeightProportional(t *testing.T) {
+	withNormalization(t, weightProportional, func() {
+		got := weightsOf(normalizeLoadBalancingWeight(localitiesWithCounts(90, 10), maxLoadBalancingWeight))
+		// Historic behavior: proportional scaling with Ceil.
+		if got[0] != 116 || got[1] != 13 {
+			t.Errorf("proportional: got %v, want [116 13]", got)
+		}
+	})
+}
+
+func TestNormalizeWeightLargestRemainder(t *testing.T) {
+	withNormalization(t, weightLargestRemainder, func() {
+		got := weightsOf(normalizeLoadBalancingWeight(localitiesWithCounts(90, 10), maxLoadBalancingWeight))
+		if got[0]+got[1] != maxLoadBalancingWeight {
+			t.Errorf("largest-remainder: weights %v don't sum to %d", got, maxLoadBalancingWeight)
+		}
+		if got[0] != 115 || got[1] != 13 {
+			t.Errorf("largest-remainder: got %v, want [115 13]", got)
+		}
+
+		// Many small localities: total stays exact and every locality gets at least 1.
+		counts := make([]uint32, 40)
+		for i := range counts {
+			counts[i] = 1
+		}
+		got = weightsOf(normalizeLoadBalancingWeight(localitiesWithCounts(counts...), maxLoadBalancingWeight))
+		sum := uint32(0)
+		for _, w := range got {
+			if w < 1 {
+				t.Errorf("largest-remainder: zero weight in %v", got)
+			}
+			if w > 4 {
+				t.Errorf("largest-remainder: unfair weight %d for equal localities %v", w, got)
+			}
+			sum += w
+		}
+		if sum != maxLoadBalancingWeight {
+			t.Errorf("largest-remainder: sum %d, want %d", sum, maxLoadBalancingWeight)
+		}
+	})
+}
+
+func TestNormalizeWeightPassthroughAndEqual(t *testing.T) {
+	withNormalization(t, weightPassthrough, func() {
+		got := weightsOf(normalizeLoadBalancingWeight(localitiesWithCounts(7, 3), maxLoadBalancingWeight))
+		if got[0] != 7 || got[1] != 3 {
+			t.Errorf("passthrough: got %v, want [7 3]", got)
+		}
+	})
+	withNormalization(t, weightEqual, func() {
+		got := weightsOf(normalizeLoadBalancingWeight(localitiesWithCounts(7, 3), maxLoadBalancingWeight))
+		if got[0] != 1 || got[1] != 1 {
+			t.Errorf("equal: got %v, want [1 1]", got)
+		}
+	})
+}
+
+func TestMaxLoadBalancingWeightFor(t *testing.T) {
+	if w := maxLoadBalancingWeightFor(nil); w != maxLoadBalancingWeight {
+		t.Errorf("nil connection: got %d, want %d", w, maxLoadBalancingWeight)
+	}
+	// Without the override every proxy stays on the historical 128 scale.
+	con := newXdsConnection("1.2.3.4:80", nil)
+	con.modelNode = &model.Proxy{Metadata: map[string]string{"ISTIO_PROXY_VERSION": "1.1.0"}}
+	if w := maxLoadBalancingWeightFor(con); w != maxLoadBalancingWeight {
+		t.Errorf("no override: got %d, want %d", w, maxLoadBalancingWeight)
+	}
+
+	saved := edsMaxWeight
+	defer func() { edsMaxWeight = saved }()
+	edsMaxWeight = 65535
+	if w := maxLoadBalancingWeightFor(con); w != 65535 {
+		t.Errorf("override: got %d, want 65535", w)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v2
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"istio.io/istio/pkg/features/pilot"
+)
+
+// WorkloadsByID grows with every pod the registry reports and is only
+// cleaned on explicit nil-label updates, which push-only registries may
+// miss. PILOT_WORKLOAD_CACHE_TTL expires entries the registry stopped
+// refreshing; PILOT_WORKLOAD_CACHE_MAX bounds the cache, evicting the least
+// recently refreshed entries. Both disabled by default.
+
+var (
+	// workloadCacheTTL is the entry expiry window, zero disables expiry.
+	workloadCacheTTL time.Duration
+
+	// workloadCacheMax is the entry bound, zero keeps the cache unbounded.
+	workloadCacheMax int
+
+	workloadCacheSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "pilot_workload_cache_size",
+		Help: "Number of entries in the workload label/annotation cache.",
+	})
+
+	workloadCacheEvictions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pilot_workload_cache_evictions",
+		Help: "Workload cache entries evicted, by reason (ttl, lru).",
+	}, []string{"reason"})
+)
+
+func init() {
+	prometheus.MustRegister(workloadCacheSize)
+	prometheus.MustRegister(workloadCacheEvictions)
+	workloadCacheTTL = envDuration(pilot.WorkloadCacheTTL, 0)
+	workloadCacheMax = intEnv(pilot.WorkloadCacheMax, 0)
+}
+
+// enforceWorkloadBoundLocked evicts the least recently refreshed entries
+// until the cache fits PILOT_WORKLOAD_CACHE_MAX. Caller holds s.mutex.
+func (s *DiscoveryServer) enforceWorkloadBoundLocked() {
+	if workloadCacheMax <= 0 {
+		return
+	}
+	for len(s.WorkloadsByID) > workloadCacheMax {
+		oldestID := ""
+		var oldest time.Time
+		for id, w := range s.WorkloadsByID {
+			if oldestID == "" || w.LastSeen.Before(oldest) {
+				oldestID = id
+				oldest = w.LastSeen
+			}
+		}
+		delete(s.WorkloadsByID, oldestID)
+		workloadCacheEvictions.With(prometheus.Labels{"reason": "lru"}).Add(1)
+	}
+}
+
+// periodicWorkloadExpiry expires stale cache entries. Started only when a
+// TTL is configured.
+func (s *DiscoveryServer) periodicWorkloadExpiry() {
+	interval := workloadCacheTTL / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.expireWorkloads()
+	}
+}
+
+// expireWorkloads removes entries the registry did not refresh within the
+// TTL. The cache only detects label changes, so dropping an entry never
+// loses data - at worst the next label update triggers a full push.
+func (s *DiscoveryServer) expireWorkloads() {
+	s.mutex.Lock()
+	expired := 0
+	for id, w := range s.WorkloadsByID {
+		if w.LastSeen.IsZero() || time.Since(w.LastSeen) <= workloadCacheTTL {
+			continue
+		}
+		delete(s.WorkloadsByID, id)
+		workloadCacheEvictions.With(prometheus.Labels{"reason": "ttl"}).Add(1)
+		expired++
+	}
+	workloadCacheSize.Set(float64(len(s.WorkloadsByID)))
+	s.mutex.Unlock()
+	if expired > 0 {
+		adsLog.Infof("Expired %d workload cache entries not refreshed for %v", expired, workloadCacheTTL)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/hashicorp/consul/api"
 
 	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/serviceregistry"
 	"istio.io/istio/pkg/log"
 )
 
@@ -126,6 +127,7 @@ func convertInstance(instance *api.CatalogService) *model.ServiceInstance {
 			Address:     addr,
 			Port:        instance.ServicePort,
 			ServicePort: port,
+			UID:         model.EndpointUID(string(serviceregistry.ConsulRegistry), instance.Node+"/"+instance.ServiceID, "", addr),
 		},
 		AvailabilityZone: instance.Datacenter,
 		Service: &model.Service{
@@ -35,6 +35,7 @@ import (
 
 	meshconfig "istio.io/api/mesh/v1alpha1"
 	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/serviceregistry"
 	"istio.io/istio/pkg/features/pilot"
 	"istio.io/istio/pkg/log"
 )
@@ -452,7 +453,7 @@ func (c *Controller) InstancesByPort(hostname model.Hostname, reqSvcPort int,
 					if exists {
 						az, _ = c.GetPodAZ(pod)
 						sa = kubeToIstioServiceAccount(pod.Spec.ServiceAccountName, pod.GetNamespace(), c.domainSuffix)
-						uid = fmt.Sprintf("kubernetes://%s.%s", pod.Name, pod.Namespace)
+						uid = model.EndpointUID(string(serviceregistry.KubernetesRegistry), pod.Name, pod.Namespace, ea.IP)
 					}
 
 					// identify the port by name. K8S EndpointPort uses the service port name
@@ -758,7 +759,7 @@ func (c *Controller) updateEDS(ep *v1.Endpoints) {
 
 			labels := map[string]string(convertLabels(pod.ObjectMeta))
 
-			uid := fmt.Sprintf("kubernetes://%s.%s", pod.Name, pod.Namespace)
+			uid := model.EndpointUID(string(serviceregistry.KubernetesRegistry), pod.Name, pod.Namespace, ea.IP)
 
 			// EDS and ServiceEntry use name for service port - ADS will need to
 			// map to numbers.
@@ -781,6 +782,8 @@ func (c *Controller) updateEDS(ep *v1.Endpoints) {
 
 	log.Infof("Handle EDS endpoint %s in namespace %s -> %v %v", ep.Name, ep.Namespace, ep.Subsets, endpoints)
 
+	c.verifyEndpointCounts(ep, hostname, len(endpoints))
+
 	c.XDSUpdater.EDSUpdate(c.ClusterID, string(hostname), endpoints)
 }
 
@@ -0,0 +1,102 @@
+// Copyright 2018 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"strings"
+
+	"k8s.io/api/core/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"istio.io/istio/pkg/log"
+)
+
+// EventSink posts discovery anomalies reported by the xDS server as
+// Kubernetes Events, so "cluster has no instances" or "proxy NACKed config"
+// show up in kubectl describe on the affected Service instead of only in
+// Pilot logs. Posting happens on a buffered channel, never blocking the push
+// path; anomalies beyond the buffer are dropped (the server already
+// rate-limits per service).
+type EventSink struct {
+	client kubernetes.Interface
+
+	// namespace receives anomalies not attributable to a Service, e.g.
+	// config NACKs - normally the namespace Pilot runs in.
+	namespace string
+
+	events chan *v1.Event
+}
+
+// NewEventSink creates the sink and starts its posting worker.
+func NewEventSink(client kubernetes.Interface, namespace string) *EventSink {
+	if namespace == "" {
+		namespace = meta_v1.NamespaceDefault
+	}
+	s := &EventSink{
+		client:    client,
+		namespace: namespace,
+		events:    make(chan *v1.Event, 100),
+	}
+	go s.run()
+	return s
+}
+
+// Anomaly implements the xDS server's event sink interface.
+func (s *EventSink) Anomaly(reason, hostname, message string) {
+	ev := &v1.Event{
+		ObjectMeta: meta_v1.ObjectMeta{
+			GenerateName: "pilot-discovery-",
+			Namespace:    s.namespace,
+		},
+		InvolvedObject: v1.ObjectReference{
+			Kind:      "Namespace",
+			Name:      s.namespace,
+			Namespace: s.namespace,
+		},
+		Reason:         reason,
+		Message:        message,
+		Type:           v1.EventTypeWarning,
+		Source:         v1.EventSource{Component: "pilot"},
+		FirstTimestamp: meta_v1.Now(),
+		LastTimestamp:  meta_v1.Now(),
+		Count:          1,
+	}
+	// Cluster-local hostnames ("name.namespace.svc...") attach the event to
+	// the Service itself.
+	if parts := strings.Split(hostname, "."); len(parts) >= 3 && parts[2] == "svc" {
+		ev.ObjectMeta.Namespace = parts[1]
+		ev.InvolvedObject = v1.ObjectReference{
+			Kind:      "Service",
+			Name:      parts[0],
+			Namespace: parts[1],
+		}
+	}
+
+	select {
+	case s.events <- ev:
+	default:
+		// Never block a push on the API server.
+	}
+}
+
+func (s *EventSink) run() {
+	for ev := range s.events {
+		if _, err := s.client.CoreV1().Events(ev.ObjectMeta.Namespace).Create(ev); err != nil {
+			log.Warnf("Failed to post discovery event %s for %s/%s: %v",
+				ev.Reason, ev.InvolvedObject.Namespace, ev.InvolvedObject.Name, err)
+		}
+	}
+}
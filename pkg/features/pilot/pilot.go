@@ -61,4 +61,210 @@ var (
 
 	// AzDebug indicates whether to log service registry az info.
 	AzDebug = os.Getenv("VERBOSE_AZ_DEBUG") == "1"
+
+	// Tenant restricts the xDS server to proxies declaring this tenant in
+	// their node metadata, for hosted multi-tenant control planes. Empty
+	// (default) serves all proxies.
+	Tenant = os.Getenv("PILOT_TENANT")
+
+	// Revision identifies the control-plane rollout this Pilot belongs to.
+	// Proxies pinned to another revision in their node metadata are redirected
+	// with a hint, so canarying a Pilot build doesn't mix proxy populations.
+	Revision = os.Getenv("PILOT_REVISION")
+
+	// EndpointTTL expires endpoint shards that were not refreshed within the
+	// window. Intended for push-only registries (webhooks, MCP feeds) that may
+	// miss delete events. Empty or "0" disables expiry.
+	// Example: "300ms", "10s" or "2h45m".
+	EndpointTTL = os.Getenv("PILOT_ENDPOINT_TTL")
+
+	// OmitEmptyClusters skips pushing ClusterLoadAssignments for clusters that
+	// never had endpoints. Clusters whose endpoints were all removed still get
+	// an explicit empty push, so Envoy doesn't retain ghost endpoints.
+	// Default is to push explicit empty assignments for everything.
+	OmitEmptyClusters = os.Getenv("PILOT_OMIT_EMPTY_CLUSTERS") == "1"
+
+	// EdsMaxLbWeight overrides the locality load-balancing weight ceiling.
+	// When unset, the historical [1,128] range applies; raising it changes
+	// every computed traffic split, so the expanded range is strictly opt-in.
+	EdsMaxLbWeight = os.Getenv("PILOT_EDS_MAX_LB_WEIGHT")
+
+	// EdsWeightNormalization selects how locality load-balancing weights are
+	// normalized before pushing: "proportional" (default, scale to [1,128]
+	// rounding up), "largest-remainder" (apportion exactly 128, fairer for
+	// many small localities), "passthrough" or "equal".
+	EdsWeightNormalization = os.Getenv("PILOT_EDS_WEIGHT_NORMALIZATION")
+
+	// LocalityLabels selects which endpoint labels map to region, zone and
+	// subzone, as a comma-separated list "region-label,zone-label,subzone-label".
+	// This lets on-prem clusters with custom rack labels get a correct
+	// three-level locality. Unset labels fall back to the registry-provided
+	// availability zone.
+	LocalityLabels = os.Getenv("PILOT_LOCALITY_LABELS")
+
+	// EdsIdleTimeout is how long an unwatched EDS cluster and its precomputed
+	// assignment are retained after the last watcher disconnects, so brief
+	// reconnects don't recompute it. Empty or "0" deletes immediately.
+	// Example: "300ms", "10s" or "2h45m".
+	EdsIdleTimeout = os.Getenv("PILOT_EDS_IDLE_TTL")
+
+	// EdsMaxIdleClusters bounds the number of unwatched EDS clusters retained
+	// while waiting for PILOT_EDS_IDLE_TTL. Oldest idle clusters are evicted
+	// beyond this limit. Defaults to 512.
+	EdsMaxIdleClusters = os.Getenv("PILOT_EDS_MAX_IDLE_CLUSTERS")
+
+	// StreamResumption skips the initial push for proxies that reconnect
+	// already holding the current config version (sent as version_info on the
+	// first request), cutting bandwidth during reconnect storms after a
+	// transient network blip. Enabled with PILOT_ENABLE_STREAM_RESUMPTION=1.
+	StreamResumption = os.Getenv("PILOT_ENABLE_STREAM_RESUMPTION") == "1"
+
+	// MaxClustersPerConnection bounds the number of clusters a single stream
+	// may subscribe to via EDS. Subscriptions beyond the limit are rejected
+	// with a clear error. Zero or unset disables the quota.
+	MaxClustersPerConnection = os.Getenv("PILOT_MAX_CLUSTERS_PER_CONNECTION")
+
+	// InjectToken enables the manual endpoint injection admin API and sets
+	// the bearer token it requires. Empty (default) keeps the API disabled.
+	InjectToken = os.Getenv("PILOT_INJECT_TOKEN")
+
+	// ResidencyLabel names the endpoint label carrying a data-residency zone.
+	// When set, endpoints labeled with a residency are only pushed to proxies
+	// declaring the same residency in their node metadata; the rest are
+	// filtered out and reported through push status. Empty disables filtering.
+	ResidencyLabel = os.Getenv("PILOT_RESIDENCY_LABEL")
+
+	// VerifyEndpointCounts enables a verifier in the Kubernetes registry
+	// that compares each computed endpoint shard against the raw Endpoints
+	// object's address count and flags divergence (missed events, filter
+	// bugs) via metrics and push status. Enabled with
+	// PILOT_VERIFY_ENDPOINT_COUNTS=1.
+	VerifyEndpointCounts = os.Getenv("PILOT_VERIFY_ENDPOINT_COUNTS") == "1"
+
+	// PushPriorityTypes lists the proxy types pushed ahead of the rest
+	// during full pushes and throttling, as a comma-separated list of node
+	// types. Gateways affect external traffic and should converge first;
+	// the default is "router,ingress". Empty string keeps the default, "-"
+	// disables prioritization.
+	PushPriorityTypes = os.Getenv("PILOT_PUSH_PRIORITY_TYPES")
+
+	// AdaptiveDebounce adjusts the push debounce window to the observed
+	// change rate: shorter when the mesh is quiet, longer under sustained
+	// churn, bounded by PILOT_DEBOUNCE_AFTER/4 and PILOT_DEBOUNCE_MAX/2.
+	// Enabled with PILOT_ADAPTIVE_DEBOUNCE=1.
+	AdaptiveDebounce = os.Getenv("PILOT_ADAPTIVE_DEBOUNCE")
+
+	// EndpointMetadata controls the istio filter metadata (uid/network)
+	// emitted on EDS endpoints, which Mixer telemetry depends on but which
+	// inflates push size on large clusters: "" (default) emits everything,
+	// "minimal" keeps only the network (still required by split-horizon
+	// EDS), "none" omits the metadata entirely - only for meshes running
+	// without Mixer and on a single network.
+	EndpointMetadata = os.Getenv("PILOT_ENDPOINT_METADATA")
+
+	// ClaHistory retains the last N computed load assignments per cluster
+	// with timestamps, queryable by time via /debug/history for incident
+	// review. Zero or unset disables history.
+	ClaHistory = os.Getenv("PILOT_CLA_HISTORY")
+
+	// AlertWebhook is a URL POSTed to when a push pipeline alert fires
+	// (NACK storm, push latency SLO breach). Empty disables the built-in
+	// webhook notifier.
+	AlertWebhook = os.Getenv("PILOT_ALERT_WEBHOOK")
+
+	// AlertTemplate is the path of a text/template rendered as the webhook
+	// body, with the Alert as its data. Empty posts the Alert as JSON.
+	AlertTemplate = os.Getenv("PILOT_ALERT_TEMPLATE")
+
+	// AlertNACKStorm is the number of config NACKs per minute that raises a
+	// NACKStorm alert. Defaults to 10.
+	AlertNACKStorm = os.Getenv("PILOT_ALERT_NACK_STORM")
+
+	// PushSLO is the full push duration above which a PushSLOBreach alert is
+	// raised, e.g. "30s". Empty or "0" disables the check.
+	PushSLO = os.Getenv("PILOT_PUSH_SLO")
+
+	// PushLedgerFile persists which proxies completed each full push
+	// generation, so a push interrupted by a restart can be detected and the
+	// proxies that missed it brought up to date (never stream-resumed).
+	// Empty keeps the ledger in memory only.
+	PushLedgerFile = os.Getenv("PILOT_PUSH_LEDGER_FILE")
+
+	// PushTimeout bounds a full push generation, e.g. "5m". Proxies still
+	// pending when it expires are logged and counted as stragglers. Empty or
+	// "0" disables the bound.
+	PushTimeout = os.Getenv("PILOT_PUSH_TIMEOUT")
+
+	// VisibilityPolicy is the path of a JSON file declaring which namespaces
+	// may discover each service (exportTo semantics): hostname patterns map
+	// to a namespace list, "." meaning the service's own namespace and "*"
+	// the whole mesh. Services without an entry follow "default". Empty
+	// disables enforcement and every service stays mesh-wide.
+	VisibilityPolicy = os.Getenv("PILOT_VISIBILITY_POLICY")
+
+	// HostnameEndpointRefresh is how often hostname-typed endpoints resolved
+	// by Pilot are re-resolved, e.g. "30s". Defaults to 60s. Endpoints
+	// labeled istio.io/resolve=envoy are left out of EDS instead, for
+	// clusters using Envoy-side DNS resolution.
+	HostnameEndpointRefresh = os.Getenv("PILOT_HOSTNAME_ENDPOINT_REFRESH")
+
+	// ShardStore selects an external persistence backend for endpoint shard
+	// state, as "backend://address" (for example "etcd://127.0.0.1:2379").
+	// Backends register themselves by name; shard updates are written through
+	// and the store is replayed at startup, so replicas share one
+	// authoritative endpoint store. Empty (default) keeps shards in memory.
+	ShardStore = os.Getenv("PILOT_SHARD_STORE")
+
+	// WorkloadCacheTTL expires entries of the workload label/annotation
+	// cache that the registry has not refreshed within the window, e.g.
+	// "1h". The cache is otherwise only cleaned on explicit deletes, which
+	// push-only registries may miss. Empty or "0" disables expiry.
+	WorkloadCacheTTL = os.Getenv("PILOT_WORKLOAD_CACHE_TTL")
+
+	// WorkloadCacheMax bounds the number of entries in the workload
+	// label/annotation cache; the least recently refreshed entries are
+	// evicted beyond this limit. Zero or unset keeps the cache unbounded.
+	WorkloadCacheMax = os.Getenv("PILOT_WORKLOAD_CACHE_MAX")
+
+	// Chaos enables a test-only fault injector on the xDS send path, as a
+	// JSON spec: {"match":"<glob on connection ID>","delay":"200ms",
+	// "delayRate":0.5,"dropRate":0.1,"reorderRate":0.1}. Matching pushes are
+	// randomly delayed, dropped or swapped with the next push, so platform
+	// teams can validate proxy behavior under a slow or lossy control plane.
+	// Never set this in production.
+	Chaos = os.Getenv("PILOT_CHAOS")
+
+	// PushScheduler selects the push scheduling policy by name, e.g.
+	// "priority" (the default: gateways first, then FIFO). Unknown names
+	// fall back to the default with a warning.
+	PushScheduler = os.Getenv("PILOT_PUSH_SCHEDULER")
+
+	// IPFamilyPolicy names a JSON file declaring which IP family dual-stack
+	// services emit per proxy: {"default":"both","services":
+	// {"*.internal":"prefer_v6"}}. Empty (default) pushes every family.
+	IPFamilyPolicy = os.Getenv("PILOT_IP_FAMILY_POLICY")
+
+	// EventBus selects a message bus backend for endpoint events, as
+	// scheme://address (e.g. "nats://bus:4222"). Registry shard updates are
+	// published to it and events consumed from it drive EDS. Empty disables
+	// the integration.
+	EventBus = os.Getenv("PILOT_EVENT_BUS")
+
+	// Standby starts the replica in read-only standby mode: shards and
+	// caches are maintained but proxy streams are refused until the replica
+	// is promoted through /debug/standby.
+	Standby = os.Getenv("PILOT_STANDBY") == "1"
+
+	// SnapshotKey names the key source for encrypting persisted discovery
+	// state (push ledger, shard snapshots) at rest, as scheme://ref - e.g.
+	// "file:///etc/istio/keys/snapshot" or "env://SNAPSHOT_KEY_B64". The key
+	// must be 32 bytes (raw or base64). Endpoint dumps reveal the full
+	// internal topology, so deployments persisting them to shared disks
+	// should set this. Empty disables encryption.
+	SnapshotKey = os.Getenv("PILOT_SNAPSHOT_KEY")
+
+	// RejectNonADSEds closes EDS streams from proxies that did not first
+	// request clusters on the same stream (non-ADS usage). Proxies opening
+	// one EDS stream per cluster can explode the number of connections.
+	RejectNonADSEds = os.Getenv("PILOT_REJECT_NON_ADS_EDS") == "1"
 )